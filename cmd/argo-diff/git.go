@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// git runs a git command in the current directory and returns its trimmed
+// output
+func git(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// changedFiles returns the files changed between base and head, as
+// "git diff --name-only base...head" (relative to their merge base, like a
+// PR). Renamed files are listed under their old and new path.
+func changedFiles(ctx context.Context, base, head string) ([]string, error) {
+	out, err := git(ctx, "diff", "--name-only", "--no-renames", base+"..."+head)
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
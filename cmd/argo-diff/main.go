@@ -0,0 +1,345 @@
+// Command argo-diff diffs the ArgoCD applications affected by a change from
+// a developer's machine, using the same matching and diff engine as the
+// server, and prints the report instead of posting it to a PR.
+//
+// Usage:
+//
+//	argo-diff -base main [flags] [changed files...]
+//
+// Without changed files, they are computed with
+// "git diff --name-only base...head" in the current directory.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/tamcore/argo-diff/pkg/argocd"
+	"github.com/tamcore/argo-diff/pkg/diff"
+	"github.com/tamcore/argo-diff/pkg/logging"
+	"github.com/tamcore/argo-diff/pkg/matcher"
+	"github.com/tamcore/argo-diff/pkg/policy"
+)
+
+// Output formats
+const (
+	formatText     = "text"
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+)
+
+// Exit codes besides 0 (success)
+const (
+	exitError   = 1 // the diff failed, or some applications could not be diffed
+	exitChanges = 2 // applications have changes and -exit-code is set
+)
+
+// errChanges is returned by run if applications have changes and
+// -exit-code is set
+var errChanges = errors.New("applications have changes")
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// options are the command line flags
+type options struct {
+	server              string
+	token               string
+	plainText           bool
+	argocdURL           string
+	repo                string
+	base                string
+	head                string
+	changedFiles        []string
+	destinationClusters stringList
+	ignoredMetadata     stringList
+	kindOrder           stringList
+	groupByKind         bool
+	normalizeEmbedded   bool
+	includeHooks        bool
+	noDedupe            bool
+	maxDiffLines        int
+	kubeVersion         string
+	policyFile          string
+	debugMatching       bool
+	format              string
+	output              string
+	color               string
+	exitCode            bool
+	timeout             time.Duration
+	logLevel            string
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errChanges):
+		os.Exit(exitChanges)
+	default:
+		fmt.Fprintf(os.Stderr, "argo-diff: %v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	opts, err := parseFlags(args, stderr)
+	if err != nil {
+		return err
+	}
+	logging.InitWriter(stderr, opts.logLevel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	if err := resolveGitDefaults(ctx, opts); err != nil {
+		return err
+	}
+
+	report, markdown, err := diffApps(ctx, opts, stderr)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	switch opts.format {
+	case formatMarkdown:
+		out = []byte(markdown + "\n")
+	case formatJSON:
+		if out, err = diff.FormatReportJSON(report); err != nil {
+			return fmt.Errorf("format report: %w", err)
+		}
+		out = append(out, '\n')
+	default:
+		out = []byte(diff.FormatReportText(report, useColor(opts, stdout)))
+	}
+
+	if opts.output != "" {
+		if err := os.WriteFile(opts.output, out, 0o644); err != nil {
+			return fmt.Errorf("write report: %w", err)
+		}
+	} else if _, err := stdout.Write(out); err != nil {
+		return err
+	}
+
+	for _, r := range report.Results {
+		if r.ErrorMessage != "" {
+			return fmt.Errorf("application %s could not be diffed", r.AppInfo.Name)
+		}
+	}
+	if opts.exitCode && report.AppsWithDiffs > 0 {
+		return errChanges
+	}
+	return nil
+}
+
+func parseFlags(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("argo-diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: argo-diff -base <ref> [flags] [changed files...]\n\n")
+		fmt.Fprintf(stderr, "Diffs the ArgoCD applications affected by the changed files between two refs.\n")
+		fmt.Fprintf(stderr, "Without changed files, they are computed with \"git diff --name-only base...head\".\n\n")
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&opts.server, "server", os.Getenv("ARGOCD_SERVER"), "ArgoCD server address, e.g. argocd.example.com:443 (env ARGOCD_SERVER)")
+	fs.StringVar(&opts.token, "token", os.Getenv("ARGOCD_AUTH_TOKEN"), "ArgoCD API token (env ARGOCD_AUTH_TOKEN)")
+	fs.BoolVar(&opts.plainText, "plaintext", os.Getenv("ARGOCD_PLAINTEXT") == "true", "connect to ArgoCD without TLS (env ARGOCD_PLAINTEXT)")
+	fs.StringVar(&opts.argocdURL, "argocd-url", "", "ArgoCD UI URL for application links in the markdown and JSON reports")
+	fs.StringVar(&opts.repo, "repo", "", "repository URL or owner/repo the applications track (default: URL of the origin remote)")
+	fs.StringVar(&opts.base, "base", "", "base ref or commit, must be pushed (required)")
+	fs.StringVar(&opts.head, "head", "", "head ref or commit, must be pushed (default: the commit of HEAD)")
+	fs.Var(&opts.destinationClusters, "destination-cluster", "only diff apps targeting this destination cluster name (repeatable)")
+	fs.Var(&opts.ignoredMetadata, "ignore-metadata", "label/annotation key, or prefix ending with /, to ignore in diffs (repeatable)")
+	fs.Var(&opts.kindOrder, "kind-order", "kind priority for ordering resource diffs (repeatable)")
+	fs.BoolVar(&opts.groupByKind, "group-by-kind", false, "render a heading per kind in the markdown report")
+	fs.BoolVar(&opts.normalizeEmbedded, "normalize-embedded", true, "pretty-print JSON/YAML/TOML embedded in ConfigMap data before diffing")
+	fs.BoolVar(&opts.includeHooks, "include-hooks", false, "diff Helm and ArgoCD hooks")
+	fs.BoolVar(&opts.noDedupe, "no-dedupe", false, "do not deduplicate identical diffs across apps")
+	fs.IntVar(&opts.maxDiffLines, "max-diff-lines", 0, "cut off the diff of a resource after this many lines (0 = no limit)")
+	fs.StringVar(&opts.kubeVersion, "kube-version", "", "target Kubernetes version for API deprecations, e.g. 1.29")
+	fs.StringVar(&opts.policyFile, "policy-file", "", "YAML file with policies to evaluate against the head resources")
+	fs.BoolVar(&opts.debugMatching, "debug-matching", false, "print why apps were matched or excluded")
+	fs.StringVar(&opts.format, "format", formatText, "output format: text, markdown or json")
+	fs.StringVar(&opts.output, "o", "", "write the report to this file instead of stdout")
+	fs.StringVar(&opts.color, "color", "auto", "color the text output: auto, always or never")
+	fs.BoolVar(&opts.exitCode, "exit-code", false, fmt.Sprintf("exit with %d if applications have changes", exitChanges))
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Minute, "maximum duration of the diff")
+	fs.StringVar(&opts.logLevel, "log-level", "warn", "log level: debug, info, warn or error")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	opts.changedFiles = fs.Args()
+
+	switch {
+	case opts.server == "":
+		return nil, fmt.Errorf("-server or ARGOCD_SERVER is required")
+	case opts.token == "":
+		return nil, fmt.Errorf("-token or ARGOCD_AUTH_TOKEN is required")
+	case opts.base == "":
+		return nil, fmt.Errorf("-base is required")
+	case !slices.Contains([]string{formatText, formatMarkdown, formatJSON}, opts.format):
+		return nil, fmt.Errorf("-format must be %s, %s or %s, got %q", formatText, formatMarkdown, formatJSON, opts.format)
+	case !slices.Contains([]string{"auto", "always", "never"}, opts.color):
+		return nil, fmt.Errorf("-color must be auto, always or never, got %q", opts.color)
+	case opts.maxDiffLines < 0:
+		return nil, fmt.Errorf("-max-diff-lines must not be negative, got %d", opts.maxDiffLines)
+	case opts.timeout <= 0:
+		return nil, fmt.Errorf("-timeout must be positive, got %s", opts.timeout)
+	}
+	return opts, nil
+}
+
+// resolveGitDefaults fills in the repository, head and changed files that
+// were not given from the git repository in the current directory
+func resolveGitDefaults(ctx context.Context, opts *options) error {
+	var err error
+	if opts.repo == "" {
+		if opts.repo, err = git(ctx, "remote", "get-url", "origin"); err != nil {
+			return fmt.Errorf("determine repository, set -repo: %w", err)
+		}
+	}
+	if opts.head == "" {
+		if opts.head, err = git(ctx, "rev-parse", "HEAD"); err != nil {
+			return fmt.Errorf("determine head, set -head: %w", err)
+		}
+	}
+	if len(opts.changedFiles) == 0 {
+		if opts.changedFiles, err = changedFiles(ctx, opts.base, opts.head); err != nil {
+			return fmt.Errorf("determine changed files, pass them as arguments: %w", err)
+		}
+	}
+	return nil
+}
+
+// diffApps diffs the applications affected by the changed files, like the
+// server does for a webhook, and returns the report and its markdown.
+// Progress is written to stderr.
+func diffApps(ctx context.Context, opts *options, stderr io.Writer) (*diff.DiffReport, string, error) {
+	argoClient, err := argocd.NewClient(ctx, opts.server, opts.token, opts.plainText)
+	if err != nil {
+		return nil, "", fmt.Errorf("connect to ArgoCD: %w", err)
+	}
+	defer func() { _ = argoClient.Close() }()
+
+	apps, err := argoClient.ListApplications(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("list applications: %w", err)
+	}
+
+	projects, err := argoClient.ListProjects(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "warning: not checking the source repositories of projects: %v\n", err)
+	}
+
+	affectedApps := matcher.MatchApplications(apps, opts.repo, opts.changedFiles, opts.destinationClusters, projects)
+	var matchDetails string
+	if opts.debugMatching {
+		explanations := matcher.ExplainMatches(apps, opts.repo, opts.changedFiles, opts.destinationClusters, projects)
+		for _, e := range explanations {
+			switch {
+			case e.Matched():
+				fmt.Fprintf(stderr, "matched  %s: %s %s\n", e.App.Name, e.MatchReason, strings.Join(e.MatchedPaths, ", "))
+			case e.NearMiss():
+				fmt.Fprintf(stderr, "excluded %s: %s (source paths: %s, cluster: %s, project: %s)\n", e.App.Name, e.ExcludedReason, strings.Join(e.SourcePaths, ", "), e.Cluster, e.App.Spec.Project)
+			}
+		}
+		matchDetails = diff.FormatMatchDetails(explanations)
+	}
+	fmt.Fprintf(stderr, "%d of %d applications affected by %d changed files\n", len(affectedApps), len(apps), len(opts.changedFiles))
+
+	var policies diff.PolicyChecker
+	if opts.policyFile != "" {
+		set, err := policy.Load(opts.policyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("load policies: %w", err)
+		}
+		policies = set
+	}
+
+	var results []*diff.DiffResult
+	for i, app := range affectedApps {
+		fmt.Fprintf(stderr, "[%d/%d] diffing %s\n", i+1, len(affectedApps), app.Name)
+		appInfo := diff.NewAppInfo(app, opts.argocdURL)
+
+		baseManifests, err := argoClient.GetAppManifests(ctx, app, opts.base)
+		if err != nil {
+			results = append(results, &diff.DiffResult{AppInfo: appInfo, ErrorMessage: fmt.Sprintf("Failed to get base manifests: %v", err)})
+			continue
+		}
+		headManifests, err := argoClient.GetAppManifests(ctx, app, opts.head)
+		if err != nil {
+			results = append(results, &diff.DiffResult{AppInfo: appInfo, ErrorMessage: fmt.Sprintf("Failed to get head manifests: %v", err)})
+			continue
+		}
+
+		result, err := diff.GenerateDiffWithOptions(baseManifests, headManifests, appInfo, &diff.DiffOptions{
+			IgnoredMetadata:   opts.ignoredMetadata,
+			KindOrder:         opts.kindOrder,
+			GroupByKind:       opts.groupByKind,
+			MaxDiffLines:      opts.maxDiffLines,
+			NormalizeEmbedded: opts.normalizeEmbedded,
+			IncludeHooks:      opts.includeHooks,
+			KubeVersion:       opts.kubeVersion,
+			Policies:          policies,
+		})
+		if err != nil {
+			results = append(results, &diff.DiffResult{AppInfo: appInfo, ErrorMessage: fmt.Sprintf("Failed to generate diff: %v", err)})
+			continue
+		}
+		results = append(results, result)
+	}
+
+	// Flag resources that several apps would fight over after merge
+	var unaffected []*appv1.Application
+	for _, app := range apps {
+		if !slices.Contains(affectedApps, app) {
+			unaffected = append(unaffected, app)
+		}
+	}
+	diff.DetectOwnershipConflicts(results, diff.ManagedResources(unaffected))
+
+	report := diff.NewDiffReportWithOptions("ArgoCD Diff", results, !opts.noDedupe)
+	return report, diff.FormatReport(report) + matchDetails, nil
+}
+
+// useColor reports whether the text report is colored: with -color auto,
+// if it is written to a terminal and NO_COLOR is not set
+func useColor(opts *options, stdout io.Writer) bool {
+	switch opts.color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if opts.output != "" || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := stdout.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
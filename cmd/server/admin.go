@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/tamcore/argo-diff/pkg/auth"
+	"github.com/tamcore/argo-diff/pkg/logging"
+)
+
+// adminHandler returns the admin API to inspect and control the job queue.
+// It is served on ADMIN_PORT and requires ADMIN_TOKEN as bearer token.
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs", s.handleAdminJobs)
+	mux.HandleFunc("DELETE /jobs/{id}", s.handleAdminCancel)
+	mux.HandleFunc("POST /pause", s.handleAdminPause)
+	mux.HandleFunc("POST /resume", s.handleAdminResume)
+	mux.HandleFunc("POST /drain", s.handleAdminDrain)
+	mux.HandleFunc("GET /dead-letters", s.handleAdminDeadLetters)
+	return s.requireAdminToken(mux)
+}
+
+// requireAdminToken rejects requests without the admin bearer token
+func (s *Server) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.ExtractBearerToken(r.Header.Get("Authorization"))
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+			logging.Warn("Unauthorized admin request", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminJobs lists the running, retrying and queued jobs along with
+// the pool status
+func (s *Server) handleAdminJobs(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, map[string]any{
+		"status": s.pool.Status(),
+		"jobs":   s.pool.Jobs(),
+	})
+}
+
+func (s *Server) handleAdminCancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !s.pool.Cancel(id) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	writeAdminJSON(w, map[string]string{"status": "cancelled", "id": id})
+}
+
+func (s *Server) handleAdminPause(w http.ResponseWriter, _ *http.Request) {
+	s.pool.Pause()
+	writeAdminJSON(w, s.pool.Status())
+}
+
+func (s *Server) handleAdminResume(w http.ResponseWriter, _ *http.Request) {
+	if s.pool.Status().Draining {
+		http.Error(w, "Worker pool is draining", http.StatusConflict)
+		return
+	}
+	s.pool.Resume()
+	writeAdminJSON(w, s.pool.Status())
+}
+
+// handleAdminDrain stops accepting webhooks, so the readiness probe fails,
+// and lets the workers finish the accepted jobs. It cannot be undone without
+// restarting the replica.
+func (s *Server) handleAdminDrain(w http.ResponseWriter, _ *http.Request) {
+	s.pool.Drain()
+	logging.Info("Worker pool draining via admin API")
+	writeAdminJSON(w, s.pool.Status())
+}
+
+// handleAdminDeadLetters lists the jobs that failed permanently or ran out
+// of retries
+func (s *Server) handleAdminDeadLetters(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, map[string]any{
+		"dead_letters": s.pool.DeadLetters(),
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/tamcore/argo-diff/pkg/diff"
+	"github.com/tamcore/argo-diff/pkg/logging"
+	"github.com/tamcore/argo-diff/pkg/metrics"
+)
+
+// handleDiff is a dry run of /webhook: it diffs the affected applications
+// and returns the report as markdown and JSON instead of posting it, so
+// ignore patterns and matching can be tested without commenting on a PR.
+// It takes the same OIDC token and payload, except that github_token is only
+// required to list the changed files if changed_files is omitted, and has
+// its own rate limit.
+func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	ctx := logging.WithRequestID(r.Context(), requestID)
+	log := logging.FromContext(ctx)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	repo, ok := s.authenticate(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !s.allow(w, s.diffLimiter, repo, log) {
+		return
+	}
+	payload, ok := decodePayload(w, r, repo, validateJobPayload, log)
+	if !ok {
+		return
+	}
+	job := s.newJob(payload)
+
+	// Dry runs are synchronous, so they share the bound of ?sync=true jobs
+	select {
+	case s.syncSem <- struct{}{}:
+		defer func() { <-s.syncSem }()
+	default:
+		metrics.RecordWebhookReceived(payload.Repository, "dry_run_rejected")
+		log.Warn("Too many concurrent sync jobs, rejecting dry run",
+			"repository", payload.Repository,
+			"pr_number", payload.PRNumber,
+		)
+		http.Error(w, "Too many concurrent sync jobs, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	log.Info("Processing dry run",
+		"repository", payload.Repository,
+		"pr_number", payload.PRNumber,
+		"workflow", payload.WorkflowName,
+		"changed_files", len(payload.ChangedFiles),
+	)
+
+	jobCtx, cancel := context.WithTimeout(ctx, s.cfg.JobTimeout)
+	defer cancel()
+
+	report, markdown, err := s.diffJob(jobCtx, job, nil)
+	if err != nil {
+		log.Error("Dry run failed",
+			"repository", payload.Repository,
+			"pr_number", payload.PRNumber,
+			"error", err,
+		)
+		metrics.RecordWebhookReceived(payload.Repository, "dry_run_failed")
+		http.Error(w, fmt.Sprintf("Dry run failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	metrics.RecordWebhookReceived(payload.Repository, "dry_run_completed")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status":   "completed",
+		"message":  fmt.Sprintf("Dry run completed for %s PR #%d", payload.Repository, payload.PRNumber),
+		"markdown": markdown,
+		"report":   diff.NewJSONReport(report),
+	})
+	log.Info("Dry run completed",
+		"repository", payload.Repository,
+		"pr_number", payload.PRNumber,
+	)
+}
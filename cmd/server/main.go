@@ -4,15 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
+	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"github.com/tamcore/argo-diff/pkg/argocd"
 	"github.com/tamcore/argo-diff/pkg/auth"
 	"github.com/tamcore/argo-diff/pkg/config"
@@ -21,8 +25,10 @@ import (
 	"github.com/tamcore/argo-diff/pkg/logging"
 	"github.com/tamcore/argo-diff/pkg/matcher"
 	"github.com/tamcore/argo-diff/pkg/metrics"
+	"github.com/tamcore/argo-diff/pkg/policy"
 	"github.com/tamcore/argo-diff/pkg/ratelimit"
 	"github.com/tamcore/argo-diff/pkg/sanitize"
+	"github.com/tamcore/argo-diff/pkg/schema"
 	"github.com/tamcore/argo-diff/pkg/worker"
 )
 
@@ -33,7 +39,7 @@ type WebhookPayload struct {
 	PRNumber             int      `json:"pr_number"`
 	BaseRef              string   `json:"base_ref"`
 	HeadRef              string   `json:"head_ref"`
-	ChangedFiles         []string `json:"changed_files"`
+	ChangedFiles         []string `json:"changed_files,omitempty"` // Optional: listed from the PR on GitHub if omitted
 	WorkflowName         string   `json:"workflow_name"`
 	DedupeDiffs          *bool    `json:"dedupe_diffs,omitempty"`           // Default: true - deduplicate identical diffs across apps
 	ArgocdURL            string   `json:"argocd_url,omitempty"`             // Optional: ArgoCD UI URL for "View in ArgoCD" links
@@ -41,14 +47,22 @@ type WebhookPayload struct {
 	IgnoredMetadata      []string `json:"ignored_metadata,omitempty"`       // List of label/annotation keys or prefixes to ignore (e.g., "argocd.argoproj.io/", "app.kubernetes.io/version")
 	CollapseThreshold    *int     `json:"collapse_threshold,omitempty"`     // Default: 3 - collapse all diffs if comment parts exceed this threshold (0 = disabled)
 	DestinationClusters  []string `json:"destination_clusters,omitempty"`   // Optional: only include apps targeting these destination cluster names
+	KindOrder            []string `json:"kind_order,omitempty"`             // Optional: kind priority for ordering resource diffs (default: namespaces, CRDs, RBAC, config, workloads)
+	GroupByKind          bool     `json:"group_by_kind,omitempty"`          // Default: false - render a heading per kind above the resource diffs
+	NormalizeEmbedded    *bool    `json:"normalize_embedded,omitempty"`     // Default: true - pretty-print JSON/YAML/TOML embedded in ConfigMap data before diffing
+	IncludeHooks         bool     `json:"include_hooks,omitempty"`          // Default: false - diff Helm/ArgoCD hooks in a separate section
+	RiskRules            []string `json:"risk_rules,omitempty"`             // Optional: risk rules to run (omitted = all, [] = none)
+	DebugMatching        bool     `json:"debug_matching,omitempty"`         // Default: false - append why apps were (not) matched to the comment
 }
 
 type Server struct {
-	cfg     *config.Config
-	oidc    *auth.OIDCValidator
-	pool    *worker.Pool
-	limiter *ratelimit.Limiter
-	syncSem chan struct{} // bounds concurrent synchronous (?sync=true) jobs
+	cfg         *config.Config
+	oidc        *auth.OIDCValidator
+	pool        *worker.Pool
+	limiter     *ratelimit.Limiter
+	diffLimiter *ratelimit.Limiter // separate bucket for /diff and /match dry runs
+	policies    *policy.Set        // nil if POLICY_FILE is not set
+	syncSem     chan struct{}      // bounds concurrent synchronous (?sync=true and /diff) jobs
 }
 
 func main() {
@@ -63,10 +77,22 @@ func main() {
 	logging.Info("Starting argo-diff server",
 		"port", cfg.Port,
 		"metrics_port", cfg.MetricsPort,
+		"admin_api", cfg.AdminToken != "",
+		"admin_port", cfg.AdminPort,
 		"workers", cfg.WorkerCount,
 		"queue_size", cfg.QueueSize,
+		"repo_weights", cfg.RepoWeights,
+		"queue_backend", cfg.QueueBackend,
 		"log_level", cfg.LogLevel,
 		"rate_limit_per_repo", cfg.RateLimitPerRepo,
+		"diff_rate_limit_per_repo", cfg.DiffRateLimitPerRepo,
+		"job_retries", cfg.JobRetries,
+		"job_retry_backoff", cfg.JobRetryBackoff,
+		"max_diff_lines", cfg.MaxDiffLines,
+		"policy_file", cfg.PolicyFile,
+		"kube_versions", cfg.KubeVersions,
+		"schema_validation", cfg.SchemaValidation,
+		"schema_crds", cfg.SchemaCRDs,
 		"argocd_server", cfg.ArgocdServer,
 		"argocd_plaintext", cfg.ArgocdPlainText,
 	)
@@ -83,17 +109,49 @@ func main() {
 		syncSem: make(chan struct{}, cfg.WorkerCount),
 	}
 
+	// Load organization policies if configured
+	if cfg.PolicyFile != "" {
+		srv.policies, err = policy.Load(cfg.PolicyFile)
+		if err != nil {
+			logging.Error("Failed to load policies", "error", err)
+			os.Exit(1)
+		}
+		logging.Info("Loaded policies", "file", cfg.PolicyFile, "count", srv.policies.Len())
+	}
+
 	// Create rate limiter if enabled
 	if cfg.RateLimitPerRepo > 0 {
 		srv.limiter = ratelimit.NewLimiter(cfg.RateLimitPerRepo, time.Minute)
 	}
+	if cfg.DiffRateLimitPerRepo > 0 {
+		srv.diffLimiter = ratelimit.NewLimiter(cfg.DiffRateLimitPerRepo, time.Minute)
+	}
 
 	// Create and start worker pool
 	srv.pool = worker.NewPool(cfg.WorkerCount, cfg.QueueSize, cfg.JobTimeout, srv.processJob)
+	// Share the queue with the other replicas
+	var redisClient *redis.Client
+	if cfg.QueueBackend == "redis" {
+		redisOpts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			logging.Error("Invalid REDIS_URL", "error", sanitize.Error(err))
+			os.Exit(1)
+		}
+		redisClient = redis.NewClient(redisOpts)
+		if err := redisClient.Ping(context.Background()).Err(); err != nil {
+			logging.Error("Failed to connect to Redis", "addr", redisOpts.Addr, "error", err)
+			os.Exit(1)
+		}
+		srv.pool.UseRedis(redisClient, cfg.RedisPrefix, cfg.RedisKey, cfg.QueueLease)
+	}
+	srv.pool.SetRepoWeights(cfg.RepoWeights)
+	srv.pool.SetRetryPolicy(cfg.JobRetries, cfg.JobRetryBackoff)
 	srv.pool.Start()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/webhook", srv.handleWebhook)
+	mux.HandleFunc("/diff", srv.handleDiff)
+	mux.HandleFunc("/match", srv.handleMatch)
 	mux.HandleFunc("/health", srv.handleHealth)
 	mux.HandleFunc("/ready", srv.handleReady)
 
@@ -106,7 +164,7 @@ func main() {
 	}
 	// Fatal server errors are funneled through a channel so the shutdown
 	// path below always runs (os.Exit in a goroutine would skip it).
-	serverErr := make(chan error, 2)
+	serverErr := make(chan error, 3)
 
 	go func() {
 		logging.Info("Metrics server started", "port", cfg.MetricsPort)
@@ -115,6 +173,22 @@ func main() {
 		}
 	}()
 
+	// The admin API is only served if a token is configured
+	var adminServer *http.Server
+	if cfg.AdminToken != "" {
+		adminServer = &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.AdminPort),
+			Handler:           srv.adminHandler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			logging.Info("Admin server started", "port", cfg.AdminPort)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serverErr <- fmt.Errorf("admin server: %w", err)
+			}
+		}()
+	}
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      mux,
@@ -150,14 +224,25 @@ func main() {
 	if err := metricsServer.Shutdown(ctx); err != nil {
 		logging.Error("Metrics server shutdown error", "error", err)
 	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			logging.Error("Admin server shutdown error", "error", err)
+		}
+	}
 
 	// Stop worker pool gracefully
 	srv.pool.Stop(25 * time.Second)
+	if redisClient != nil {
+		_ = redisClient.Close()
+	}
 
 	// Stop rate limiter
 	if srv.limiter != nil {
 		srv.limiter.Stop()
 	}
+	if srv.diffLimiter != nil {
+		srv.diffLimiter.Stop()
+	}
 
 	logging.Info("Shutdown complete")
 	os.Exit(exitCode)
@@ -173,49 +258,193 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	repo, ok := s.authenticate(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !s.allow(w, s.limiter, repo, log) {
+		return
+	}
+	payload, ok := decodePayload(w, r, repo, validatePayload, log)
+	if !ok {
+		return
+	}
+	job := s.newJob(payload)
+
+	// Check if sync processing is requested
+	syncMode := r.URL.Query().Get("sync") == "true"
+
+	// Synchronous jobs may stream their progress
+	var format string
+	if syncMode {
+		var err error
+		format, err = streamFormat(r)
+		if err != nil {
+			log.Warn("Invalid stream format", "error", err)
+			http.Error(w, fmt.Sprintf("Invalid stream format: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else if r.URL.Query().Has("stream") {
+		http.Error(w, "stream requires sync=true", http.StatusBadRequest)
+		return
+	}
+
+	if syncMode {
+		// Bound concurrent sync jobs so ?sync=true cannot bypass the
+		// concurrency limits enforced by the worker pool.
+		select {
+		case s.syncSem <- struct{}{}:
+			defer func() { <-s.syncSem }()
+		default:
+			metrics.RecordWebhookReceived(payload.Repository, "sync_rejected")
+			log.Warn("Too many concurrent sync jobs, rejecting",
+				"repository", payload.Repository,
+				"pr_number", payload.PRNumber,
+			)
+			http.Error(w, "Too many concurrent sync jobs, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Process synchronously - this keeps the connection open
+		// and the GitHub token valid until we're done
+		log.Info("Processing job synchronously",
+			"repository", payload.Repository,
+			"pr_number", payload.PRNumber,
+			"workflow", payload.WorkflowName,
+			"changed_files", len(payload.ChangedFiles),
+			"stream", format,
+		)
+
+		jobCtx, cancel := context.WithTimeout(ctx, s.cfg.JobTimeout)
+		defer cancel()
+
+		// The stream starts with a 200 status, so the result and any
+		// failure are sent as the last event
+		var stream *progressStream
+		if format != "" {
+			stream = newProgressStream(w, format, s.cfg.JobTimeout+time.Minute)
+			defer stream.close()
+			jobCtx = withProgress(jobCtx, stream)
+		}
+
+		report, err := s.runJob(jobCtx, job)
+		if err != nil {
+			log.Error("Sync job failed",
+				"repository", payload.Repository,
+				"pr_number", payload.PRNumber,
+				"error", err,
+			)
+			metrics.RecordWebhookReceived(payload.Repository, "sync_failed")
+			if stream != nil {
+				stream.send("error", map[string]any{
+					"status": "failed",
+					"error":  fmt.Sprintf("Job failed: %v", err),
+				})
+				return
+			}
+			http.Error(w, fmt.Sprintf("Job failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		metrics.RecordWebhookReceived(payload.Repository, "sync_completed")
+		result := map[string]any{
+			"status":  "completed",
+			"message": fmt.Sprintf("Job completed for %s PR #%d", payload.Repository, payload.PRNumber),
+			"report":  diff.NewJSONReport(report),
+		}
+		if stream != nil {
+			stream.send("result", result)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(result)
+		}
+		log.Info("Sync job completed",
+			"repository", payload.Repository,
+			"pr_number", payload.PRNumber,
+		)
+	} else if s.pool.Submit(job) {
+		metrics.RecordWebhookReceived(payload.Repository, "queued")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"status":  "accepted",
+			"message": fmt.Sprintf("Job queued for %s PR #%d", payload.Repository, payload.PRNumber),
+		})
+		log.Info("Job queued",
+			"repository", payload.Repository,
+			"pr_number", payload.PRNumber,
+			"workflow", payload.WorkflowName,
+			"changed_files", len(payload.ChangedFiles),
+		)
+	} else {
+		metrics.RecordWebhookReceived(payload.Repository, "queue_full")
+		http.Error(w, "Queue full, try again later", http.StatusServiceUnavailable)
+		log.Warn("Queue full, job rejected",
+			"repository", payload.Repository,
+			"pr_number", payload.PRNumber,
+		)
+	}
+}
+
+// authenticate validates the OIDC token of a request and returns the
+// repository it was issued for. It writes the error response and returns
+// false if the token is invalid or the repository is not allowlisted.
+func (s *Server) authenticate(ctx context.Context, w http.ResponseWriter, r *http.Request) (string, bool) {
+	log := logging.FromContext(ctx)
+
 	authHeader := r.Header.Get("Authorization")
 	token, err := auth.ExtractBearerToken(authHeader)
 	if err != nil {
 		log.Warn("Invalid authorization header", "error", err)
 		http.Error(w, fmt.Sprintf("Invalid authorization: %v", err), http.StatusUnauthorized)
-		return
+		return "", false
 	}
 
 	repo, err := s.oidc.ValidateToken(ctx, token)
 	if err != nil {
 		log.Warn("Token validation failed", "error", err)
 		http.Error(w, fmt.Sprintf("Token validation failed: %v", err), http.StatusUnauthorized)
-		return
+		return "", false
 	}
 
 	if !s.cfg.IsRepoAllowed(repo) {
 		log.Warn("Repository not in allowlist", "repository", repo)
 		http.Error(w, "Repository not in allowlist", http.StatusForbidden)
-		return
+		return "", false
 	}
 
-	// Check rate limit
-	if s.limiter != nil && !s.limiter.Allow(repo) {
+	return repo, true
+}
+
+// allow applies a per-repository rate limit, if enabled. It writes the
+// error response and returns false if the limit is exceeded.
+func (s *Server) allow(w http.ResponseWriter, limiter *ratelimit.Limiter, repo string, log *slog.Logger) bool {
+	if limiter != nil && !limiter.Allow(repo) {
 		log.Warn("Rate limit exceeded", "repository", repo)
 		metrics.RecordRateLimitHit(repo)
 		metrics.RecordWebhookReceived(repo, "rate_limited")
 		http.Error(w, "Rate limit exceeded, try again later", http.StatusTooManyRequests)
-		return
+		return false
 	}
+	return true
+}
 
+// decodePayload reads and validates the payload of a request authenticated
+// for repo. It writes the error response and returns false if the payload
+// is invalid.
+func decodePayload(w http.ResponseWriter, r *http.Request, repo string, validate func(*WebhookPayload) error, log *slog.Logger) (*WebhookPayload, bool) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
 
 	var payload WebhookPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		log.Warn("Invalid JSON payload", "error", err)
 		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
-	if err := validatePayload(&payload); err != nil {
+	if err := validate(&payload); err != nil {
 		log.Warn("Invalid payload", "error", err)
 		http.Error(w, fmt.Sprintf("Invalid payload: %v", err), http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
 	// The repository in the payload must match the repository the OIDC token
@@ -227,9 +456,14 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 			"token_repository", repo,
 		)
 		http.Error(w, "Payload repository does not match authenticated repository", http.StatusForbidden)
-		return
+		return nil, false
 	}
+	return &payload, true
+}
 
+// newJob builds the job for a validated payload, applying the defaults of
+// unset options
+func (s *Server) newJob(payload *WebhookPayload) worker.Job {
 	if payload.WorkflowName == "" {
 		payload.WorkflowName = "ArgoCD Diff"
 	}
@@ -246,13 +480,19 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		ignoreArgocdTracking = *payload.IgnoreArgocdTracking
 	}
 
+	// Default normalize_embedded to true if not specified
+	normalizeEmbedded := true
+	if payload.NormalizeEmbedded != nil {
+		normalizeEmbedded = *payload.NormalizeEmbedded
+	}
+
 	// Default collapse_threshold to 3 if not specified
 	collapseThreshold := 3
 	if payload.CollapseThreshold != nil {
 		collapseThreshold = *payload.CollapseThreshold
 	}
 
-	job := worker.Job{
+	return worker.Job{
 		Repository:           payload.Repository,
 		PRNumber:             payload.PRNumber,
 		BaseRef:              payload.BaseRef,
@@ -269,80 +509,12 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		IgnoredMetadata:      payload.IgnoredMetadata,
 		CollapseThreshold:    collapseThreshold,
 		DestinationClusters:  payload.DestinationClusters,
-	}
-
-	// Check if sync processing is requested
-	syncMode := r.URL.Query().Get("sync") == "true"
-
-	if syncMode {
-		// Bound concurrent sync jobs so ?sync=true cannot bypass the
-		// concurrency limits enforced by the worker pool.
-		select {
-		case s.syncSem <- struct{}{}:
-			defer func() { <-s.syncSem }()
-		default:
-			metrics.RecordWebhookReceived(payload.Repository, "sync_rejected")
-			log.Warn("Too many concurrent sync jobs, rejecting",
-				"repository", payload.Repository,
-				"pr_number", payload.PRNumber,
-			)
-			http.Error(w, "Too many concurrent sync jobs, try again later", http.StatusServiceUnavailable)
-			return
-		}
-
-		// Process synchronously - this keeps the connection open
-		// and the GitHub token valid until we're done
-		log.Info("Processing job synchronously",
-			"repository", payload.Repository,
-			"pr_number", payload.PRNumber,
-			"workflow", payload.WorkflowName,
-			"changed_files", len(payload.ChangedFiles),
-		)
-
-		jobCtx, cancel := context.WithTimeout(ctx, s.cfg.JobTimeout)
-		defer cancel()
-
-		if err := s.processJob(jobCtx, job); err != nil {
-			log.Error("Sync job failed",
-				"repository", payload.Repository,
-				"pr_number", payload.PRNumber,
-				"error", err,
-			)
-			metrics.RecordWebhookReceived(payload.Repository, "sync_failed")
-			http.Error(w, fmt.Sprintf("Job failed: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		metrics.RecordWebhookReceived(payload.Repository, "sync_completed")
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"status":  "completed",
-			"message": fmt.Sprintf("Job completed for %s PR #%d", payload.Repository, payload.PRNumber),
-		})
-		log.Info("Sync job completed",
-			"repository", payload.Repository,
-			"pr_number", payload.PRNumber,
-		)
-	} else if s.pool.Submit(job) {
-		metrics.RecordWebhookReceived(payload.Repository, "queued")
-		w.WriteHeader(http.StatusAccepted)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"status":  "accepted",
-			"message": fmt.Sprintf("Job queued for %s PR #%d", payload.Repository, payload.PRNumber),
-		})
-		log.Info("Job queued",
-			"repository", payload.Repository,
-			"pr_number", payload.PRNumber,
-			"workflow", payload.WorkflowName,
-			"changed_files", len(payload.ChangedFiles),
-		)
-	} else {
-		metrics.RecordWebhookReceived(payload.Repository, "queue_full")
-		http.Error(w, "Queue full, try again later", http.StatusServiceUnavailable)
-		log.Warn("Queue full, job rejected",
-			"repository", payload.Repository,
-			"pr_number", payload.PRNumber,
-		)
+		KindOrder:            payload.KindOrder,
+		GroupByKind:          payload.GroupByKind,
+		NormalizeEmbedded:    normalizeEmbedded,
+		IncludeHooks:         payload.IncludeHooks,
+		RiskRules:            payload.RiskRules,
+		DebugMatching:        payload.DebugMatching,
 	}
 }
 
@@ -360,153 +532,215 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 	status := s.pool.Status()
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(map[string]any{
-		"status":       "ready",
-		"queue_length": status.QueueLength,
-		"queue_size":   status.QueueSize,
-		"active_jobs":  status.ActiveJobs,
-		"workers":      status.WorkerCount,
+		"status":               "ready",
+		"queue_length":         status.QueueLength,
+		"queue_size":           status.QueueSize,
+		"queued_by_repository": status.QueuedByRepository,
+		"active_jobs":          status.ActiveJobs,
+		"workers":              status.WorkerCount,
 	})
 }
 
 func (s *Server) processJob(ctx context.Context, job worker.Job) error {
-	jobLog := logging.WithFields(
-		"repository", job.Repository,
-		"pr_number", job.PRNumber,
-	)
+	_, err := s.runJob(ctx, job)
+	return err
+}
+
+// runJob diffs all applications affected by a job and posts the report as a
+// PR comment. The report is returned for the ?sync=true response.
+func (s *Server) runJob(ctx context.Context, job worker.Job) (*diff.DiffReport, error) {
+	ghClient, err := newGitHubClient(ctx, job)
+	if err != nil {
+		return nil, err
+	}
 
+	report, _, err := s.diffJob(ctx, job, ghClient)
+	return report, err
+}
+
+// newGitHubClient creates a GitHub client for the repository of a job
+func newGitHubClient(ctx context.Context, job worker.Job) (*github.Client, error) {
 	// Parse repository (owner/repo format)
 	parts := strings.Split(job.Repository, "/")
 	if len(parts) != 2 {
-		return fmt.Errorf("invalid repository format: %s", job.Repository)
+		return nil, fmt.Errorf("invalid repository format: %s", job.Repository)
 	}
 	owner, repo := parts[0], parts[1]
 
-	// Create GitHub client
 	ghClient, err := github.NewClient(ctx, job.GitHubToken, owner, repo)
 	if err != nil {
-		return fmt.Errorf("create github client: %w", err)
+		return nil, fmt.Errorf("create github client: %w", err)
 	}
+	return ghClient, nil
+}
+
+// changedFiles returns the files changed by a job: those sent in the
+// payload or, if none were sent, those GitHub lists for the PR. ghClient may
+// be nil, e.g. for dry runs, which then use a client for the job's token.
+func changedFiles(ctx context.Context, job worker.Job, ghClient *github.Client) ([]string, error) {
+	if len(job.ChangedFiles) > 0 {
+		return job.ChangedFiles, nil
+	}
+	if ghClient == nil {
+		var err error
+		if ghClient, err = newGitHubClient(ctx, job); err != nil {
+			return nil, err
+		}
+	}
+	worker.SetStage(ctx, "listing changed files")
+	files, err := ghClient.ListChangedFiles(ctx, job.PRNumber)
+	if err != nil {
+		return nil, fmt.Errorf("list changed files: %w", err)
+	}
+	return files, nil
+}
+
+// diffJob diffs all applications affected by a job and returns the report
+// and its markdown. The markdown and errors are posted as a PR comment
+// unless ghClient is nil, as for /diff dry runs.
+func (s *Server) diffJob(ctx context.Context, job worker.Job, ghClient *github.Client) (*diff.DiffReport, string, error) {
+	jobLog := logging.WithFields(
+		"repository", job.Repository,
+		"pr_number", job.PRNumber,
+	)
 
 	// Helper to post errors. Error text ends up in a public PR comment, so
-	// redact anything that looks like a credential.
-	postError := func(msg string) {
+	// redact anything that looks like a credential. Errors the worker pool
+	// will retry are not posted.
+	postError := func(msg string, err error) {
+		if ghClient == nil || worker.WillRetry(ctx, err) {
+			return
+		}
 		errorMsg := fmt.Sprintf("## ❌ Error\n\n%s", sanitize.String(msg))
 		_ = ghClient.PostComment(ctx, job.PRNumber, errorMsg, job.WorkflowName, 0)
 	}
 
+	// List the changed files on GitHub if the payload has none
+	files, err := changedFiles(ctx, job, ghClient)
+	if err != nil {
+		postError(fmt.Sprintf("Failed to list changed files: %v", err), err)
+		return nil, "", err
+	}
+	job.ChangedFiles = files
+
 	// Create ArgoCD client
+	worker.SetStage(ctx, "connecting to ArgoCD")
 	argoClient, err := argocd.NewClient(ctx, job.ArgocdServer, job.ArgocdToken, job.ArgocdPlainText)
 	if err != nil {
-		postError(fmt.Sprintf("Failed to connect to ArgoCD: %v", err))
-		return fmt.Errorf("create argocd client: %w", err)
+		postError(fmt.Sprintf("Failed to connect to ArgoCD: %v", err), err)
+		return nil, "", fmt.Errorf("create argocd client: %w", err)
 	}
 	defer func() { _ = argoClient.Close() }()
 
 	// List all ArgoCD applications
+	worker.SetStage(ctx, "listing applications")
 	apps, err := argoClient.ListApplications(ctx)
 	if err != nil {
-		postError(fmt.Sprintf("Failed to list ArgoCD applications: %v", err))
-		return fmt.Errorf("list applications: %w", err)
+		postError(fmt.Sprintf("Failed to list ArgoCD applications: %v", err), err)
+		return nil, "", fmt.Errorf("list applications: %w", err)
 	}
+	projects := listProjects(ctx, argoClient)
 
 	// Match affected applications
-	affectedApps := matcher.MatchApplications(apps, job.Repository, job.ChangedFiles, job.DestinationClusters)
+	worker.SetStage(ctx, "matching applications")
+	affectedApps := matcher.MatchApplications(apps, job.Repository, job.ChangedFiles, job.DestinationClusters, projects)
 
 	// Record how many applications were affected
 	metrics.RecordApplicationsAffected(job.Repository, len(affectedApps))
 
+	// Explain the matching below the report if requested
+	var matchDetails string
+	if job.DebugMatching {
+		matchDetails = diff.FormatMatchDetails(matcher.ExplainMatches(apps, job.Repository, job.ChangedFiles, job.DestinationClusters, projects))
+	}
+	appNames := make([]string, len(affectedApps))
+	for i, app := range affectedApps {
+		appNames[i] = app.Name
+	}
+	reportProgress(ctx, "apps_matched", map[string]any{"count": len(affectedApps), "apps": appNames})
+
 	if len(affectedApps) == 0 {
-		noChangesMsg := fmt.Sprintf("## ✅ No ArgoCD Applications Affected\n\nNo applications found matching repository `%s` and changed files.", job.Repository)
-		return ghClient.PostComment(ctx, job.PRNumber, noChangesMsg, job.WorkflowName, 0)
+		noChangesMsg := fmt.Sprintf("## ✅ No ArgoCD Applications Affected\n\nNo applications found matching repository `%s` and changed files.", job.Repository) + matchDetails
+		report := diff.NewDiffReportWithOptions(job.WorkflowName, nil, job.DedupeDiffs)
+		return report, noChangesMsg, postComment(ctx, ghClient, job, noChangesMsg, 0)
 	}
 
 	jobLog.Info("Found affected applications", "count", len(affectedApps))
 
-	// Generate diffs for each affected application
+	// Schema validators per destination cluster, built on first use
+	validators := map[string]*schema.Validator{}
+
+	// Generate diffs for each affected application. transientErr is the
+	// last transient error an app failed with, transientFailures the number
+	// of apps that did.
 	var diffResults []*diff.DiffResult
-	for _, app := range affectedApps {
+	var transientErr error
+	transientFailures := 0
+	for i, app := range affectedApps {
 		appName := app.Name
+		worker.SetStage(ctx, fmt.Sprintf("diffing %s (%d/%d)", appName, i+1, len(affectedApps)))
 		appInfo := diff.NewAppInfo(app, job.ArgocdURL) // ArgocdURL is optional, link only shown if provided
 
-		// Get manifests - handle multi-source apps
-		var baseManifests, headManifests []string
-
-		if argocd.IsMultiSource(app) {
-			// Multi-source app: create revisions for all sources
-			sourceCount := argocd.GetSourceCount(app)
-			baseRevisions := make([]argocd.MultiSourceRevision, sourceCount)
-			headRevisions := make([]argocd.MultiSourceRevision, sourceCount)
-
-			for i := range sourceCount {
-				baseRevisions[i] = argocd.MultiSourceRevision{
-					Revision:       job.BaseRef,
-					SourcePosition: i + 1, // 1-based
-				}
-				headRevisions[i] = argocd.MultiSourceRevision{
-					Revision:       job.HeadRef,
-					SourcePosition: i + 1,
-				}
-			}
-
-			baseManifests, err = argoClient.GetMultiSourceManifests(ctx, appName, baseRevisions)
-			if err != nil {
-				jobLog.Warn("Failed to get base manifests for multi-source app", "app", appName, "error", err)
-				metrics.RecordApplicationProcessed(job.Repository, appName, "error")
-				diffResults = append(diffResults, &diff.DiffResult{
-					AppInfo:      appInfo,
-					ErrorMessage: fmt.Sprintf("Failed to get base manifests: %v", sanitize.Error(err)),
-				})
-				continue
+		// failApp reports an app whose diff could not be generated
+		failApp := func(msg string, err error) {
+			if worker.IsTransient(err) {
+				transientErr = err
+				transientFailures++
 			}
+			metrics.RecordApplicationProcessed(job.Repository, appName, "error")
+			diffResults = append(diffResults, &diff.DiffResult{
+				AppInfo:      appInfo,
+				ErrorMessage: msg,
+			})
+			reportProgress(ctx, "app_failed", map[string]any{"app": appName, "error": msg})
+		}
 
-			headManifests, err = argoClient.GetMultiSourceManifests(ctx, appName, headRevisions)
-			if err != nil {
-				jobLog.Warn("Failed to get head manifests for multi-source app", "app", appName, "error", err)
-				metrics.RecordApplicationProcessed(job.Repository, appName, "error")
-				diffResults = append(diffResults, &diff.DiffResult{
-					AppInfo:      appInfo,
-					ErrorMessage: fmt.Sprintf("Failed to get head manifests: %v", sanitize.Error(err)),
-				})
-				continue
-			}
-		} else {
-			// Single-source app
-			baseManifests, err = argoClient.GetManifests(ctx, appName, job.BaseRef)
-			if err != nil {
-				jobLog.Warn("Failed to get base manifests", "app", appName, "error", err)
-				metrics.RecordApplicationProcessed(job.Repository, appName, "error")
-				diffResults = append(diffResults, &diff.DiffResult{
-					AppInfo:      appInfo,
-					ErrorMessage: fmt.Sprintf("Failed to get base manifests: %v", sanitize.Error(err)),
-				})
-				continue
-			}
+		// Get manifests - multi-source apps use the refs for every source
+		baseManifests, err := argoClient.GetAppManifests(ctx, app, job.BaseRef)
+		if err != nil {
+			jobLog.Warn("Failed to get base manifests", "app", appName, "error", err)
+			failApp(fmt.Sprintf("Failed to get base manifests: %v", sanitize.Error(err)), err)
+			continue
+		}
 
-			headManifests, err = argoClient.GetManifests(ctx, appName, job.HeadRef)
-			if err != nil {
-				jobLog.Warn("Failed to get head manifests", "app", appName, "error", err)
-				metrics.RecordApplicationProcessed(job.Repository, appName, "error")
-				diffResults = append(diffResults, &diff.DiffResult{
-					AppInfo:      appInfo,
-					ErrorMessage: fmt.Sprintf("Failed to get head manifests: %v", sanitize.Error(err)),
-				})
-				continue
-			}
+		headManifests, err := argoClient.GetAppManifests(ctx, app, job.HeadRef)
+		if err != nil {
+			jobLog.Warn("Failed to get head manifests", "app", appName, "error", err)
+			failApp(fmt.Sprintf("Failed to get head manifests: %v", sanitize.Error(err)), err)
+			continue
 		}
 
+		reportProgress(ctx, "manifests_fetched", map[string]any{"app": appName, "index": i + 1, "total": len(affectedApps)})
+
 		// Generate diff with options
 		diffOpts := &diff.DiffOptions{
 			IgnoreArgocdTracking: job.IgnoreArgocdTracking,
 			IgnoredMetadata:      job.IgnoredMetadata,
+			KindOrder:            job.KindOrder,
+			GroupByKind:          job.GroupByKind,
+			MaxDiffLines:         s.cfg.MaxDiffLines,
+			NormalizeEmbedded:    job.NormalizeEmbedded,
+			IncludeHooks:         job.IncludeHooks,
+			RiskRules:            job.RiskRules,
+			KubeVersion:          s.cfg.KubeVersionFor(appInfo.Cluster),
+		}
+		if s.policies != nil {
+			diffOpts.Policies = s.policies
+		}
+		if s.cfg.SchemaValidation {
+			v, ok := validators[appInfo.Cluster]
+			if !ok {
+				v = s.schemaValidator(ctx, argoClient, apps, appInfo.Cluster)
+				validators[appInfo.Cluster] = v
+			}
+			if v != nil {
+				diffOpts.Schema = v
+			}
 		}
 		result, err := diff.GenerateDiffWithOptions(baseManifests, headManifests, appInfo, diffOpts)
 		if err != nil {
 			jobLog.Warn("Failed to generate diff", "app", appName, "error", err)
-			metrics.RecordApplicationProcessed(job.Repository, appName, "error")
-			diffResults = append(diffResults, &diff.DiffResult{
-				AppInfo:      appInfo,
-				ErrorMessage: fmt.Sprintf("Failed to generate diff: %v", sanitize.Error(err)),
-			})
+			failApp(fmt.Sprintf("Failed to generate diff: %v", sanitize.Error(err)), err)
 			continue
 		}
 
@@ -518,16 +752,96 @@ func (s *Server) processJob(ctx context.Context, job worker.Job) error {
 		metrics.RecordResourceChanges(job.Repository, appName, "added", result.ResourcesAdded)
 		metrics.RecordResourceChanges(job.Repository, appName, "modified", result.ResourcesModified)
 		metrics.RecordResourceChanges(job.Repository, appName, "deleted", result.ResourcesDeleted)
+		for _, v := range result.Violations {
+			metrics.RecordPolicyViolation(job.Repository, v.Policy)
+		}
 
 		diffResults = append(diffResults, result)
+		reportProgress(ctx, "diff_generated", map[string]any{
+			"app":         appName,
+			"has_changes": result.HasChanges,
+			"added":       result.ResourcesAdded,
+			"modified":    result.ResourcesModified,
+			"deleted":     result.ResourcesDeleted,
+		})
+	}
+
+	// If every app failed transiently, e.g. because the repo server is
+	// overloaded, fail the job so the pool retries it (or dead-letters it
+	// once out of retries) instead of posting a report of errors
+	if transientFailures == len(affectedApps) {
+		postError(fmt.Sprintf("Failed to get manifests of all %d applications: %v", len(affectedApps), transientErr), transientErr)
+		return nil, "", fmt.Errorf("get manifests: %w", transientErr)
 	}
 
+	// Flag resources that several apps would fight over after merge
+	var unaffected []*appv1.Application
+	for _, app := range apps {
+		if !slices.Contains(affectedApps, app) {
+			unaffected = append(unaffected, app)
+		}
+	}
+	diff.DetectOwnershipConflicts(diffResults, diff.ManagedResources(unaffected))
+
 	// Create and format the report (with deduplication based on job settings)
 	report := diff.NewDiffReportWithOptions(job.WorkflowName, diffResults, job.DedupeDiffs)
-	finalComment := diff.FormatReport(report)
+	finalComment := diff.FormatReport(report) + matchDetails
 
 	// Post comment to GitHub
-	return ghClient.PostComment(ctx, job.PRNumber, finalComment, job.WorkflowName, job.CollapseThreshold)
+	return report, finalComment, postComment(ctx, ghClient, job, finalComment, job.CollapseThreshold)
+}
+
+// postComment posts the report of a job as a PR comment, unless ghClient is
+// nil
+func postComment(ctx context.Context, ghClient *github.Client, job worker.Job, body string, collapseThreshold int) error {
+	if ghClient == nil {
+		return nil
+	}
+	worker.SetStage(ctx, "posting comment")
+	if err := ghClient.PostComment(ctx, job.PRNumber, body, job.WorkflowName, collapseThreshold); err != nil {
+		return err
+	}
+	reportProgress(ctx, "comment_posted", map[string]any{"pr_number": job.PRNumber})
+	return nil
+}
+
+// schemaValidator returns the schema validator for the target Kubernetes
+// version of a destination cluster. With SCHEMA_CRDS it also validates the
+// custom resources of the CRDs that ArgoCD manages on the cluster. Errors
+// are logged, since validation is best effort.
+func (s *Server) schemaValidator(ctx context.Context, argoClient *argocd.Client, apps []*appv1.Application, cluster string) *schema.Validator {
+	v, err := schema.Load(s.cfg.KubeVersionFor(cluster))
+	if err != nil {
+		logging.Warn("Failed to load schemas", "cluster", cluster, "error", err)
+		return nil
+	}
+	if !s.cfg.SchemaCRDs {
+		return v
+	}
+
+	var crds []map[string]any
+	for _, app := range apps {
+		if diff.NewAppInfo(app, "").Cluster != cluster {
+			continue
+		}
+		for _, res := range app.Status.Resources {
+			if res.Group != "apiextensions.k8s.io" || res.Kind != "CustomResourceDefinition" {
+				continue
+			}
+			manifest, err := argoClient.GetResource(ctx, app, res)
+			if err != nil {
+				logging.Warn("Failed to get CRD", "app", app.Name, "crd", res.Name, "error", err)
+				continue
+			}
+			var crd map[string]any
+			if err := json.Unmarshal([]byte(manifest), &crd); err != nil {
+				logging.Warn("Failed to parse CRD", "app", app.Name, "crd", res.Name, "error", err)
+				continue
+			}
+			crds = append(crds, crd)
+		}
+	}
+	return v.WithCRDs(crds)
 }
 
 // Validation constants
@@ -544,6 +858,11 @@ func validatePayload(p *WebhookPayload) error {
 	if p.GitHubToken == "" {
 		return fmt.Errorf("github_token is required")
 	}
+	return validateJobPayload(p)
+}
+
+// validateJobPayload checks the payload fields shared by /webhook and /diff
+func validateJobPayload(p *WebhookPayload) error {
 	if p.ArgocdToken == "" {
 		return fmt.Errorf("argocd_token is required")
 	}
@@ -574,11 +893,11 @@ func validatePayload(p *WebhookPayload) error {
 	if len(p.HeadRef) > maxRefLength {
 		return fmt.Errorf("head_ref exceeds maximum length of %d", maxRefLength)
 	}
-	if len(p.ChangedFiles) == 0 {
-		return fmt.Errorf("changed_files cannot be empty")
+	if len(p.ChangedFiles) == 0 && p.GitHubToken == "" {
+		return fmt.Errorf("github_token is required to list the changed files if changed_files is omitted")
 	}
 	if len(p.ChangedFiles) > maxChangedFiles {
-		return fmt.Errorf("changed_files exceeds maximum of %d files", maxChangedFiles)
+		return fmt.Errorf("changed_files exceeds maximum of %d files, omit it to list the changed files on GitHub", maxChangedFiles)
 	}
 	for _, file := range p.ChangedFiles {
 		if len(file) > maxFilePathLength {
@@ -591,6 +910,11 @@ func validatePayload(p *WebhookPayload) error {
 	if !isValidWorkflowName(p.WorkflowName) {
 		return fmt.Errorf("workflow_name may only contain alphanumerics, spaces, dots, dashes and underscores")
 	}
+	for _, rule := range p.RiskRules {
+		if !slices.Contains(diff.RiskRules, rule) {
+			return fmt.Errorf("unknown risk rule %q", rule)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/tamcore/argo-diff/pkg/argocd"
+	"github.com/tamcore/argo-diff/pkg/logging"
+	"github.com/tamcore/argo-diff/pkg/matcher"
+	"github.com/tamcore/argo-diff/pkg/metrics"
+)
+
+// matchedApp is an application in the /match response
+type matchedApp struct {
+	Name           string   `json:"name"`
+	Namespace      string   `json:"namespace,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	Cluster        string   `json:"cluster,omitempty"`
+	Matched        bool     `json:"matched"`
+	MatchReason    string   `json:"match_reason,omitempty"`
+	MatchedPaths   []string `json:"matched_paths,omitempty"`
+	ExcludedReason string   `json:"excluded_reason,omitempty"`
+	NearMiss       bool     `json:"near_miss,omitempty"`
+	RepoURLs       []string `json:"repo_urls"`
+	SourcePaths    []string `json:"source_paths,omitempty"` // paths of the sources tracking the repository
+}
+
+// handleMatch explains which applications a change affects without diffing
+// them: for every application the token can see, whether it was matched,
+// with the matched paths and reason, or why it was excluded. It takes the
+// same OIDC token and payload as /diff and shares its rate limit.
+func (s *Server) handleMatch(w http.ResponseWriter, r *http.Request) {
+	requestID := uuid.New().String()
+	ctx := logging.WithRequestID(r.Context(), requestID)
+	log := logging.FromContext(ctx)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	repo, ok := s.authenticate(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !s.allow(w, s.diffLimiter, repo, log) {
+		return
+	}
+	payload, ok := decodePayload(w, r, repo, validateJobPayload, log)
+	if !ok {
+		return
+	}
+	job := s.newJob(payload)
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.JobTimeout)
+	defer cancel()
+
+	files, err := changedFiles(ctx, job, nil)
+	if err != nil {
+		log.Error("Failed to list changed files", "repository", job.Repository, "error", err)
+		metrics.RecordWebhookReceived(job.Repository, "match_failed")
+		http.Error(w, fmt.Sprintf("Failed to list changed files: %v", err), http.StatusBadGateway)
+		return
+	}
+	job.ChangedFiles = files
+
+	argoClient, err := argocd.NewClient(ctx, job.ArgocdServer, job.ArgocdToken, job.ArgocdPlainText)
+	if err != nil {
+		log.Error("Failed to connect to ArgoCD", "repository", job.Repository, "error", err)
+		metrics.RecordWebhookReceived(job.Repository, "match_failed")
+		http.Error(w, fmt.Sprintf("Failed to connect to ArgoCD: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = argoClient.Close() }()
+
+	apps, err := argoClient.ListApplications(ctx)
+	if err != nil {
+		log.Error("Failed to list ArgoCD applications", "repository", job.Repository, "error", err)
+		metrics.RecordWebhookReceived(job.Repository, "match_failed")
+		http.Error(w, fmt.Sprintf("Failed to list ArgoCD applications: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	projects := listProjects(ctx, argoClient)
+	explanations := matcher.ExplainMatches(apps, job.Repository, job.ChangedFiles, job.DestinationClusters, projects)
+	out := make([]matchedApp, 0, len(explanations))
+	matched, nearMisses := 0, 0
+	for _, e := range explanations {
+		if e.Matched() {
+			matched++
+		} else if e.NearMiss() {
+			nearMisses++
+		}
+		out = append(out, matchedApp{
+			Name:           e.App.Name,
+			Namespace:      e.App.Namespace,
+			Project:        e.App.Spec.Project,
+			Cluster:        e.Cluster,
+			Matched:        e.Matched(),
+			MatchReason:    e.MatchReason,
+			MatchedPaths:   e.MatchedPaths,
+			ExcludedReason: e.ExcludedReason,
+			NearMiss:       e.NearMiss(),
+			RepoURLs:       e.RepoURLs,
+			SourcePaths:    e.SourcePaths,
+		})
+	}
+
+	metrics.RecordWebhookReceived(job.Repository, "match_completed")
+	log.Info("Match completed",
+		"repository", job.Repository,
+		"pr_number", job.PRNumber,
+		"apps", len(apps),
+		"matched", matched,
+		"near_misses", nearMisses,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"repository":    job.Repository,
+		"changed_files": len(job.ChangedFiles),
+		"total_apps":    len(apps),
+		"matched":       matched,
+		"near_misses":   nearMisses,
+		"apps":          out,
+	})
+}
+
+// listProjects returns the ArgoCD projects the token may see. Without them,
+// apps are matched regardless of their project's source repositories.
+func listProjects(ctx context.Context, argoClient *argocd.Client) matcher.Projects {
+	projects, err := argoClient.ListProjects(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to list ArgoCD projects, not checking their source repositories", "error", err)
+		return nil
+	}
+	return projects
+}
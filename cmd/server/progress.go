@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress stream formats for synchronous jobs, see streamFormat
+const (
+	streamSSE    = "sse"
+	streamNDJSON = "ndjson"
+)
+
+// progressHeartbeat is how often an idle progress stream gets a heartbeat,
+// so proxies do not close the connection while a slow app is diffed
+const progressHeartbeat = 15 * time.Second
+
+// streamFormat returns the progress stream format requested by the ?stream
+// query parameter or, failing that, the Accept header. Returns "" if no
+// stream was requested.
+func streamFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("stream"); format {
+	case streamSSE, streamNDJSON:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("stream must be %s or %s, got %q", streamSSE, streamNDJSON, format)
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/event-stream"):
+		return streamSSE, nil
+	case strings.Contains(accept, "application/x-ndjson"):
+		return streamNDJSON, nil
+	}
+	return "", nil
+}
+
+// progressStream writes progress events of a synchronous job as Server-Sent
+// Events or newline-delimited JSON, flushing each one
+type progressStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	format  string
+	timeout time.Duration // write deadline, extended with each event
+	stop    chan struct{}
+	closed  bool // the handler returned, so w must no longer be written
+}
+
+// newProgressStream sends the response headers and starts sending
+// heartbeats. The stream must be closed.
+func newProgressStream(w http.ResponseWriter, format string, timeout time.Duration) *progressStream {
+	s := &progressStream{
+		w:       w,
+		rc:      http.NewResponseController(w),
+		format:  format,
+		timeout: timeout,
+		stop:    make(chan struct{}),
+	}
+
+	if format == streamSSE {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+	s.flush()
+
+	go s.heartbeat()
+	return s
+}
+
+func (s *progressStream) heartbeat() {
+	ticker := time.NewTicker(progressHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		if s.format == streamSSE {
+			_, _ = fmt.Fprint(s.w, ": heartbeat\n\n")
+		} else {
+			_, _ = fmt.Fprintln(s.w, `{"event":"heartbeat"}`)
+		}
+		s.flush()
+		s.mu.Unlock()
+	}
+}
+
+// send writes an event. With NDJSON the event name is added to the data as
+// "event". Does nothing once the stream is closed, e.g. for a job still
+// reporting progress after its request timed out.
+func (s *progressStream) send(event string, data map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	if s.format == streamSSE {
+		payload, _ := json.Marshal(data)
+		_, _ = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	} else {
+		line := maps.Clone(data)
+		if line == nil {
+			line = map[string]any{}
+		}
+		line["event"] = event
+		payload, _ := json.Marshal(line)
+		_, _ = fmt.Fprintf(s.w, "%s\n", payload)
+	}
+	s.flush()
+}
+
+// flush sends buffered output and extends the write deadline, since the
+// server's WriteTimeout would otherwise end a long stream
+func (s *progressStream) flush() {
+	_ = s.rc.SetWriteDeadline(time.Now().Add(s.timeout))
+	_ = s.rc.Flush()
+}
+
+// close stops the heartbeats and further events. It waits for a write in
+// progress, so the response is not written after the handler returned.
+func (s *progressStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+}
+
+type progressKey struct{}
+
+// withProgress returns a context whose job reports its progress to stream
+func withProgress(ctx context.Context, stream *progressStream) context.Context {
+	return context.WithValue(ctx, progressKey{}, stream)
+}
+
+// reportProgress sends a progress event if the job of ctx is streamed
+func reportProgress(ctx context.Context, event string, data map[string]any) {
+	if stream, ok := ctx.Value(progressKey{}).(*progressStream); ok {
+		stream.send(event, data)
+	}
+}
@@ -2,21 +2,25 @@ package argocd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
 
 	"github.com/argoproj/argo-cd/v3/pkg/apiclient"
 	"github.com/argoproj/argo-cd/v3/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v3/pkg/apiclient/project"
 	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	"github.com/tamcore/argo-diff/pkg/metrics"
 )
 
 // Client wraps the ArgoCD API client
 type Client struct {
-	appClient application.ApplicationServiceClient
-	conn      io.Closer
-	server    string
+	appClient  application.ApplicationServiceClient
+	projClient project.ProjectServiceClient
+	conn       io.Closer
+	projConn   io.Closer
+	server     string
 }
 
 // NewClient creates a new ArgoCD client
@@ -38,10 +42,18 @@ func NewClient(ctx context.Context, server, token string, plainText bool) (*Clie
 		return nil, fmt.Errorf("failed to create ArgoCD application client: %w", err)
 	}
 
+	projConn, projClient, err := clientset.NewProjectClient()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to create ArgoCD project client: %w", err)
+	}
+
 	return &Client{
-		appClient: appClient,
-		conn:      conn,
-		server:    server,
+		appClient:  appClient,
+		projClient: projClient,
+		conn:       conn,
+		projConn:   projConn,
+		server:     server,
 	}, nil
 }
 
@@ -50,12 +62,15 @@ func (c *Client) Server() string {
 	return c.server
 }
 
-// Close closes the connection to ArgoCD
+// Close closes the connections to ArgoCD
 func (c *Client) Close() error {
-	if c.conn != nil {
-		return c.conn.Close()
+	var errs []error
+	for _, conn := range []io.Closer{c.conn, c.projConn} {
+		if conn != nil {
+			errs = append(errs, conn.Close())
+		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // ListApplications lists all applications in ArgoCD
@@ -77,6 +92,24 @@ func (c *Client) ListApplications(ctx context.Context) ([]*appv1.Application, er
 	return apps, err
 }
 
+// ListProjects lists the projects the token may see, by name
+func (c *Client) ListProjects(ctx context.Context) (map[string]*appv1.AppProject, error) {
+	var projects map[string]*appv1.AppProject
+	err := retry(ctx, 3, func() error {
+		list, err := c.projClient.List(ctx, &project.ProjectQuery{})
+		if err != nil {
+			return fmt.Errorf("failed to list projects: %w", err)
+		}
+		projects = make(map[string]*appv1.AppProject, len(list.Items))
+		for i := range list.Items {
+			projects[list.Items[i].Name] = &list.Items[i]
+		}
+		return nil
+	})
+	metrics.RecordArgocdCall("projects", err)
+	return projects, err
+}
+
 // GetManifests fetches the manifests for a specific application and revision
 func (c *Client) GetManifests(ctx context.Context, appName, revision string) ([]string, error) {
 	var manifests []string
@@ -96,6 +129,31 @@ func (c *Client) GetManifests(ctx context.Context, appName, revision string) ([]
 	return manifests, err
 }
 
+// GetResource fetches the live manifest (as JSON) of a resource managed by
+// an application
+func (c *Client) GetResource(ctx context.Context, app *appv1.Application, res appv1.ResourceStatus) (string, error) {
+	var manifest string
+	err := retry(ctx, 3, func() error {
+		query := &application.ApplicationResourceRequest{
+			Name:         &app.Name,
+			AppNamespace: &app.Namespace,
+			Namespace:    &res.Namespace,
+			ResourceName: &res.Name,
+			Group:        &res.Group,
+			Version:      &res.Version,
+			Kind:         &res.Kind,
+		}
+		resp, err := c.appClient.GetResource(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to get %s %s of app %s: %w", res.Kind, res.Name, app.Name, err)
+		}
+		manifest = resp.GetManifest()
+		return nil
+	})
+	metrics.RecordArgocdCall("resource", err)
+	return manifest, err
+}
+
 // MultiSourceRevision represents a revision for a specific source in a multi-source app
 type MultiSourceRevision struct {
 	Revision       string
@@ -133,6 +191,23 @@ func (c *Client) GetMultiSourceManifests(ctx context.Context, appName string, re
 	return manifests, err
 }
 
+// GetAppManifests fetches the manifests of an application at a revision,
+// using the revision for every source of a multi-source application
+func (c *Client) GetAppManifests(ctx context.Context, app *appv1.Application, revision string) ([]string, error) {
+	if !IsMultiSource(app) {
+		return c.GetManifests(ctx, app.Name, revision)
+	}
+
+	revisions := make([]MultiSourceRevision, GetSourceCount(app))
+	for i := range revisions {
+		revisions[i] = MultiSourceRevision{
+			Revision:       revision,
+			SourcePosition: i + 1, // 1-based
+		}
+	}
+	return c.GetMultiSourceManifests(ctx, app.Name, revisions)
+}
+
 // IsMultiSource returns true if the application has multiple sources
 func IsMultiSource(app *appv1.Application) bool {
 	return len(app.Spec.Sources) > 0
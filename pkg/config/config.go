@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/tamcore/argo-diff/pkg/kubeversion"
 )
 
 // Config holds the application configuration
@@ -13,10 +15,23 @@ type Config struct {
 	// Server configuration
 	Port        int
 	MetricsPort int
+	// Admin API to inspect and control the job queue, enabled if AdminToken
+	// is set. Requests must send it as a bearer token.
+	AdminPort  int
+	AdminToken string
 
 	// Worker configuration
 	WorkerCount int
 	QueueSize   int
+	// Jobs a repository may dequeue per turn when several repositories have
+	// queued jobs; "*" applies to all others, the default weight is 1
+	RepoWeights map[string]int
+	// Queue shared by all replicas: "memory" (per replica) or "redis"
+	QueueBackend string
+	RedisURL     string        // redis://[user:password@]host:port[/db], for the redis backend
+	RedisPrefix  string        // namespaces the keys, so deployments can share a Redis
+	RedisKey     string        // encrypts the tokens of queued jobs, the same on all replicas
+	QueueLease   time.Duration // lease of a running job, renewed while it runs
 
 	// Security configuration
 	RepoAllowlist []string
@@ -25,10 +40,25 @@ type Config struct {
 	LogLevel string
 
 	// Rate limiting configuration
-	RateLimitPerRepo int // requests per minute per repository (0 = disabled)
+	RateLimitPerRepo     int // requests per minute per repository (0 = disabled)
+	DiffRateLimitPerRepo int // /diff dry-run requests per minute per repository (0 = disabled)
 
 	// Job processing configuration
-	JobTimeout time.Duration // maximum duration for a single diff job
+	JobTimeout      time.Duration // maximum duration for a single diff job
+	JobRetries      int           // retries of jobs failing with a transient error
+	JobRetryBackoff time.Duration // delay before the first retry, doubled for each further one
+
+	// Diff configuration
+	MaxDiffLines int    // diffs of a resource are cut off after this many lines (0 = no limit)
+	PolicyFile   string // optional YAML file with CEL policies evaluated against head resources
+	// Target Kubernetes version per destination cluster (name, or server URL
+	// if unnamed) for API deprecation warnings; "*" applies to all others
+	KubeVersions map[string]string
+	// Validate added and modified resources against the OpenAPI schemas of
+	// the target Kubernetes version, and optionally against the CRDs that
+	// ArgoCD manages on the destination cluster
+	SchemaValidation bool
+	SchemaCRDs       bool
 
 	// ArgoCD configuration
 	ArgocdServer    string
@@ -45,6 +75,10 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	adminPort, err := getEnvInt("ADMIN_PORT", 8081)
+	if err != nil {
+		return nil, err
+	}
 	workerCount, err := getEnvInt("WORKER_COUNT", 1)
 	if err != nil {
 		return nil, err
@@ -57,6 +91,10 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	diffRateLimitPerRepo, err := getEnvInt("DIFF_RATE_LIMIT_PER_REPO", 10)
+	if err != nil {
+		return nil, err
+	}
 	argocdPlainText, err := getEnvBool("ARGOCD_PLAINTEXT", true)
 	if err != nil {
 		return nil, err
@@ -65,17 +103,66 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	jobRetries, err := getEnvInt("JOB_RETRIES", 3)
+	if err != nil {
+		return nil, err
+	}
+	jobRetryBackoff, err := getEnvDuration("JOB_RETRY_BACKOFF", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	queueLease, err := getEnvDuration("QUEUE_LEASE", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	maxDiffLines, err := getEnvInt("MAX_DIFF_LINES", 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaValidation, err := getEnvBool("SCHEMA_VALIDATION", false)
+	if err != nil {
+		return nil, err
+	}
+	schemaCRDs, err := getEnvBool("SCHEMA_CRDS", false)
+	if err != nil {
+		return nil, err
+	}
+	kubeVersions, err := parseKubeVersions(os.Getenv("KUBE_VERSIONS"))
+	if err != nil {
+		return nil, err
+	}
+	repoWeights, err := parseRepoWeights(os.Getenv("REPO_WEIGHTS"))
+	if err != nil {
+		return nil, err
+	}
 
 	cfg := &Config{
-		Port:             port,
-		MetricsPort:      metricsPort,
-		WorkerCount:      workerCount,
-		QueueSize:        queueSize,
-		LogLevel:         getEnvString("LOG_LEVEL", "info"),
-		RateLimitPerRepo: rateLimitPerRepo,
-		JobTimeout:       jobTimeout,
-		ArgocdServer:     getEnvString("ARGOCD_SERVER", "argocd-server:80"),
-		ArgocdPlainText:  argocdPlainText,
+		Port:                 port,
+		MetricsPort:          metricsPort,
+		AdminPort:            adminPort,
+		AdminToken:           os.Getenv("ADMIN_TOKEN"),
+		WorkerCount:          workerCount,
+		QueueSize:            queueSize,
+		RepoWeights:          repoWeights,
+		QueueBackend:         getEnvString("QUEUE_BACKEND", "memory"),
+		RedisURL:             os.Getenv("REDIS_URL"),
+		RedisPrefix:          getEnvString("REDIS_PREFIX", "argo-diff"),
+		RedisKey:             os.Getenv("REDIS_ENCRYPTION_KEY"),
+		QueueLease:           queueLease,
+		LogLevel:             getEnvString("LOG_LEVEL", "info"),
+		RateLimitPerRepo:     rateLimitPerRepo,
+		DiffRateLimitPerRepo: diffRateLimitPerRepo,
+		JobTimeout:           jobTimeout,
+		JobRetries:           jobRetries,
+		JobRetryBackoff:      jobRetryBackoff,
+		MaxDiffLines:         maxDiffLines,
+		PolicyFile:           getEnvString("POLICY_FILE", ""),
+		KubeVersions:         kubeVersions,
+		SchemaValidation:     schemaValidation,
+		SchemaCRDs:           schemaCRDs,
+		ArgocdServer:         getEnvString("ARGOCD_SERVER", "argocd-server:80"),
+		ArgocdPlainText:      argocdPlainText,
 	}
 
 	if err := validate(cfg); err != nil {
@@ -109,18 +196,57 @@ func validate(cfg *Config) error {
 	if cfg.MetricsPort < 1 || cfg.MetricsPort > 65535 {
 		return fmt.Errorf("METRICS_PORT must be between 1 and 65535, got %d", cfg.MetricsPort)
 	}
+	if cfg.AdminPort < 1 || cfg.AdminPort > 65535 {
+		return fmt.Errorf("ADMIN_PORT must be between 1 and 65535, got %d", cfg.AdminPort)
+	}
+	if cfg.AdminToken != "" && (cfg.AdminPort == cfg.Port || cfg.AdminPort == cfg.MetricsPort) {
+		return fmt.Errorf("ADMIN_PORT must differ from PORT and METRICS_PORT, got %d", cfg.AdminPort)
+	}
 	if cfg.WorkerCount < 1 {
 		return fmt.Errorf("WORKER_COUNT must be at least 1, got %d", cfg.WorkerCount)
 	}
 	if cfg.QueueSize < 1 {
 		return fmt.Errorf("QUEUE_SIZE must be at least 1, got %d", cfg.QueueSize)
 	}
+	switch cfg.QueueBackend {
+	case "memory":
+	case "redis":
+		if cfg.RedisURL == "" {
+			return fmt.Errorf("REDIS_URL is required for QUEUE_BACKEND=redis")
+		}
+		if cfg.RedisKey == "" {
+			return fmt.Errorf("REDIS_ENCRYPTION_KEY is required for QUEUE_BACKEND=redis")
+		}
+		if cfg.RedisPrefix == "" {
+			return fmt.Errorf("REDIS_PREFIX must not be empty")
+		}
+	default:
+		return fmt.Errorf("QUEUE_BACKEND must be memory or redis, got %q", cfg.QueueBackend)
+	}
+	if cfg.QueueLease <= 0 {
+		return fmt.Errorf("QUEUE_LEASE must be positive, got %s", cfg.QueueLease)
+	}
 	if cfg.RateLimitPerRepo < 0 {
 		return fmt.Errorf("RATE_LIMIT_PER_REPO must not be negative, got %d", cfg.RateLimitPerRepo)
 	}
+	if cfg.DiffRateLimitPerRepo < 0 {
+		return fmt.Errorf("DIFF_RATE_LIMIT_PER_REPO must not be negative, got %d", cfg.DiffRateLimitPerRepo)
+	}
 	if cfg.JobTimeout <= 0 {
 		return fmt.Errorf("JOB_TIMEOUT must be positive, got %s", cfg.JobTimeout)
 	}
+	if cfg.JobRetries < 0 {
+		return fmt.Errorf("JOB_RETRIES must not be negative, got %d", cfg.JobRetries)
+	}
+	if cfg.JobRetryBackoff <= 0 {
+		return fmt.Errorf("JOB_RETRY_BACKOFF must be positive, got %s", cfg.JobRetryBackoff)
+	}
+	if cfg.MaxDiffLines < 0 {
+		return fmt.Errorf("MAX_DIFF_LINES must not be negative, got %d", cfg.MaxDiffLines)
+	}
+	if cfg.SchemaCRDs && !cfg.SchemaValidation {
+		return fmt.Errorf("SCHEMA_CRDS requires SCHEMA_VALIDATION")
+	}
 	return nil
 }
 
@@ -137,6 +263,15 @@ func (c *Config) IsRepoAllowed(repo string) bool {
 	return false
 }
 
+// KubeVersionFor returns the target Kubernetes version of a destination
+// cluster, falling back to the "*" entry. Returns "" if neither is set.
+func (c *Config) KubeVersionFor(cluster string) string {
+	if v, ok := c.KubeVersions[cluster]; ok {
+		return v
+	}
+	return c.KubeVersions["*"]
+}
+
 // matchPattern checks if a repository matches a pattern
 // Supports exact matches (owner/repo) and wildcards (owner/*)
 func matchPattern(pattern, repo string) bool {
@@ -177,6 +312,51 @@ func parseAllowlist(allowlistStr string) []string {
 	return result
 }
 
+// parseKubeVersions parses comma-separated cluster=version pairs, e.g.
+// "prod=1.29,*=1.31"
+func parseKubeVersions(s string) (map[string]string, error) {
+	versions := map[string]string{}
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		cluster, version, ok := strings.Cut(part, "=")
+		cluster, version = strings.TrimSpace(cluster), strings.TrimSpace(version)
+		if !ok || cluster == "" {
+			return nil, fmt.Errorf("KUBE_VERSIONS entries must be cluster=version, got %q", part)
+		}
+		if _, _, ok := kubeversion.Parse(version); !ok {
+			return nil, fmt.Errorf("KUBE_VERSIONS: invalid Kubernetes version %q for cluster %q", version, cluster)
+		}
+		versions[cluster] = version
+	}
+	return versions, nil
+}
+
+// parseRepoWeights parses comma-separated repository=weight pairs, e.g.
+// "myorg/monorepo=1,myorg/platform=3,*=2"
+func parseRepoWeights(s string) (map[string]int, error) {
+	weights := map[string]int{}
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		repo, weight, ok := strings.Cut(part, "=")
+		repo, weight = strings.ToLower(strings.TrimSpace(repo)), strings.TrimSpace(weight)
+		if !ok || repo == "" {
+			return nil, fmt.Errorf("REPO_WEIGHTS entries must be repository=weight, got %q", part)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("REPO_WEIGHTS: weight for %q must be a positive integer, got %q", repo, weight)
+		}
+		weights[repo] = w
+	}
+	return weights, nil
+}
+
 // getEnvInt reads an integer from environment variable with a default value.
 // Returns an error if the variable is set but not a valid integer.
 func getEnvInt(key string, defaultValue int) (int, error) {
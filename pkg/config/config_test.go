@@ -1,6 +1,7 @@
 package config
 
 import (
+	"maps"
 	"os"
 	"testing"
 	"time"
@@ -30,12 +31,42 @@ func TestLoad(t *testing.T) {
 				if cfg.MetricsPort != 9090 {
 					t.Errorf("MetricsPort = %d, want 9090", cfg.MetricsPort)
 				}
+				if cfg.AdminPort != 8081 || cfg.AdminToken != "" {
+					t.Errorf("AdminPort = %d, AdminToken = %q, want 8081, empty", cfg.AdminPort, cfg.AdminToken)
+				}
 				if cfg.WorkerCount != 1 {
 					t.Errorf("WorkerCount = %d, want 1", cfg.WorkerCount)
 				}
 				if cfg.QueueSize != 100 {
 					t.Errorf("QueueSize = %d, want 100", cfg.QueueSize)
 				}
+				if cfg.RateLimitPerRepo != 10 || cfg.DiffRateLimitPerRepo != 10 {
+					t.Errorf("RateLimitPerRepo = %d, DiffRateLimitPerRepo = %d, want 10", cfg.RateLimitPerRepo, cfg.DiffRateLimitPerRepo)
+				}
+				if cfg.JobRetries != 3 {
+					t.Errorf("JobRetries = %d, want 3", cfg.JobRetries)
+				}
+				if cfg.JobRetryBackoff != 30*time.Second {
+					t.Errorf("JobRetryBackoff = %s, want 30s", cfg.JobRetryBackoff)
+				}
+				if cfg.QueueBackend != "memory" || cfg.QueueLease != 30*time.Second {
+					t.Errorf("QueueBackend = %q, QueueLease = %s, want memory, 30s", cfg.QueueBackend, cfg.QueueLease)
+				}
+				if len(cfg.RepoWeights) != 0 {
+					t.Errorf("RepoWeights = %v, want empty", cfg.RepoWeights)
+				}
+				if cfg.MaxDiffLines != 10000 {
+					t.Errorf("MaxDiffLines = %d, want 10000", cfg.MaxDiffLines)
+				}
+				if cfg.PolicyFile != "" {
+					t.Errorf("PolicyFile = %q, want empty", cfg.PolicyFile)
+				}
+				if len(cfg.KubeVersions) != 0 {
+					t.Errorf("KubeVersions = %v, want empty", cfg.KubeVersions)
+				}
+				if cfg.SchemaValidation || cfg.SchemaCRDs {
+					t.Errorf("SchemaValidation = %v, SchemaCRDs = %v, want false", cfg.SchemaValidation, cfg.SchemaCRDs)
+				}
 			},
 		},
 		{
@@ -113,6 +144,14 @@ func TestLoad(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "negative diff rate limit",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST":           "owner/repo",
+				"DIFF_RATE_LIMIT_PER_REPO": "-1",
+			},
+			wantErr: true,
+		},
 		{
 			name: "custom job timeout",
 			envVars: map[string]string{
@@ -142,6 +181,223 @@ func TestLoad(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "negative max diff lines",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"MAX_DIFF_LINES": "-1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "kube versions",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"KUBE_VERSIONS":  "prod=1.29, https://kubernetes.default.svc=v1.31.2,*=1.30",
+			},
+			wantErr: false,
+			checkConfig: func(t *testing.T, cfg *Config) {
+				for cluster, want := range map[string]string{
+					"prod":                           "1.29",
+					"https://kubernetes.default.svc": "v1.31.2",
+					"staging":                        "1.30",
+				} {
+					if got := cfg.KubeVersionFor(cluster); got != want {
+						t.Errorf("KubeVersionFor(%q) = %q, want %q", cluster, got, want)
+					}
+				}
+			},
+		},
+		{
+			name: "invalid kube version",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"KUBE_VERSIONS":  "prod=latest",
+			},
+			wantErr: true,
+		},
+		{
+			name: "kube version without cluster",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"KUBE_VERSIONS":  "1.29",
+			},
+			wantErr: true,
+		},
+		{
+			name: "retries disabled",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST":    "owner/repo",
+				"JOB_RETRIES":       "0",
+				"JOB_RETRY_BACKOFF": "5s",
+			},
+			wantErr: false,
+			checkConfig: func(t *testing.T, cfg *Config) {
+				if cfg.JobRetries != 0 || cfg.JobRetryBackoff != 5*time.Second {
+					t.Errorf("JobRetries = %d, JobRetryBackoff = %s, want 0, 5s", cfg.JobRetries, cfg.JobRetryBackoff)
+				}
+			},
+		},
+		{
+			name: "negative job retries",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"JOB_RETRIES":    "-1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero retry backoff",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST":    "owner/repo",
+				"JOB_RETRY_BACKOFF": "0s",
+			},
+			wantErr: true,
+		},
+		{
+			name: "admin api",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"ADMIN_PORT":     "9100",
+				"ADMIN_TOKEN":    "s3cret",
+			},
+			wantErr: false,
+			checkConfig: func(t *testing.T, cfg *Config) {
+				if cfg.AdminPort != 9100 || cfg.AdminToken != "s3cret" {
+					t.Errorf("AdminPort = %d, AdminToken = %q", cfg.AdminPort, cfg.AdminToken)
+				}
+			},
+		},
+		{
+			name: "admin port same as metrics port",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"ADMIN_PORT":     "9090",
+				"ADMIN_TOKEN":    "s3cret",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid admin port",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"ADMIN_PORT":     "0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "redis queue",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST":       "owner/repo",
+				"QUEUE_BACKEND":        "redis",
+				"REDIS_URL":            "redis://redis:6379/0",
+				"REDIS_ENCRYPTION_KEY": "secret",
+				"QUEUE_LEASE":          "1m",
+			},
+			wantErr: false,
+			checkConfig: func(t *testing.T, cfg *Config) {
+				if cfg.QueueBackend != "redis" || cfg.RedisURL != "redis://redis:6379/0" || cfg.QueueLease != time.Minute {
+					t.Errorf("QueueBackend = %q, RedisURL = %q, QueueLease = %s", cfg.QueueBackend, cfg.RedisURL, cfg.QueueLease)
+				}
+				if cfg.RedisPrefix != "argo-diff" || cfg.RedisKey != "secret" {
+					t.Errorf("RedisPrefix = %q, RedisKey = %q", cfg.RedisPrefix, cfg.RedisKey)
+				}
+			},
+		},
+		{
+			name: "redis queue with prefix",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST":       "owner/repo",
+				"QUEUE_BACKEND":        "redis",
+				"REDIS_URL":            "redis://redis:6379/0",
+				"REDIS_ENCRYPTION_KEY": "secret",
+				"REDIS_PREFIX":         "argo-diff-staging",
+			},
+			wantErr: false,
+			checkConfig: func(t *testing.T, cfg *Config) {
+				if cfg.RedisPrefix != "argo-diff-staging" {
+					t.Errorf("RedisPrefix = %q, want argo-diff-staging", cfg.RedisPrefix)
+				}
+			},
+		},
+		{
+			name: "redis queue without url",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST":       "owner/repo",
+				"QUEUE_BACKEND":        "redis",
+				"REDIS_ENCRYPTION_KEY": "secret",
+			},
+			wantErr: true,
+		},
+		{
+			name: "redis queue without encryption key",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"QUEUE_BACKEND":  "redis",
+				"REDIS_URL":      "redis://redis:6379/0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown queue backend",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"QUEUE_BACKEND":  "kafka",
+			},
+			wantErr: true,
+		},
+		{
+			name: "repo weights",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"REPO_WEIGHTS":   "MyOrg/Platform=3, myorg/monorepo=1,*=2",
+			},
+			wantErr: false,
+			checkConfig: func(t *testing.T, cfg *Config) {
+				want := map[string]int{"myorg/platform": 3, "myorg/monorepo": 1, "*": 2}
+				if !maps.Equal(cfg.RepoWeights, want) {
+					t.Errorf("RepoWeights = %v, want %v", cfg.RepoWeights, want)
+				}
+			},
+		},
+		{
+			name: "zero repo weight",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"REPO_WEIGHTS":   "myorg/monorepo=0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "repo weight without repository",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"REPO_WEIGHTS":   "3",
+			},
+			wantErr: true,
+		},
+		{
+			name: "schema validation with CRDs",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST":    "owner/repo",
+				"SCHEMA_VALIDATION": "true",
+				"SCHEMA_CRDS":       "true",
+			},
+			wantErr: false,
+			checkConfig: func(t *testing.T, cfg *Config) {
+				if !cfg.SchemaValidation || !cfg.SchemaCRDs {
+					t.Errorf("SchemaValidation = %v, SchemaCRDs = %v, want true", cfg.SchemaValidation, cfg.SchemaCRDs)
+				}
+			},
+		},
+		{
+			name: "schema CRDs without validation",
+			envVars: map[string]string{
+				"REPO_ALLOWLIST": "owner/repo",
+				"SCHEMA_CRDS":    "true",
+			},
+			wantErr: true,
+		},
 		{
 			name: "empty allowlist",
 			envVars: map[string]string{
@@ -156,12 +412,28 @@ func TestLoad(t *testing.T) {
 			// Clear and set environment variables
 			_ = os.Unsetenv("PORT")
 			_ = os.Unsetenv("METRICS_PORT")
+			_ = os.Unsetenv("ADMIN_PORT")
+			_ = os.Unsetenv("ADMIN_TOKEN")
 			_ = os.Unsetenv("WORKER_COUNT")
 			_ = os.Unsetenv("QUEUE_SIZE")
+			_ = os.Unsetenv("REPO_WEIGHTS")
+			_ = os.Unsetenv("QUEUE_BACKEND")
+			_ = os.Unsetenv("REDIS_URL")
+			_ = os.Unsetenv("REDIS_PREFIX")
+			_ = os.Unsetenv("REDIS_ENCRYPTION_KEY")
+			_ = os.Unsetenv("QUEUE_LEASE")
 			_ = os.Unsetenv("REPO_ALLOWLIST")
 			_ = os.Unsetenv("RATE_LIMIT_PER_REPO")
+			_ = os.Unsetenv("DIFF_RATE_LIMIT_PER_REPO")
 			_ = os.Unsetenv("ARGOCD_PLAINTEXT")
 			_ = os.Unsetenv("JOB_TIMEOUT")
+			_ = os.Unsetenv("JOB_RETRIES")
+			_ = os.Unsetenv("JOB_RETRY_BACKOFF")
+			_ = os.Unsetenv("MAX_DIFF_LINES")
+			_ = os.Unsetenv("POLICY_FILE")
+			_ = os.Unsetenv("KUBE_VERSIONS")
+			_ = os.Unsetenv("SCHEMA_VALIDATION")
+			_ = os.Unsetenv("SCHEMA_CRDS")
 
 			for key, value := range tt.envVars {
 				_ = os.Setenv(key, value)
@@ -0,0 +1,172 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Capacity holds aggregate CPU (in millicores) and memory (in bytes)
+// requests and limits. As a change it holds head minus base.
+type Capacity struct {
+	CPURequests    int64
+	CPULimits      int64
+	MemoryRequests int64
+	MemoryLimits   int64
+}
+
+// IsZero reports whether no value changed
+func (c Capacity) IsZero() bool {
+	return c == Capacity{}
+}
+
+// Add returns the sum of c and other
+func (c Capacity) Add(other Capacity) Capacity {
+	return Capacity{
+		CPURequests:    c.CPURequests + other.CPURequests,
+		CPULimits:      c.CPULimits + other.CPULimits,
+		MemoryRequests: c.MemoryRequests + other.MemoryRequests,
+		MemoryLimits:   c.MemoryLimits + other.MemoryLimits,
+	}
+}
+
+// Sub returns c minus other
+func (c Capacity) Sub(other Capacity) Capacity {
+	return Capacity{
+		CPURequests:    c.CPURequests - other.CPURequests,
+		CPULimits:      c.CPULimits - other.CPULimits,
+		MemoryRequests: c.MemoryRequests - other.MemoryRequests,
+		MemoryLimits:   c.MemoryLimits - other.MemoryLimits,
+	}
+}
+
+// capacityChange returns the capacity difference of the changed workloads
+func capacityChange(changes []resourceChange) Capacity {
+	var total Capacity
+	for _, c := range changes {
+		total = total.Add(workloadCapacity(c.head).Sub(workloadCapacity(c.base)))
+	}
+	return total
+}
+
+// workloadCapacity returns the requests and limits of a workload's pods
+// multiplied by its replicas. DaemonSets count once (i.e. per node), as the
+// number of nodes is unknown. Init containers only count when they are
+// sidecars (restartPolicy: Always), as the others do not run alongside the
+// regular containers.
+func workloadCapacity(r *Resource) Capacity {
+	if r == nil {
+		return Capacity{}
+	}
+	obj := r.object()
+	spec := podSpec(r.Kind, obj)
+	if spec == nil {
+		return Capacity{}
+	}
+
+	var pod Capacity
+	for _, field := range []string{"initContainers", "containers"} {
+		list, _ := spec[field].([]any)
+		for _, item := range list {
+			c, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			if field == "initContainers" && c["restartPolicy"] != "Always" {
+				continue
+			}
+			resources, _ := c["resources"].(map[string]any)
+			requests, _ := resources["requests"].(map[string]any)
+			limits, _ := resources["limits"].(map[string]any)
+			pod = pod.Add(Capacity{
+				CPURequests:    parseQuantity(requests["cpu"], true),
+				CPULimits:      parseQuantity(limits["cpu"], true),
+				MemoryRequests: parseQuantity(requests["memory"], false),
+				MemoryLimits:   parseQuantity(limits["memory"], false),
+			})
+		}
+	}
+
+	return pod.scale(podCount(r.Kind, obj))
+}
+
+// scale multiplies every value by n
+func (c Capacity) scale(n int64) Capacity {
+	return Capacity{
+		CPURequests:    c.CPURequests * n,
+		CPULimits:      c.CPULimits * n,
+		MemoryRequests: c.MemoryRequests * n,
+		MemoryLimits:   c.MemoryLimits * n,
+	}
+}
+
+// podCount returns how many pods a workload runs at once
+func podCount(kind string, obj map[string]any) int64 {
+	switch kind {
+	case "Deployment", "StatefulSet", "ReplicaSet", "Rollout":
+		if n, ok := replicas(obj); ok {
+			return int64(n)
+		}
+		return 1 // API default
+	case "Job":
+		return parallelism(nestedMap(obj, "spec"))
+	case "CronJob":
+		return parallelism(nestedMap(obj, "spec", "jobTemplate", "spec"))
+	}
+	return 1
+}
+
+// parallelism returns spec.parallelism of a Job spec, defaulting to 1
+func parallelism(spec map[string]any) int64 {
+	if n, ok := spec["parallelism"].(int); ok {
+		return int64(n)
+	}
+	return 1
+}
+
+// parseQuantity parses a Kubernetes quantity as millis (for CPU) or as a
+// plain value (for memory). Missing or invalid quantities count as zero.
+func parseQuantity(v any, milli bool) int64 {
+	// Unquoted numbers like "cpu: 1" or "cpu: 0.5" are decoded as numbers
+	var s string
+	switch q := v.(type) {
+	case string:
+		s = q
+	case int:
+		s = strconv.Itoa(q)
+	case float64:
+		s = strconv.FormatFloat(q, 'f', -1, 64)
+	default:
+		return 0
+	}
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0
+	}
+	if milli {
+		return q.MilliValue()
+	}
+	return q.Value()
+}
+
+// formatCapacity renders the non-zero values of a capacity change, e.g.
+// "CPU requests +500m · memory limits -1Gi", or "" if nothing changed
+func formatCapacity(c Capacity) string {
+	var parts []string
+	add := func(label string, q *resource.Quantity) {
+		if q.IsZero() {
+			return
+		}
+		s := q.String()
+		if q.Sign() > 0 {
+			s = "+" + s
+		}
+		parts = append(parts, label+" "+s)
+	}
+	add("CPU requests", resource.NewMilliQuantity(c.CPURequests, resource.DecimalSI))
+	add("CPU limits", resource.NewMilliQuantity(c.CPULimits, resource.DecimalSI))
+	add("memory requests", resource.NewQuantity(c.MemoryRequests, resource.BinarySI))
+	add("memory limits", resource.NewQuantity(c.MemoryLimits, resource.BinarySI))
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,126 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		value any
+		milli bool
+		want  int64
+	}{
+		{"500m", true, 500},
+		{"2", true, 2000},
+		{1, true, 1000},
+		{0.25, true, 250},
+		{"1.5", true, 1500},
+		{"256Mi", false, 256 << 20},
+		{"1Gi", false, 1 << 30},
+		{"1G", false, 1_000_000_000},
+		{"128974848", false, 128974848},
+		{"bogus", false, 0},
+		{nil, true, 0},
+	}
+	for _, tt := range tests {
+		if got := parseQuantity(tt.value, tt.milli); got != tt.want {
+			t.Errorf("parseQuantity(%v, %v) = %d, want %d", tt.value, tt.milli, got, tt.want)
+		}
+	}
+}
+
+// sizedDeployment renders a Deployment with one container and a sidecar
+// init container, both with the given requests and limits
+func sizedDeployment(name string, replicas int, cpu, memory string) string {
+	resources := `
+          resources:
+            requests:
+              cpu: ` + cpu + `
+              memory: ` + memory + `
+            limits:
+              memory: ` + memory
+	return `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ` + name + `
+spec:
+  replicas: ` + strconv.Itoa(replicas) + `
+  template:
+    spec:
+      initContainers:
+        - name: setup
+          image: setup:v1
+          resources:
+            requests:
+              cpu: "4"
+        - name: proxy
+          image: proxy:v1
+          restartPolicy: Always` + resources + `
+      containers:
+        - name: app
+          image: app:v1` + resources + `
+`
+}
+
+func TestCapacityChange(t *testing.T) {
+	base := []string{sizedDeployment("web", 2, "250m", "128Mi"), sizedDeployment("old", 1, "1", "1Gi")}
+	head := []string{sizedDeployment("web", 3, "500m", "128Mi"), manifestFor("ConfigMap", "cfg", "a")}
+
+	result, err := GenerateDiff(base, head, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+
+	// web: 2 containers (app + sidecar, the plain init container does not
+	// count) x 250m x 2 replicas -> 2 x 500m x 3 replicas; old is deleted
+	want := Capacity{
+		CPURequests:    2*500*3 - 2*250*2 - 2*1000,
+		MemoryRequests: 2*(128<<20)*3 - 2*(128<<20)*2 - 2*(1<<30),
+		MemoryLimits:   2*(128<<20)*3 - 2*(128<<20)*2 - 2*(1<<30),
+	}
+	if result.Capacity != want {
+		t.Errorf("Capacity = %+v, want %+v", result.Capacity, want)
+	}
+}
+
+func TestFormatCapacity(t *testing.T) {
+	tests := []struct {
+		c    Capacity
+		want string
+	}{
+		{Capacity{}, ""},
+		{Capacity{CPURequests: 500, MemoryLimits: -1 << 30}, "CPU requests +500m · memory limits -1Gi"},
+		{Capacity{CPULimits: 2000, MemoryRequests: 256 << 20}, "CPU limits +2 · memory requests +256Mi"},
+	}
+	for _, tt := range tests {
+		if got := formatCapacity(tt.c); got != tt.want {
+			t.Errorf("formatCapacity(%+v) = %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestFormatReportCapacity(t *testing.T) {
+	a, err := GenerateDiff([]string{sizedDeployment("web", 1, "250m", "128Mi")}, []string{sizedDeployment("web", 2, "250m", "128Mi")}, &AppInfo{Name: "a"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	b, err := GenerateDiff([]string{sizedDeployment("api", 1, "1", "1Gi")}, nil, &AppInfo{Name: "b"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+
+	output := FormatReport(NewDiffReportWithOptions("ArgoCD Diff", []*DiffResult{a, b}, false))
+	for _, want := range []string{
+		"**Capacity impact:** CPU requests +500m · memory requests +256Mi · memory limits +256Mi\n",
+		"**Capacity impact:** CPU requests -2 · memory requests -2Gi · memory limits -2Gi\n",
+		// Overall: +500m - 2 cores, +256Mi - 2Gi
+		"**Capacity impact:** CPU requests -1500m · memory requests -1792Mi · memory limits -1792Mi\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("report should contain %q, got:\n%s", want, output)
+		}
+	}
+}
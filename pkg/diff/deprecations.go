@@ -0,0 +1,100 @@
+package diff
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tamcore/argo-diff/pkg/kubeversion"
+)
+
+//go:embed deprecations.yaml
+var deprecationsYAML []byte
+
+// apiDeprecation is an entry of deprecations.yaml
+type apiDeprecation struct {
+	APIVersion   string `yaml:"apiVersion"`
+	Kind         string `yaml:"kind"`
+	DeprecatedIn string `yaml:"deprecatedIn"`
+	RemovedIn    string `yaml:"removedIn"`
+	Replacement  string `yaml:"replacement"`
+}
+
+// deprecations maps "group/version/kind" (apiVersion + "/" + kind) to its
+// deprecation entry
+var deprecations = loadDeprecations(deprecationsYAML)
+
+func loadDeprecations(data []byte) map[string]apiDeprecation {
+	var entries []apiDeprecation
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		panic(fmt.Sprintf("parse deprecations.yaml: %v", err))
+	}
+	out := make(map[string]apiDeprecation, len(entries))
+	for _, e := range entries {
+		if _, _, ok := kubeversion.Parse(e.DeprecatedIn); !ok {
+			panic(fmt.Sprintf("deprecations.yaml: %s %s: invalid deprecatedIn %q", e.APIVersion, e.Kind, e.DeprecatedIn))
+		}
+		if _, _, ok := kubeversion.Parse(e.RemovedIn); !ok {
+			panic(fmt.Sprintf("deprecations.yaml: %s %s: invalid removedIn %q", e.APIVersion, e.Kind, e.RemovedIn))
+		}
+		out[e.APIVersion+"/"+e.Kind] = e
+	}
+	return out
+}
+
+// APIDeprecation is a head resource using a deprecated or removed API
+type APIDeprecation struct {
+	Resource     string // Kind/namespace/name of the resource
+	APIVersion   string
+	Kind         string
+	DeprecatedIn string
+	RemovedIn    string
+	Replacement  string // apiVersion to migrate to, empty if there is none
+	Removed      bool   // The API is no longer served by the target version
+}
+
+// deprecatedAPIs returns the resources using APIs that are deprecated in
+// kubeVersion ("1.29"). Without a target version every deprecated API is
+// reported, but none as removed.
+func deprecatedAPIs(resources []*Resource, kubeVersion string) []APIDeprecation {
+	var out []APIDeprecation
+	for _, r := range resources {
+		d, ok := deprecations[r.APIVersion+"/"+r.Kind]
+		if !ok {
+			continue
+		}
+		removed := false
+		if kubeVersion != "" {
+			if kubeversion.Compare(kubeVersion, d.DeprecatedIn) < 0 {
+				continue
+			}
+			removed = kubeversion.Compare(kubeVersion, d.RemovedIn) >= 0
+		}
+		out = append(out, APIDeprecation{
+			Resource:     resourceName(r),
+			APIVersion:   d.APIVersion,
+			Kind:         d.Kind,
+			DeprecatedIn: d.DeprecatedIn,
+			RemovedIn:    d.RemovedIn,
+			Replacement:  d.Replacement,
+			Removed:      removed,
+		})
+	}
+	return out
+}
+
+// formatDeprecation renders a deprecated API as a list item
+func formatDeprecation(d APIDeprecation) string {
+	var sb strings.Builder
+	if d.Removed {
+		fmt.Fprintf(&sb, "- ⛔ `%s` uses `%s`, removed in Kubernetes %s", d.Resource, d.APIVersion, d.RemovedIn)
+	} else {
+		fmt.Fprintf(&sb, "- ⚠️ `%s` uses `%s`, deprecated in Kubernetes %s and removed in %s", d.Resource, d.APIVersion, d.DeprecatedIn, d.RemovedIn)
+	}
+	if d.Replacement != "" {
+		fmt.Fprintf(&sb, "; use `%s`", d.Replacement)
+	}
+	return sb.String()
+}
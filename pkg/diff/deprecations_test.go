@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tamcore/argo-diff/pkg/kubeversion"
+)
+
+func hpa(apiVersion string) string {
+	return `
+apiVersion: ` + apiVersion + `
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+  namespace: prod
+spec:
+  maxReplicas: 5
+`
+}
+
+func TestDeprecationsTable(t *testing.T) {
+	if len(deprecations) == 0 {
+		t.Fatal("deprecations.yaml should not be empty")
+	}
+	for key, d := range deprecations {
+		if kubeversion.Compare(d.DeprecatedIn, d.RemovedIn) >= 0 {
+			t.Errorf("%s: deprecatedIn %s should be before removedIn %s", key, d.DeprecatedIn, d.RemovedIn)
+		}
+	}
+}
+
+func TestDeprecatedAPIs(t *testing.T) {
+	head := []string{
+		hpa("autoscaling/v2beta2"),
+		hpa("autoscaling/v2"),
+		manifestFor("ConfigMap", "cfg", "a"),
+	}
+
+	tests := []struct {
+		kubeVersion string
+		want        []APIDeprecation
+	}{
+		{"1.22", nil}, // not yet deprecated
+		{"1.25", []APIDeprecation{{Removed: false}}},
+		{"1.26", []APIDeprecation{{Removed: true}}},
+		{"v1.31.1", []APIDeprecation{{Removed: true}}},
+		{"", []APIDeprecation{{Removed: false}}},
+	}
+	for _, tt := range tests {
+		result, err := GenerateDiffWithOptions(nil, head, &AppInfo{Name: "app"}, &DiffOptions{KubeVersion: tt.kubeVersion})
+		if err != nil {
+			t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+		}
+		if len(result.Deprecations) != len(tt.want) {
+			t.Fatalf("%q: Deprecations = %+v, want %d", tt.kubeVersion, result.Deprecations, len(tt.want))
+		}
+		for i, want := range tt.want {
+			want.Resource = "HorizontalPodAutoscaler/prod/web"
+			want.APIVersion = "autoscaling/v2beta2"
+			want.Kind = "HorizontalPodAutoscaler"
+			want.DeprecatedIn = "1.23"
+			want.RemovedIn = "1.26"
+			want.Replacement = "autoscaling/v2"
+			if result.Deprecations[i] != want {
+				t.Errorf("%q: Deprecations[%d] = %+v, want %+v", tt.kubeVersion, i, result.Deprecations[i], want)
+			}
+		}
+	}
+}
+
+func TestDeprecatedAPIsIgnoresBase(t *testing.T) {
+	result, err := GenerateDiffWithOptions([]string{hpa("autoscaling/v2beta2")}, []string{hpa("autoscaling/v2")}, &AppInfo{Name: "app"}, &DiffOptions{KubeVersion: "1.29"})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if len(result.Deprecations) != 0 {
+		t.Errorf("migrated resources should not be reported, got %+v", result.Deprecations)
+	}
+}
+
+func TestFormatAppDiffDeprecations(t *testing.T) {
+	psp := `
+apiVersion: policy/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: restricted
+`
+	result, err := GenerateDiffWithOptions(nil, []string{psp, hpa("autoscaling/v2beta2")}, &AppInfo{Name: "app"}, &DiffOptions{KubeVersion: "1.25"})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+
+	output := FormatAppDiff(result)
+	for _, want := range []string{
+		"**Deprecated APIs:**\n\n",
+		"- ⛔ `PodSecurityPolicy/restricted` uses `policy/v1beta1`, removed in Kubernetes 1.25\n",
+		"- ⚠️ `HorizontalPodAutoscaler/prod/web` uses `autoscaling/v2beta2`, deprecated in Kubernetes 1.23 and removed in 1.26; use `autoscaling/v2`\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+}
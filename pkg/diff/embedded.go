@@ -0,0 +1,245 @@
+package diff
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// embeddedFormat identifies the format of a config file embedded in a
+// ConfigMap data value
+type embeddedFormat int
+
+const (
+	formatUnknown embeddedFormat = iota
+	formatJSON
+	formatYAML
+	formatTOML
+)
+
+// detectEmbeddedFormat guesses the format of a data value from its key's
+// file extension, falling back to sniffing for JSON objects and arrays
+// (Grafana dashboards are often stored under keys without an extension).
+func detectEmbeddedFormat(key, value string) embeddedFormat {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".json":
+		return formatJSON
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	}
+
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return formatJSON
+	}
+	return formatUnknown
+}
+
+// normalizeEmbedded parses value in the given format and pretty-prints it
+// with sorted keys and consistent indentation. It reports false if the value
+// cannot be parsed, in which case the caller keeps the original text.
+func normalizeEmbedded(format embeddedFormat, value string) (string, bool) {
+	var (
+		out string
+		err error
+	)
+	switch format {
+	case formatJSON:
+		out, err = normalizeJSON(value)
+	case formatYAML:
+		out, err = normalizeYAML(value)
+	case formatTOML:
+		out, err = normalizeTOML(value)
+	default:
+		return value, false
+	}
+	if err != nil {
+		return value, false
+	}
+	// A trailing newline lets the YAML encoder render the value as a literal
+	// block, which keeps the line diff readable
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out, true
+}
+
+// normalizeJSON re-indents a JSON document with sorted object keys
+func normalizeJSON(value string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.UseNumber() // keep numbers exactly as written
+	var data any
+	if err := dec.Decode(&data); err != nil {
+		return "", err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return "", fmt.Errorf("trailing data after JSON document")
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// normalizeYAML re-encodes each document of a YAML stream with sorted keys.
+// Documents are re-encoded as nodes, so scalars keep their original text
+// (1.10 is not turned into 1.1) and comments are kept. Only mappings and
+// sequences are normalized: a scalar is most likely plain text that happens
+// to be valid YAML.
+func normalizeYAML(value string) (string, error) {
+	dec := yaml.NewDecoder(strings.NewReader(value))
+	var docs []string
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(doc.Content) == 0 || (doc.Content[0].Kind != yaml.MappingNode && doc.Content[0].Kind != yaml.SequenceNode) {
+			return "", fmt.Errorf("YAML document is not a mapping or sequence")
+		}
+		sortMappingKeys(&doc)
+
+		out, err := encodeYAMLNode(&doc)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, out)
+	}
+	if len(docs) == 0 {
+		return "", fmt.Errorf("empty YAML document")
+	}
+	return strings.Join(docs, "---\n"), nil
+}
+
+// sortMappingKeys sorts the keys of every mapping below n, keeping each
+// value with its key
+func sortMappingKeys(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+		}
+		slices.SortStableFunc(pairs, func(a, b [2]*yaml.Node) int {
+			return cmp.Compare(a[0].Value, b[0].Value)
+		})
+		n.Content = n.Content[:0]
+		for _, p := range pairs {
+			n.Content = append(n.Content, p[0], p[1])
+		}
+	}
+	for _, c := range n.Content {
+		sortMappingKeys(c)
+	}
+}
+
+// encodeYAMLNode encodes a YAML node with an indent of 2
+func encodeYAMLNode(n *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// normalizeTOML re-encodes a TOML document with sorted keys
+func normalizeTOML(value string) (string, error) {
+	var data map[string]any
+	if _, err := toml.Decode(value, &data); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = "  "
+	if err := enc.Encode(data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// normalizeEmbeddedData pretty-prints config files embedded in ConfigMap
+// data values, so a one-key change in e.g. a JSON dashboard shows up as a
+// one-line diff instead of a changed blob. The result is only used to render
+// diffs (Resource.display): whether a ConfigMap changed is decided on its
+// original text. The ConfigMap is re-encoded as a YAML node, so everything
+// but the normalized values keeps its order and text. Other kinds are
+// returned unchanged.
+func normalizeEmbeddedData(resources []*Resource) []*Resource {
+	normalized := make([]*Resource, 0, len(resources))
+	for _, r := range resources {
+		if r.Kind != "ConfigMap" {
+			normalized = append(normalized, r)
+			continue
+		}
+
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(r.raw), &doc); err != nil || len(doc.Content) == 0 {
+			normalized = append(normalized, r)
+			continue
+		}
+		data := mappingValue(doc.Content[0], "data")
+		if data == nil || data.Kind != yaml.MappingNode {
+			normalized = append(normalized, r)
+			continue
+		}
+
+		for i := 1; i < len(data.Content); i += 2 {
+			key, value := data.Content[i-1], data.Content[i]
+			if value.Kind != yaml.ScalarNode {
+				continue
+			}
+			if out, ok := normalizeEmbedded(detectEmbeddedFormat(key.Value, value.Value), value.Value); ok {
+				value.Value = out
+				value.Style = yaml.LiteralStyle
+			}
+		}
+
+		out, err := encodeYAMLNode(&doc)
+		if err != nil {
+			normalized = append(normalized, r)
+			continue
+		}
+
+		newResource := *r
+		newResource.display = strings.TrimSpace(out)
+		normalized = append(normalized, &newResource)
+	}
+	return normalized
+}
+
+// mappingValue returns the value of key in a YAML mapping node, or nil
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 1; i < len(n.Content); i += 2 {
+		if n.Content[i-1].Value == key {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectEmbeddedFormat(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		want  embeddedFormat
+	}{
+		{"settings.json", "{}", formatJSON},
+		{"config.yaml", "a: 1", formatYAML},
+		{"config.YML", "a: 1", formatYAML},
+		{"app.toml", "a = 1", formatTOML},
+		{"dashboard", `  {"title": "x"}`, formatJSON},
+		{"list", `[1, 2]`, formatJSON},
+		{"plain", "hello world", formatUnknown},
+		{"script.sh", "echo {}", formatUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := detectEmbeddedFormat(tt.key, tt.value); got != tt.want {
+			t.Errorf("detectEmbeddedFormat(%q, %q) = %v, want %v", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeEmbedded(t *testing.T) {
+	tests := []struct {
+		name   string
+		format embeddedFormat
+		value  string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "json sorted and indented",
+			format: formatJSON,
+			value:  `{"b":1,"a":{"y":true,"x":"<tag>"}}`,
+			want:   "{\n  \"a\": {\n    \"x\": \"<tag>\",\n    \"y\": true\n  },\n  \"b\": 1\n}\n",
+			wantOK: true,
+		},
+		{
+			name:   "json keeps number formatting",
+			format: formatJSON,
+			value:  `{"big":12345678901234567890,"f":1.50}`,
+			want:   "{\n  \"big\": 12345678901234567890,\n  \"f\": 1.50\n}\n",
+			wantOK: true,
+		},
+		{
+			name:   "invalid json",
+			format: formatJSON,
+			value:  `{"a":`,
+			wantOK: false,
+		},
+		{
+			name:   "json with trailing data",
+			format: formatJSON,
+			value:  `{"a":1} {"b":2}`,
+			wantOK: false,
+		},
+		{
+			name:   "yaml sorted and indented",
+			format: formatYAML,
+			value:  "b: 1\na:\n    - p\n    - q\n",
+			want:   "a:\n  - p\n  - q\nb: 1\n",
+			wantOK: true,
+		},
+		{
+			name:   "yaml multi document",
+			format: formatYAML,
+			value:  "b: 1\na: 2\n---\nc: 3\n",
+			want:   "a: 2\nb: 1\n---\nc: 3\n",
+			wantOK: true,
+		},
+		{
+			name:   "yaml keeps scalar text and comments",
+			format: formatYAML,
+			value:  "version: 1.10 # pinned\nenabled: yes\n",
+			want:   "enabled: yes\nversion: 1.10 # pinned\n",
+			wantOK: true,
+		},
+		{
+			name:   "yaml scalar is left alone",
+			format: formatYAML,
+			value:  "just some text",
+			wantOK: false,
+		},
+		{
+			name:   "toml sorted",
+			format: formatTOML,
+			value:  "b = 1\na = \"x\"\n",
+			want:   "a = \"x\"\nb = 1\n",
+			wantOK: true,
+		},
+		{
+			name:   "invalid toml",
+			format: formatTOML,
+			value:  "a = ",
+			wantOK: false,
+		},
+		{
+			name:   "unknown format",
+			format: formatUnknown,
+			value:  "text",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := normalizeEmbedded(tt.format, tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("normalizeEmbedded() ok = %v, want %v (output %q)", ok, tt.wantOK, got)
+			}
+			if !ok {
+				if got != tt.value {
+					t.Errorf("normalizeEmbedded() should return the original value on failure, got %q", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("normalizeEmbedded() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateDiffNormalizesEmbeddedJSON(t *testing.T) {
+	// ArgoCD returns manifests as JSON, so the embedded file arrives as a
+	// single escaped string
+	base := []string{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"dashboards"},"data":{"dashboard.json":"{\"title\":\"API\",\"refresh\":\"30s\",\"panels\":[{\"id\":1,\"type\":\"graph\"}]}"}}`}
+	head := []string{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"dashboards"},"data":{"dashboard.json":"{\"panels\":[{\"id\":1,\"type\":\"graph\"}],\"refresh\":\"1m\",\"title\":\"API\"}"}}`}
+
+	opts := &DiffOptions{NormalizeEmbedded: true}
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, opts)
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if result.ResourcesModified != 1 {
+		t.Fatalf("ResourcesModified = %d, want 1", result.ResourcesModified)
+	}
+
+	d := result.Diffs[0]
+	if !strings.Contains(d, `-      "refresh": "30s",`) || !strings.Contains(d, `+      "refresh": "1m",`) {
+		t.Errorf("diff should show the changed key on its own line, got:\n%s", d)
+	}
+	if strings.Contains(d, `-      "title"`) || strings.Contains(d, `+      "title"`) {
+		t.Errorf("reordered but unchanged keys should not show up as changes, got:\n%s", d)
+	}
+}
+
+func TestGenerateDiffNormalizeEmbeddedOnlyReordered(t *testing.T) {
+	base := []string{`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  config.yaml: |
+    server:
+      port: 8080
+    logging: debug
+`}
+	head := []string{`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  config.yaml: |
+    logging: debug
+    server:
+        port: 8080
+`}
+
+	// The data the pods see changed, so it is reported; as the normalized
+	// text is identical, the original text is diffed
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, &DiffOptions{NormalizeEmbedded: true})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if result.ResourcesModified != 1 {
+		t.Fatalf("ResourcesModified = %d, want 1", result.ResourcesModified)
+	}
+	if !strings.Contains(result.Diffs[0], "+        port: 8080") {
+		t.Errorf("diff should show the original text, got:\n%s", result.Diffs[0])
+	}
+}
+
+func TestGenerateDiffNormalizeEmbeddedDetectsHiddenEdits(t *testing.T) {
+	configMap := func(config string) []string {
+		return []string{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  config.yaml: |\n" + config}
+	}
+
+	tests := []struct {
+		name       string
+		base, head string
+		want       []string
+	}{
+		{
+			name: "comment only",
+			base: "    # retries: 3\n    server: api\n",
+			head: "    # retries: 5\n    server: api\n",
+			want: []string{"-    # retries: 3", "+    # retries: 5"},
+		},
+		{
+			name: "number formatting",
+			base: "    version: 1.10\n",
+			head: "    version: 1.1\n",
+			want: []string{"-    version: 1.10", "+    version: 1.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := GenerateDiffWithOptions(configMap(tt.base), configMap(tt.head), &AppInfo{Name: "app"}, &DiffOptions{NormalizeEmbedded: true})
+			if err != nil {
+				t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+			}
+			if !result.HasChanges || result.ResourcesModified != 1 {
+				t.Fatalf("HasChanges = %v, ResourcesModified = %d, want a modification", result.HasChanges, result.ResourcesModified)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(result.Diffs[0], want) {
+					t.Errorf("diff missing %q, got:\n%s", want, result.Diffs[0])
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateDiffNormalizeEmbeddedFallsBackToText(t *testing.T) {
+	base := []string{`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  settings.json: |
+    {"a": 1
+`}
+	head := []string{`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  settings.json: |
+    {"a": 2
+`}
+
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, &DiffOptions{NormalizeEmbedded: true})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if result.ResourcesModified != 1 {
+		t.Fatalf("ResourcesModified = %d, want 1", result.ResourcesModified)
+	}
+	if !strings.Contains(result.Diffs[0], `+    {"a": 2`) {
+		t.Errorf("unparseable values should be diffed as text, got:\n%s", result.Diffs[0])
+	}
+}
@@ -2,10 +2,12 @@ package diff
 
 import (
 	"bytes"
+	"cmp"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -15,7 +17,10 @@ import (
 )
 
 const (
-	helmHookAnnotation = "helm.sh/hook"
+	helmHookAnnotation       = "helm.sh/hook"
+	helmHookWeightAnnotation = "helm.sh/hook-weight"
+	argocdHookAnnotation     = "argocd.argoproj.io/hook"
+	argocdSyncWaveAnnotation = "argocd.argoproj.io/sync-wave"
 )
 
 // ResourceMetadata holds the metadata fields we key and filter on.
@@ -42,6 +47,31 @@ type Resource struct {
 	Kind       string           `yaml:"kind"`
 	Metadata   ResourceMetadata `yaml:"metadata"`
 	raw        string
+	original   string    // raw as rendered, before metadata filtering; policies and schemas check this
+	display    string    // raw with embedded config files normalized, only for rendering (empty = raw)
+	hook       *hookInfo // set for hooks split off with DiffOptions.IncludeHooks
+	// sync options are kept from parsing, as metadata filtering may strip
+	// the annotation
+	syncOptions []string
+}
+
+// hookInfo describes when a Helm or ArgoCD hook runs
+type hookInfo struct {
+	types  string // e.g. "pre-install,pre-upgrade" or "PreSync"
+	weight string
+}
+
+// resourceChange pairs a changed resource with its rendered diff. For
+// deletions the resource is the base version, otherwise the head version.
+type resourceChange struct {
+	resource   *Resource
+	base, head *Resource // nil for added and deleted resources respectively
+	changeType ChangeType
+	diff       string // markdown for the PR comment
+	unified    string // plain unified diff for the structured report
+	truncated  bool   // unified was cut off after the line limit
+	immutable  []string
+	prune      Prune // set for deleted resources
 }
 
 // GenerateDiff generates a formatted diff between base and head manifests
@@ -57,9 +87,8 @@ func GenerateDiffWithOptions(baseManifests, headManifests []string, appInfo *App
 	}
 
 	result := &DiffResult{
-		AppInfo:    appInfo,
-		Diffs:      []string{},
-		HasChanges: false,
+		AppInfo: appInfo,
+		Diffs:   []string{},
 	}
 
 	baseResources, err := parseManifests(baseManifests)
@@ -72,9 +101,16 @@ func GenerateDiffWithOptions(baseManifests, headManifests []string, appInfo *App
 		return nil, fmt.Errorf("parse head manifests: %w", err)
 	}
 
-	// Filter out helm hooks
-	baseResources = filterHelmHooks(baseResources)
-	headResources = filterHelmHooks(headResources)
+	// Helm hooks are dropped unless requested. When included, Helm and ArgoCD
+	// hooks are split off so they can be rendered in their own section.
+	var baseHooks, headHooks []*Resource
+	if opts.IncludeHooks {
+		baseResources, baseHooks = splitHooks(baseResources)
+		headResources, headHooks = splitHooks(headResources)
+	} else {
+		baseResources = filterHelmHooks(baseResources)
+		headResources = filterHelmHooks(headResources)
+	}
 
 	// Build list of metadata patterns to filter
 	var metadataPatterns []string
@@ -85,11 +121,19 @@ func GenerateDiffWithOptions(baseManifests, headManifests []string, appInfo *App
 		metadataPatterns = append(metadataPatterns, opts.IgnoredMetadata...)
 	}
 
-	// Filter metadata if patterns are specified
-	if len(metadataPatterns) > 0 {
-		baseResources = filterMetadata(baseResources, metadataPatterns)
-		headResources = filterMetadata(headResources, metadataPatterns)
+	prepare := func(resources []*Resource) []*Resource {
+		// Filter metadata if patterns are specified
+		if len(metadataPatterns) > 0 {
+			resources = filterMetadata(resources, metadataPatterns)
+		}
+		// Pretty-print config files embedded in ConfigMaps
+		if opts.NormalizeEmbedded {
+			resources = normalizeEmbeddedData(resources)
+		}
+		return resources
 	}
+	baseResources, headResources = prepare(baseResources), prepare(headResources)
+	baseHooks, headHooks = prepare(baseHooks), prepare(headHooks)
 
 	// Determine destination namespace for key normalization.
 	// When a chart adds an explicit metadata.namespace that matches the app's
@@ -106,6 +150,85 @@ func GenerateDiffWithOptions(baseManifests, headManifests []string, appInfo *App
 		return r.key()
 	}
 
+	kindOrder := opts.KindOrder
+	if len(kindOrder) == 0 {
+		kindOrder = DefaultKindOrder
+	}
+
+	changes := collectChanges(baseResources, headResources, keyFor, opts.MaxDiffLines, result)
+	hookChanges := collectChanges(baseHooks, headHooks, keyFor, opts.MaxDiffLines, result)
+
+	result.Diffs = renderChanges(changes, kindOrder, opts.GroupByKind)
+	result.HookDiffs = renderChanges(hookChanges, kindOrder, false)
+	result.HasChanges = len(changes) > 0 || len(hookChanges) > 0
+
+	// renderChanges sorted both lists, so Changes follows the comment order
+	allChanges := slices.Concat(changes, hookChanges)
+	result.Changes = make([]ResourceChange, 0, len(allChanges))
+	for _, c := range allChanges {
+		result.Changes = append(result.Changes, c.structured())
+	}
+	result.Risks = analyzeRisks(allChanges, opts.RiskRules)
+	result.ImageChanges = imageChanges(allChanges)
+	result.Capacity = capacityChange(allChanges)
+	result.RBACChanges = rbacChanges(allChanges)
+	result.HeadResources = resourceIDs(headResources, appInfo)
+	result.Deprecations = deprecatedAPIs(slices.Concat(headResources, headHooks), opts.KubeVersion)
+
+	// Schemas and policies check the resources as rendered, since metadata
+	// filtering only affects what is diffed
+	if opts.Schema != nil {
+		for _, c := range allChanges {
+			if c.head == nil {
+				continue
+			}
+			for _, msg := range opts.Schema.Validate(c.head.originalObject()) {
+				result.SchemaErrors = append(result.SchemaErrors, SchemaError{Resource: resourceName(c.head), Message: msg})
+			}
+		}
+	}
+
+	if opts.Policies != nil {
+		baseViolations := opts.Policies.Check(originalObjects(slices.Concat(baseResources, baseHooks)))
+		headViolations := opts.Policies.Check(originalObjects(slices.Concat(headResources, headHooks)))
+		result.Violations = newViolations(headViolations, baseViolations)
+	}
+
+	return result, nil
+}
+
+// originalObjects parses resources as rendered, skipping unparsable ones
+func originalObjects(resources []*Resource) []map[string]any {
+	var objects []map[string]any
+	for _, r := range resources {
+		if obj := r.originalObject(); obj != nil {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+// newViolations returns the head violations of policies a resource did not
+// violate in base already, so only the violations a change introduces are
+// reported
+func newViolations(head, base []PolicyViolation) []PolicyViolation {
+	existing := make(map[[2]string]bool, len(base))
+	for _, v := range base {
+		existing[[2]string{v.Policy, v.Resource}] = true
+	}
+	var out []PolicyViolation
+	for _, v := range head {
+		if !existing[[2]string{v.Policy, v.Resource}] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// collectChanges compares base and head resources by key and returns the
+// rendered diff of every added, modified and deleted resource, updating the
+// change counts on result
+func collectChanges(baseResources, headResources []*Resource, keyFor func(*Resource) string, maxLines int, result *DiffResult) []resourceChange {
 	// Create resource maps for comparison
 	baseMap := make(map[string]*Resource)
 	for _, r := range baseResources {
@@ -117,22 +240,32 @@ func GenerateDiffWithOptions(baseManifests, headManifests []string, appInfo *App
 		headMap[keyFor(r)] = r
 	}
 
+	var changes []resourceChange
+
 	// Find modified and deleted resources
 	for key, base := range baseMap {
 		if head, exists := headMap[key]; exists {
 			// Resource exists in both - check for changes
+			// Changes are detected on the original text, so edits that
+			// normalization hides (comments, number formatting) still count
 			if base.raw != head.raw {
-				diff := generateResourceDiff(base, head)
-				result.Diffs = append(result.Diffs, diff)
-				result.HasChanges = true
+				unified, truncated := unifiedResourceDiff(base, head, maxLines)
+				diff := fmt.Sprintf("<details open>\n<summary>===== %s =====</summary>\n\n```diff\n%s```\n%s</details>",
+					head.key(), unified, truncatedNote(truncated, maxLines))
+				immutable := immutableFieldChanges(base, head)
+				if len(immutable) > 0 {
+					diff = immutableWarning(immutable, head.syncOptions) + "\n\n" + diff
+				}
+				changes = append(changes, resourceChange{resource: head, base: base, head: head, changeType: ChangeModified, diff: diff, unified: unified, truncated: truncated, immutable: immutable})
 				result.ResourcesModified++
 			}
 		} else {
 			// Resource deleted
-			diff := fmt.Sprintf("<details>\n<summary>🗑️ Deleted: %s</summary>\n\n```yaml\n%s\n```\n</details>",
-				base.key(), base.raw)
-			result.Diffs = append(result.Diffs, diff)
-			result.HasChanges = true
+			prune := pruneBehavior(base, result.AppInfo)
+			diff := fmt.Sprintf("<details>\n<summary>🗑️ Deleted: %s%s</summary>\n\n```yaml\n%s\n```\n</details>",
+				base.key(), pruneNote(prune, base.syncOptions), base.text())
+			unified, truncated := limitedUnifiedDiff(strings.Split(base.text(), "\n"), nil, diffFilename(base), 3, maxLines)
+			changes = append(changes, resourceChange{resource: base, base: base, changeType: ChangeDeleted, diff: diff, unified: unified, truncated: truncated, prune: prune})
 			result.ResourcesDeleted++
 		}
 	}
@@ -141,14 +274,63 @@ func GenerateDiffWithOptions(baseManifests, headManifests []string, appInfo *App
 	for key, head := range headMap {
 		if _, exists := baseMap[key]; !exists {
 			diff := fmt.Sprintf("<details>\n<summary>➕ Added: %s</summary>\n\n```yaml\n%s\n```\n</details>",
-				head.key(), head.raw)
-			result.Diffs = append(result.Diffs, diff)
-			result.HasChanges = true
+				head.key(), head.text())
+			unified, truncated := limitedUnifiedDiff(nil, strings.Split(head.text(), "\n"), diffFilename(head), 3, maxLines)
+			changes = append(changes, resourceChange{resource: head, head: head, changeType: ChangeAdded, diff: diff, unified: unified, truncated: truncated})
 			result.ResourcesAdded++
 		}
 	}
 
-	return result, nil
+	return changes
+}
+
+// structured returns the change in the form used by the JSON report
+func (c resourceChange) structured() ResourceChange {
+	r := c.resource
+	group, version := "", r.APIVersion
+	if i := strings.LastIndex(r.APIVersion, "/"); i >= 0 {
+		group, version = r.APIVersion[:i], r.APIVersion[i+1:]
+	}
+	return ResourceChange{
+		Type:      c.changeType,
+		Group:     group,
+		Version:   version,
+		Kind:      r.Kind,
+		Namespace: r.Metadata.Namespace,
+		Name:      r.Metadata.identity(),
+		Hook:      r.hook != nil,
+		Diff:      c.unified,
+		Truncated: c.truncated,
+
+		ImmutableFields: c.immutable,
+		SyncOptions:     r.syncOptions,
+		Prune:           c.prune,
+	}
+}
+
+// renderChanges sorts changes deterministically (map iteration order is
+// random, and comments must be comparable between runs) and returns their
+// diffs, optionally with a heading per kind
+func renderChanges(changes []resourceChange, kindOrder []string, groupByKind bool) []string {
+	slices.SortStableFunc(changes, func(a, b resourceChange) int {
+		return compareResources(a.resource, b.resource, kindOrder)
+	})
+
+	diffs := []string{}
+	for i, c := range changes {
+		d := c.diff
+		if c.resource.hook != nil {
+			// Show hook type and weight next to the resource name
+			d = strings.Replace(d, "</summary>", fmt.Sprintf(" (hook: %s, weight: %s)</summary>", c.resource.hook.types, c.resource.hook.weight), 1)
+		}
+		// The heading is attached to the first diff of each kind rather than
+		// added as its own entry, so Diffs still holds one entry per resource
+		if groupByKind && (i == 0 || changes[i-1].resource.Kind != c.resource.Kind) {
+			d = fmt.Sprintf("#### %s\n\n%s", c.resource.Kind, d)
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
 }
 
 // FormatAppDiff formats a single application's diff result as markdown
@@ -171,11 +353,49 @@ func FormatAppDiff(result *DiffResult) string {
 		result.AppInfo.StatusEmoji(), result.AppInfo.Status,
 		result.AppInfo.HealthEmoji(), result.AppInfo.Health)
 
+	// Capacity impact
+	if c := formatCapacity(result.Capacity); c != "" {
+		fmt.Fprintf(&sb, "**Capacity impact:** %s\n\n", c)
+	}
+
 	// ArgoCD link if available
 	if url := result.AppInfo.ArgoURL(); url != "" {
 		fmt.Fprintf(&sb, "[View in ArgoCD](%s)\n\n", url)
 	}
 
+	// RBAC summary
+	sb.WriteString(formatRBACChanges(result.RBACChanges))
+
+	// Deprecated and removed APIs
+	if len(result.Deprecations) > 0 {
+		sb.WriteString("**Deprecated APIs:**\n\n")
+		for _, d := range result.Deprecations {
+			sb.WriteString(formatDeprecation(d) + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	// Schema errors
+	if len(result.SchemaErrors) > 0 {
+		sb.WriteString("**Schema errors:**\n\n")
+		for _, e := range result.SchemaErrors {
+			fmt.Fprintf(&sb, "- ❗ `%s`: %s\n", e.Resource, e.Message)
+		}
+		sb.WriteString("\n")
+	}
+
+	// Policy violations
+	if len(result.Violations) > 0 {
+		sb.WriteString("**Policy violations:**\n\n")
+		for _, v := range result.Violations {
+			fmt.Fprintf(&sb, "- 🚫 `%s` violates `%s`: %s\n", v.Resource, v.Policy, v.Message)
+		}
+		sb.WriteString("\n")
+	}
+
+	// Resources another app renders or manages too
+	sb.WriteString(formatConflicts(result.Conflicts))
+
 	// Check if this is a deduplicated diff
 	if result.DuplicateOf != "" {
 		fmt.Fprintf(&sb, "_Same diff as `%s`_\n", result.DuplicateOf)
@@ -185,6 +405,15 @@ func FormatAppDiff(result *DiffResult) string {
 	// Diffs
 	sb.WriteString(strings.Join(result.Diffs, "\n\n"))
 
+	// Hooks
+	if len(result.HookDiffs) > 0 {
+		if len(result.Diffs) > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString("#### Hooks\n\n")
+		sb.WriteString(strings.Join(result.HookDiffs, "\n\n"))
+	}
+
 	return sb.String()
 }
 
@@ -199,9 +428,28 @@ func FormatReport(report *DiffReport) string {
 	fmt.Fprintf(&sb, "**%d** of **%d** applications have changes\n\n",
 		report.AppsWithDiffs, report.TotalApps)
 
+	// Capacity impact across all apps
+	var capacity Capacity
+	for _, r := range report.Results {
+		capacity = capacity.Add(r.Capacity)
+	}
+	if c := formatCapacity(capacity); c != "" {
+		fmt.Fprintf(&sb, "**Capacity impact:** %s\n\n", c)
+	}
+
 	// Timestamp
 	fmt.Fprintf(&sb, "_Generated at %s_\n\n", report.Timestamp)
 
+	// High-risk changes across all apps
+	if risks := formatRisks(report.Results); risks != "" {
+		sb.WriteString(risks)
+	}
+
+	// Image changes across all apps
+	if images := formatImageChanges(report.Results); images != "" {
+		sb.WriteString(images)
+	}
+
 	// Workflow identifier (for comment management)
 	fmt.Fprintf(&sb, "<!-- argocd-diff-workflow: %s -->\n\n", report.WorkflowName)
 
@@ -218,6 +466,21 @@ func FormatReport(report *DiffReport) string {
 	return sb.String()
 }
 
+// formatRisks renders the risk findings of all apps as a warning block,
+// or returns "" if there are none
+func formatRisks(results []*DiffResult) string {
+	var sb strings.Builder
+	for _, r := range results {
+		for _, f := range r.Risks {
+			fmt.Fprintf(&sb, "> - `%s`: `%s` %s\n", r.AppInfo.Name, f.Resource, f.Message)
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "> [!WARNING]\n> **High-risk changes**\n>\n" + sb.String() + "\n"
+}
+
 // computeDiffHash computes a SHA256 hash of the diffs for deduplication
 // The diffs are sorted before hashing to ensure consistent ordering
 func computeDiffHash(diffs []string) string {
@@ -245,7 +508,7 @@ func deduplicateResults(results []*DiffResult) {
 			continue
 		}
 
-		hash := computeDiffHash(r.Diffs)
+		hash := computeDiffHash(slices.Concat(r.Diffs, r.HookDiffs))
 		if originalApp, exists := diffHashToApp[hash]; exists {
 			// This is a duplicate - mark it
 			r.DuplicateOf = originalApp
@@ -264,9 +527,11 @@ func NewDiffReport(workflowName string, results []*DiffResult) *DiffReport {
 
 // NewDiffReportWithOptions creates a new diff report with metadata and options
 func NewDiffReportWithOptions(workflowName string, results []*DiffResult, dedupeDiffs bool) *DiffReport {
+	now := time.Now().UTC()
 	report := &DiffReport{
 		WorkflowName: workflowName,
-		Timestamp:    time.Now().UTC().Format("3:04PM MST, 2 Jan 2006"),
+		GeneratedAt:  now,
+		Timestamp:    now.Format("3:04PM MST, 2 Jan 2006"),
 		TotalApps:    len(results),
 		Results:      results,
 		DedupeDiffs:  dedupeDiffs,
@@ -332,6 +597,8 @@ func parseManifests(manifests []string) ([]*Resource, error) {
 			}
 
 			r.raw = doc
+			r.original = doc
+			r.syncOptions = parseSyncOptions(r.Metadata.Annotations)
 			resources = append(resources, &r)
 		}
 	}
@@ -370,6 +637,45 @@ func filterHelmHooks(resources []*Resource) []*Resource {
 	return filtered
 }
 
+// hookInfoFor returns the hook type and weight of r, or nil if r is not a
+// hook. ArgoCD annotations take precedence, as ArgoCD ignores the Helm ones
+// when both are set.
+func hookInfoFor(r *Resource) *hookInfo {
+	annotations := r.Metadata.Annotations
+	info := &hookInfo{weight: "0"}
+	if t, ok := annotations[argocdHookAnnotation]; ok {
+		info.types = t
+		if w, ok := annotations[argocdSyncWaveAnnotation]; ok {
+			info.weight = w
+		}
+		return info
+	}
+	if t, ok := annotations[helmHookAnnotation]; ok {
+		info.types = t
+		if w, ok := annotations[helmHookWeightAnnotation]; ok {
+			info.weight = w
+		}
+		return info
+	}
+	return nil
+}
+
+// splitHooks separates Helm and ArgoCD hooks from regular resources. The
+// hook info is recorded before metadata filtering can strip the annotations.
+func splitHooks(resources []*Resource) (regular, hooks []*Resource) {
+	for _, r := range resources {
+		info := hookInfoFor(r)
+		if info == nil {
+			regular = append(regular, r)
+			continue
+		}
+		hook := *r
+		hook.hook = info
+		hooks = append(hooks, &hook)
+	}
+	return regular, hooks
+}
+
 // argocdTrackingPrefix is the prefix for ArgoCD tracking labels and annotations
 const argocdTrackingPrefix = "argocd.argoproj.io/"
 
@@ -434,17 +740,13 @@ func filterMetadata(resources []*Resource, patterns []string) []*Resource {
 		}
 
 		// Create new resource with filtered raw content
-		newResource := &Resource{
-			APIVersion: r.APIVersion,
-			Kind:       r.Kind,
-			Metadata:   r.Metadata,
-			raw:        strings.TrimSpace(buf.String()),
-		}
+		newResource := *r
+		newResource.raw = strings.TrimSpace(buf.String())
 		// Also filter the in-memory metadata
 		newResource.Metadata.Labels = filterMapByPatterns(r.Metadata.Labels, patterns)
 		newResource.Metadata.Annotations = filterMapByPatterns(r.Metadata.Annotations, patterns)
 
-		filtered = append(filtered, newResource)
+		filtered = append(filtered, &newResource)
 	}
 	return filtered
 }
@@ -485,6 +787,14 @@ func filterMapByPatterns(m map[string]string, patterns []string) map[string]stri
 	return result
 }
 
+// text returns the text a diff of the resource renders
+func (r *Resource) text() string {
+	if r.display != "" {
+		return r.display
+	}
+	return r.raw
+}
+
 // key returns a unique key for the resource
 func (r *Resource) key() string {
 	if r.Metadata.Namespace != "" {
@@ -493,31 +803,53 @@ func (r *Resource) key() string {
 	return fmt.Sprintf("%s/%s/%s", r.APIVersion, r.Kind, r.Metadata.identity())
 }
 
-// generateResourceDiff generates a unified diff for a single resource
-func generateResourceDiff(base, head *Resource) string {
-	// Generate line-based unified diff
-	baseLines := strings.Split(base.raw, "\n")
-	headLines := strings.Split(head.raw, "\n")
+// diffFilename returns the file name used in unified diff headers
+func diffFilename(r *Resource) string {
+	if r.Metadata.Namespace == "" {
+		return fmt.Sprintf("%s_%s.yaml", r.Metadata.Name, r.Kind)
+	}
+	return fmt.Sprintf("%s_%s_%s.yaml", r.Metadata.Namespace, r.Metadata.Name, r.Kind)
+}
 
-	// Create filename for the diff header
-	filename := fmt.Sprintf("%s_%s_%s.yaml",
-		base.Metadata.Namespace, base.Metadata.Name, base.Kind)
-	if base.Metadata.Namespace == "" {
-		filename = fmt.Sprintf("%s_%s.yaml", base.Metadata.Name, base.Kind)
+// unifiedResourceDiff generates a unified diff for a single resource, cut
+// off after maxLines lines (0 = no limit). Reports whether it was cut off.
+func unifiedResourceDiff(base, head *Resource, maxLines int) (string, bool) {
+	// Render the normalized text, unless normalization hides the change
+	// (e.g. only keys were reordered), in which case the original is shown
+	baseText, headText := base.text(), head.text()
+	if baseText == headText {
+		baseText, headText = base.raw, head.raw
 	}
 
-	diff := generateUnifiedDiff(baseLines, headLines, filename, 3) // 3 lines of context
+	// Generate line-based unified diff
+	baseLines := strings.Split(baseText, "\n")
+	headLines := strings.Split(headText, "\n")
+	return limitedUnifiedDiff(baseLines, headLines, diffFilename(base), 3, maxLines) // 3 lines of context
+}
 
-	return fmt.Sprintf("<details open>\n<summary>===== %s =====</summary>\n\n```diff\n%s```\n</details>",
-		head.key(), diff)
+// truncatedNote tells below a diff block that the diff was cut off
+func truncatedNote(truncated bool, maxLines int) string {
+	if !truncated {
+		return ""
+	}
+	return fmt.Sprintf("\n_… diff truncated after %d lines_\n", maxLines)
 }
 
 // generateUnifiedDiff creates a unified diff between two sets of lines with context
 // Produces proper unified diff format with --- +++ headers and @@ hunk headers
-// Uses memory-efficient Myers diff algorithm instead of LCS table
+// Uses the linear-space Myers diff algorithm (see myers.go)
 func generateUnifiedDiff(oldLines, newLines []string, filename string, contextLines int) string {
-	// Use a more memory-efficient approach: stream-based diff with hash comparison
-	// First, quickly check if files are identical using a rolling comparison
+	diff, _ := limitedUnifiedDiff(oldLines, newLines, filename, contextLines, 0)
+	return diff
+}
+
+// limitedUnifiedDiff is generateUnifiedDiff with at most maxLines lines in
+// hunks (0 = no limit). Hunks beyond the limit are left out and the last
+// one shown is cut short, with its header counting only the lines shown,
+// so the result stays a valid unified diff. Reports whether lines were
+// left out.
+func limitedUnifiedDiff(oldLines, newLines []string, filename string, contextLines, maxLines int) (string, bool) {
+	// Quickly check if files are identical
 	if len(oldLines) == len(newLines) {
 		identical := true
 		for i := range oldLines {
@@ -527,151 +859,11 @@ func generateUnifiedDiff(oldLines, newLines []string, filename string, contextLi
 			}
 		}
 		if identical {
-			return ""
-		}
-	}
-
-	// Hash function for line comparison
-	hashLine := func(s string) uint64 {
-		var h uint64 = 14695981039346656037 // FNV-1a offset basis
-		for i := 0; i < len(s); i++ {
-			h ^= uint64(s[i])
-			h *= 1099511628211 // FNV-1a prime
-		}
-		return h
-	}
-
-	// Create hash maps for old and new lines
-	oldHashes := make(map[uint64][]int) // hash -> line numbers (0-based)
-	for i, line := range oldLines {
-		h := hashLine(line)
-		oldHashes[h] = append(oldHashes[h], i)
-	}
-
-	// Use patience diff-inspired approach: find unique matching lines as anchors
-	// This is more memory efficient than full LCS for large files
-	type match struct {
-		oldIdx int
-		newIdx int
-	}
-	var anchors []match
-
-	// Find matching lines (using hash, then verify)
-	usedOld := make(map[int]bool)
-	for newIdx, line := range newLines {
-		h := hashLine(line)
-		if oldIdxs, ok := oldHashes[h]; ok {
-			for _, oldIdx := range oldIdxs {
-				if !usedOld[oldIdx] && oldLines[oldIdx] == line {
-					anchors = append(anchors, match{oldIdx, newIdx})
-					usedOld[oldIdx] = true
-					break
-				}
-			}
+			return "", false
 		}
 	}
 
-	// Sort anchors by old index to get proper ordering
-	sort.Slice(anchors, func(i, j int) bool {
-		return anchors[i].oldIdx < anchors[j].oldIdx
-	})
-
-	// Find longest increasing subsequence of new indices (to handle reorders)
-	// This gives us the best matching sequence
-	var lis []match
-	if len(anchors) > 0 {
-		// Simple O(n²) LIS - good enough for reasonable anchor counts
-		dp := make([]int, len(anchors))
-		parent := make([]int, len(anchors))
-		for i := range dp {
-			dp[i] = 1
-			parent[i] = -1
-		}
-
-		maxLen, maxIdx := 1, 0
-		for i := 1; i < len(anchors); i++ {
-			for j := 0; j < i; j++ {
-				if anchors[j].newIdx < anchors[i].newIdx && dp[j]+1 > dp[i] {
-					dp[i] = dp[j] + 1
-					parent[i] = j
-				}
-			}
-			if dp[i] > maxLen {
-				maxLen = dp[i]
-				maxIdx = i
-			}
-		}
-
-		// Reconstruct LIS
-		lisIdxs := make([]int, maxLen)
-		for i, idx := maxLen-1, maxIdx; i >= 0; i-- {
-			lisIdxs[i] = idx
-			idx = parent[idx]
-		}
-		for _, idx := range lisIdxs {
-			lis = append(lis, anchors[idx])
-		}
-	}
-
-	// Generate diff lines from the matching sequence
-	type diffLine struct {
-		text    string
-		change  byte // ' ' = same, '-' = deleted, '+' = added
-		oldLine int  // 1-based line number in old file (0 if not applicable)
-		newLine int  // 1-based line number in new file (0 if not applicable)
-	}
-
-	var result []diffLine
-	oldIdx, newIdx := 0, 0
-
-	for _, m := range lis {
-		// Emit deletions from oldIdx to m.oldIdx
-		for oldIdx < m.oldIdx {
-			result = append(result, diffLine{
-				text:    oldLines[oldIdx],
-				change:  '-',
-				oldLine: oldIdx + 1,
-			})
-			oldIdx++
-		}
-		// Emit additions from newIdx to m.newIdx
-		for newIdx < m.newIdx {
-			result = append(result, diffLine{
-				text:    newLines[newIdx],
-				change:  '+',
-				newLine: newIdx + 1,
-			})
-			newIdx++
-		}
-		// Emit the matching line
-		result = append(result, diffLine{
-			text:    oldLines[oldIdx],
-			change:  ' ',
-			oldLine: oldIdx + 1,
-			newLine: newIdx + 1,
-		})
-		oldIdx++
-		newIdx++
-	}
-
-	// Emit remaining deletions
-	for oldIdx < len(oldLines) {
-		result = append(result, diffLine{
-			text:    oldLines[oldIdx],
-			change:  '-',
-			oldLine: oldIdx + 1,
-		})
-		oldIdx++
-	}
-	// Emit remaining additions
-	for newIdx < len(newLines) {
-		result = append(result, diffLine{
-			text:    newLines[newIdx],
-			change:  '+',
-			newLine: newIdx + 1,
-		})
-		newIdx++
-	}
+	result := myersDiff(oldLines, newLines)
 
 	// Check if there are any changes
 	hasChanges := false
@@ -682,7 +874,7 @@ func generateUnifiedDiff(oldLines, newLines []string, filename string, contextLi
 		}
 	}
 	if !hasChanges {
-		return ""
+		return "", false
 	}
 
 	// Generate unified diff output with proper headers and hunks
@@ -734,8 +926,17 @@ func generateUnifiedDiff(oldLines, newLines []string, filename string, contextLi
 		hunks = append(hunks, hunk{startIdx: hunkStart, endIdx: len(result) - 1})
 	}
 
-	// Output each hunk
+	// Output each hunk, up to the line limit
+	written, truncated := 0, false
 	for _, h := range hunks {
+		if maxLines > 0 && written+h.endIdx-h.startIdx+1 > maxLines {
+			h.endIdx = h.startIdx + maxLines - written - 1
+			truncated = true
+			if h.endIdx < h.startIdx {
+				break
+			}
+		}
+
 		// Calculate line numbers for hunk header
 		oldStart, oldCount := 0, 0
 		newStart, newCount := 0, 0
@@ -765,11 +966,12 @@ func generateUnifiedDiff(oldLines, newLines []string, filename string, contextLi
 			}
 		}
 
-		// Default to line 1 if we couldn't determine
-		if oldStart == 0 {
+		// Default to line 1 if we couldn't determine. An empty file (an
+		// added or deleted resource) is addressed as line 0.
+		if oldStart == 0 && len(oldLines) > 0 {
 			oldStart = 1
 		}
-		if newStart == 0 {
+		if newStart == 0 && len(newLines) > 0 {
 			newStart = 1
 		}
 
@@ -781,17 +983,69 @@ func generateUnifiedDiff(oldLines, newLines []string, filename string, contextLi
 			line := result[idx]
 			fmt.Fprintf(&buf, "%c%s\n", line.change, line.text)
 		}
+		written += h.endIdx - h.startIdx + 1
+		if truncated {
+			break
+		}
 	}
 
-	return buf.String()
+	return buf.String(), truncated
+}
+
+// DefaultKindOrder is the kind priority used to order resources when
+// DiffOptions.KindOrder is empty. It roughly follows the order in which the
+// resources would be applied: namespaces and CRDs first, then RBAC, then
+// configuration, then workloads. Kinds not listed sort after these,
+// alphabetically.
+var DefaultKindOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"ConfigMap",
+	"Secret",
+	"Deployment",
+	"StatefulSet",
+	"DaemonSet",
+	"ReplicaSet",
+	"Job",
+	"CronJob",
 }
 
-// SortResources sorts resources by kind and name for consistent ordering
+// kindRank returns the position of kind in order, or len(order) when the
+// kind is not listed
+func kindRank(kind string, order []string) int {
+	if i := slices.Index(order, kind); i >= 0 {
+		return i
+	}
+	return len(order)
+}
+
+// compareResources orders resources by kind priority, then kind, namespace,
+// name and finally the full key, so the result is fully deterministic
+func compareResources(a, b *Resource, order []string) int {
+	return cmp.Or(
+		cmp.Compare(kindRank(a.Kind, order), kindRank(b.Kind, order)),
+		cmp.Compare(a.Kind, b.Kind),
+		cmp.Compare(a.Metadata.Namespace, b.Metadata.Namespace),
+		cmp.Compare(a.Metadata.identity(), b.Metadata.identity()),
+		cmp.Compare(a.key(), b.key()),
+	)
+}
+
+// SortResources sorts resources by kind priority (see DefaultKindOrder) and
+// name for consistent ordering
 func SortResources(resources []*Resource) {
-	sort.Slice(resources, func(i, j int) bool {
-		if resources[i].Kind != resources[j].Kind {
-			return resources[i].Kind < resources[j].Kind
-		}
-		return resources[i].Metadata.Name < resources[j].Metadata.Name
+	SortResourcesWithOrder(resources, DefaultKindOrder)
+}
+
+// SortResourcesWithOrder sorts resources using a custom kind priority.
+// Kinds not present in order sort after the listed ones, alphabetically.
+func SortResourcesWithOrder(resources []*Resource, order []string) {
+	slices.SortStableFunc(resources, func(a, b *Resource) int {
+		return compareResources(a, b, order)
 	})
 }
@@ -1,6 +1,8 @@
 package diff
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 	"testing"
 
@@ -844,3 +846,448 @@ func TestGenerateDiffDetectsGenerateNameJobChange(t *testing.T) {
 		t.Errorf("ResourcesModified = %d, want 1", result.ResourcesModified)
 	}
 }
+
+func TestSortResourcesKindPriority(t *testing.T) {
+	resources := []*Resource{
+		{Kind: "Service", Metadata: ResourceMetadata{Name: "svc"}},
+		{Kind: "Deployment", Metadata: ResourceMetadata{Name: "deploy"}},
+		{Kind: "ConfigMap", Metadata: ResourceMetadata{Name: "cm"}},
+		{Kind: "ClusterRole", Metadata: ResourceMetadata{Name: "role"}},
+		{Kind: "CustomResourceDefinition", Metadata: ResourceMetadata{Name: "crd"}},
+		{Kind: "Namespace", Metadata: ResourceMetadata{Name: "ns"}},
+		{Kind: "Ingress", Metadata: ResourceMetadata{Name: "ing"}},
+	}
+
+	SortResources(resources)
+
+	want := []string{"Namespace", "CustomResourceDefinition", "ClusterRole", "ConfigMap", "Deployment", "Ingress", "Service"}
+	for i, kind := range want {
+		if resources[i].Kind != kind {
+			t.Errorf("resources[%d].Kind = %s, want %s", i, resources[i].Kind, kind)
+		}
+	}
+}
+
+func TestSortResourcesWithOrder(t *testing.T) {
+	resources := []*Resource{
+		{Kind: "Deployment", Metadata: ResourceMetadata{Name: "deploy"}},
+		{Kind: "Service", Metadata: ResourceMetadata{Name: "svc", Namespace: "b"}},
+		{Kind: "Service", Metadata: ResourceMetadata{Name: "svc", Namespace: "a"}},
+	}
+
+	SortResourcesWithOrder(resources, []string{"Service"})
+
+	if resources[0].Metadata.Namespace != "a" || resources[1].Metadata.Namespace != "b" {
+		t.Errorf("Services should sort first and by namespace, got %s/%s, %s/%s",
+			resources[0].Kind, resources[0].Metadata.Namespace, resources[1].Kind, resources[1].Metadata.Namespace)
+	}
+	if resources[2].Kind != "Deployment" {
+		t.Errorf("resources[2].Kind = %s, want Deployment", resources[2].Kind)
+	}
+}
+
+// manifestFor renders a minimal manifest for ordering tests
+func manifestFor(kind, name, data string) string {
+	return "apiVersion: v1\nkind: " + kind + "\nmetadata:\n  name: " + name + "\ndata:\n  key: " + data + "\n"
+}
+
+func TestGenerateDiffDeterministicOrder(t *testing.T) {
+	base := []string{
+		manifestFor("Service", "svc", "old"),
+		manifestFor("ConfigMap", "b-config", "old"),
+		manifestFor("ConfigMap", "a-config", "old"),
+		manifestFor("Secret", "deleted", "old"),
+	}
+	head := []string{
+		manifestFor("Service", "svc", "new"),
+		manifestFor("ConfigMap", "b-config", "new"),
+		manifestFor("ConfigMap", "a-config", "new"),
+		manifestFor("Namespace", "added", "new"),
+	}
+
+	wantOrder := []string{"v1/Namespace/added", "v1/ConfigMap/a-config", "v1/ConfigMap/b-config", "v1/Secret/deleted", "v1/Service/svc"}
+
+	// Map iteration is randomized, so repeat to catch nondeterminism
+	for range 10 {
+		result, err := GenerateDiff(base, head, &AppInfo{Name: "app"})
+		if err != nil {
+			t.Fatalf("GenerateDiff() error = %v", err)
+		}
+		if len(result.Diffs) != len(wantOrder) {
+			t.Fatalf("got %d diffs, want %d", len(result.Diffs), len(wantOrder))
+		}
+		for i, key := range wantOrder {
+			if !strings.Contains(result.Diffs[i], key) {
+				t.Fatalf("Diffs[%d] does not contain %q:\n%s", i, key, result.Diffs[i])
+			}
+		}
+	}
+}
+
+func TestGenerateDiffGroupByKind(t *testing.T) {
+	base := []string{
+		manifestFor("ConfigMap", "a", "old"),
+		manifestFor("ConfigMap", "b", "old"),
+		manifestFor("Service", "svc", "old"),
+	}
+	head := []string{
+		manifestFor("ConfigMap", "a", "new"),
+		manifestFor("ConfigMap", "b", "new"),
+		manifestFor("Service", "svc", "new"),
+	}
+
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, &DiffOptions{GroupByKind: true})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if len(result.Diffs) != 3 {
+		t.Fatalf("got %d diffs, want 3 (headings must not add entries)", len(result.Diffs))
+	}
+	if !strings.HasPrefix(result.Diffs[0], "#### ConfigMap\n") {
+		t.Errorf("first ConfigMap diff should carry the kind heading, got:\n%s", result.Diffs[0])
+	}
+	if strings.Contains(result.Diffs[1], "####") {
+		t.Errorf("second ConfigMap diff should not repeat the heading, got:\n%s", result.Diffs[1])
+	}
+	if !strings.HasPrefix(result.Diffs[2], "#### Service\n") {
+		t.Errorf("Service diff should carry the kind heading, got:\n%s", result.Diffs[2])
+	}
+}
+
+func TestGenerateUnifiedDiff(t *testing.T) {
+	oldLines := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	newLines := []string{"a", "b", "c", "d", "E", "f", "g", "h", "i", "j", "k"}
+
+	got := generateUnifiedDiff(oldLines, newLines, "test.yaml", 3)
+	want := "--- test.yaml\t+0000\n" +
+		"+++ test.yaml\t+0000\n" +
+		"@@ -2,9 +2,10 @@\n" +
+		" b\n c\n d\n-e\n+E\n f\n g\n h\n i\n j\n+k\n"
+	if got != want {
+		t.Errorf("generateUnifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := generateUnifiedDiff(oldLines, oldLines, "test.yaml", 3); got != "" {
+		t.Errorf("generateUnifiedDiff() of identical input = %q, want empty", got)
+	}
+}
+
+func TestMyersDiffMinimal(t *testing.T) {
+	tests := []struct {
+		name        string
+		old, new    string
+		wantChanges int
+	}{
+		{"identical", "abc", "abc", 0},
+		{"insert", "ac", "abc", 1},
+		{"delete", "abc", "ac", 1},
+		{"replace all", "abc", "xyz", 6},
+		{"empty old", "", "abc", 3},
+		{"empty new", "abc", "", 3},
+		{"classic myers example", "abcabba", "cbabac", 5},
+		{"moved block", "abcdef", "defabc", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldLines := strings.Split(tt.old, "")
+			newLines := strings.Split(tt.new, "")
+			script := myersDiff(oldLines, newLines)
+
+			changes := 0
+			var rebuiltOld, rebuiltNew []string
+			for _, l := range script {
+				if l.change != ' ' {
+					changes++
+				}
+				if l.change != '+' {
+					rebuiltOld = append(rebuiltOld, l.text)
+				}
+				if l.change != '-' {
+					rebuiltNew = append(rebuiltNew, l.text)
+				}
+			}
+			if changes != tt.wantChanges {
+				t.Errorf("edit distance = %d, want %d", changes, tt.wantChanges)
+			}
+			if strings.Join(rebuiltOld, "") != tt.old || strings.Join(rebuiltNew, "") != tt.new {
+				t.Errorf("edit script does not reproduce inputs: old=%q new=%q", strings.Join(rebuiltOld, ""), strings.Join(rebuiltNew, ""))
+			}
+		})
+	}
+}
+
+// largeConfigMap renders a ConfigMap with n data lines; every changeEvery-th
+// line gets the given suffix (changeEvery <= 0 leaves all lines unchanged)
+func largeConfigMap(n, changeEvery int, suffix string) string {
+	var sb strings.Builder
+	sb.WriteString("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: large\ndata:\n  config.yaml: |\n")
+	for i := range n {
+		fmt.Fprintf(&sb, "    key%d: value%d", i, i)
+		if changeEvery > 0 && i%changeEvery == 0 {
+			sb.WriteString(suffix)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func TestGenerateDiffTruncatesLargeResources(t *testing.T) {
+	base := []string{largeConfigMap(200, 0, "")}
+	head := []string{largeConfigMap(200, 50, "-changed")}
+
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, &DiffOptions{MaxDiffLines: 20})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if result.ResourcesModified != 1 {
+		t.Fatalf("ResourcesModified = %d, want 1", result.ResourcesModified)
+	}
+	if !strings.Contains(result.Diffs[0], "+    key50: value50-changed") {
+		t.Errorf("truncated diff should show the first changes, got:\n%s", result.Diffs[0])
+	}
+	if strings.Contains(result.Diffs[0], "key150: value150-changed") {
+		t.Error("truncated diff should leave out changes beyond the line limit")
+	}
+	if !strings.Contains(result.Diffs[0], "```\n\n_… diff truncated after 20 lines_\n</details>") {
+		t.Errorf("truncation should be noted below the diff block, got:\n%s", result.Diffs[0])
+	}
+	if c := result.Changes[0]; !c.Truncated || strings.Contains(c.Diff, "truncated") {
+		t.Errorf("Changes[0] Truncated = %v, Diff = %q, want a plain truncated diff", c.Truncated, c.Diff)
+	}
+
+	// Without a limit the full diff is rendered
+	result, err = GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, nil)
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if !strings.Contains(result.Diffs[0], "key150: value150-changed") || strings.Contains(result.Diffs[0], "truncated") {
+		t.Errorf("full diff should contain all changed lines, got:\n%s", result.Diffs[0])
+	}
+}
+
+func TestLimitedUnifiedDiff(t *testing.T) {
+	oldLines := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}
+	newLines := []string{"a", "x", "c", "d", "e", "f", "g", "h", "i", "j", "y", "l"}
+
+	got, truncated := limitedUnifiedDiff(oldLines, newLines, "test.yaml", 1, 3)
+	want := "--- test.yaml\t+0000\n+++ test.yaml\t+0000\n@@ -1,2 +1,2 @@\n a\n-b\n+x\n"
+	if got != want || !truncated {
+		t.Errorf("limitedUnifiedDiff() = %q, %v, want %q, true", got, truncated, want)
+	}
+
+	got, truncated = limitedUnifiedDiff(oldLines, newLines, "test.yaml", 1, 8)
+	if truncated || got != generateUnifiedDiff(oldLines, newLines, "test.yaml", 1) {
+		t.Errorf("limitedUnifiedDiff() within the limit = %q, %v, want the full diff", got, truncated)
+	}
+}
+
+func BenchmarkGenerateDiff(b *testing.B) {
+	base := []string{generateNameJob("v4.12.3"), `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-app
+  namespace: default
+spec:
+  replicas: 2
+`}
+	head := []string{generateNameJob("v6.0.1"), `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-app
+  namespace: default
+spec:
+  replicas: 3
+`}
+	appInfo := &AppInfo{Name: "bench"}
+
+	for b.Loop() {
+		if _, err := GenerateDiff(base, head, appInfo); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateUnifiedDiffLargeSparse(b *testing.B) {
+	oldLines := strings.Split(largeConfigMap(20000, 0, ""), "\n")
+	newLines := strings.Split(largeConfigMap(20000, 1000, "-changed"), "\n")
+
+	for b.Loop() {
+		generateUnifiedDiff(oldLines, newLines, "large.yaml", 3)
+	}
+}
+
+func BenchmarkGenerateUnifiedDiffLargeRewrite(b *testing.B) {
+	oldLines := strings.Split(largeConfigMap(5000, 0, ""), "\n")
+	newLines := strings.Split(largeConfigMap(5000, 1, "-changed"), "\n")
+
+	for b.Loop() {
+		generateUnifiedDiff(oldLines, newLines, "large.yaml", 3)
+	}
+}
+
+// helmHookJob renders a Helm pre-upgrade migration Job running image tag
+func helmHookJob(tag string) string {
+	return `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+    helm.sh/hook-weight: "-5"
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: app:` + tag + `
+`
+}
+
+func TestGenerateDiffSkipsHelmHooksByDefault(t *testing.T) {
+	base := []string{helmHookJob("v1")}
+	head := []string{helmHookJob("v2")}
+
+	result, err := GenerateDiff(base, head, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	if result.HasChanges {
+		t.Errorf("Helm hooks should be skipped unless included, got:\n%s", strings.Join(result.Diffs, "\n"))
+	}
+}
+
+func TestGenerateDiffIncludeHooks(t *testing.T) {
+	base := []string{helmHookJob("v1"), generateNameJob("v4.12.3"), manifestFor("ConfigMap", "cfg", "a")}
+	head := []string{helmHookJob("v2"), generateNameJob("v6.0.1"), manifestFor("ConfigMap", "cfg", "b")}
+
+	// Hook annotations must survive metadata filtering for the labels
+	opts := &DiffOptions{IncludeHooks: true, IgnoredMetadata: []string{"argocd.argoproj.io/", "helm.sh/"}}
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, opts)
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if result.ResourcesModified != 3 {
+		t.Errorf("ResourcesModified = %d, want 3", result.ResourcesModified)
+	}
+	if len(result.Diffs) != 1 || !strings.Contains(result.Diffs[0], "v1/ConfigMap/cfg") {
+		t.Fatalf("Diffs should only hold the ConfigMap, got %v", result.Diffs)
+	}
+	if len(result.HookDiffs) != 2 {
+		t.Fatalf("HookDiffs has %d entries, want 2", len(result.HookDiffs))
+	}
+	if !strings.Contains(result.HookDiffs[0], "batch/v1/Job/migrate ===== (hook: pre-install,pre-upgrade, weight: -5)</summary>") {
+		t.Errorf("Helm hook should be labelled with type and weight, got:\n%s", result.HookDiffs[0])
+	}
+	if !strings.Contains(result.HookDiffs[1], "(hook: PostSync, weight: 0)</summary>") {
+		t.Errorf("ArgoCD hook should be labelled with type and default weight, got:\n%s", result.HookDiffs[1])
+	}
+
+	output := FormatAppDiff(result)
+	cfgIdx := strings.Index(output, "v1/ConfigMap/cfg")
+	hooksIdx := strings.Index(output, "#### Hooks")
+	if hooksIdx < 0 || cfgIdx > hooksIdx {
+		t.Errorf("hooks should be rendered in their own section after the resources, got:\n%s", output)
+	}
+}
+
+func TestGenerateDiffOnlyHookChanges(t *testing.T) {
+	base := []string{manifestFor("ConfigMap", "cfg", "a")}
+	head := []string{manifestFor("ConfigMap", "cfg", "a"), helmHookJob("v1")}
+
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, &DiffOptions{IncludeHooks: true})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if !result.HasChanges || result.ResourcesAdded != 1 {
+		t.Fatalf("added hook should be reported, HasChanges = %v, ResourcesAdded = %d", result.HasChanges, result.ResourcesAdded)
+	}
+	if !strings.Contains(result.HookDiffs[0], "➕ Added: batch/v1/Job/migrate (hook: pre-install,pre-upgrade, weight: -5)") {
+		t.Errorf("unexpected hook diff:\n%s", result.HookDiffs[0])
+	}
+
+	output := FormatAppDiff(result)
+	if !strings.Contains(output, "#### Hooks\n\n<details>") {
+		t.Errorf("hooks section missing, got:\n%s", output)
+	}
+}
+
+// kindValidator reports one error for every resource of a kind
+type kindValidator string
+
+func (k kindValidator) Validate(obj map[string]any) []string {
+	if obj["kind"] == string(k) {
+		return []string{"spec.replica: unknown field"}
+	}
+	return nil
+}
+
+func TestSchemaErrors(t *testing.T) {
+	base := []string{manifestFor("ConfigMap", "unchanged", "a"), manifestFor("ConfigMap", "modified", "a"), manifestFor("ConfigMap", "deleted", "a")}
+	head := []string{manifestFor("ConfigMap", "unchanged", "a"), manifestFor("ConfigMap", "modified", "b"), manifestFor("ConfigMap", "added", "a")}
+
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, &DiffOptions{Schema: kindValidator("ConfigMap")})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+
+	// Only added and modified resources are validated
+	want := []SchemaError{
+		{Resource: "ConfigMap/added", Message: "spec.replica: unknown field"},
+		{Resource: "ConfigMap/modified", Message: "spec.replica: unknown field"},
+	}
+	if len(result.SchemaErrors) != len(want) {
+		t.Fatalf("SchemaErrors = %+v, want %+v", result.SchemaErrors, want)
+	}
+	for i := range want {
+		if result.SchemaErrors[i] != want[i] {
+			t.Errorf("SchemaErrors[%d] = %+v, want %+v", i, result.SchemaErrors[i], want[i])
+		}
+	}
+
+	output := FormatAppDiff(result)
+	if !strings.Contains(output, "**Schema errors:**\n\n- ❗ `ConfigMap/added`: spec.replica: unknown field\n") {
+		t.Errorf("output should list schema errors, got:\n%s", output)
+	}
+}
+
+// labelPolicy reports every resource without the team label
+type labelPolicy struct{}
+
+func (labelPolicy) Check(resources []map[string]any) []PolicyViolation {
+	var out []PolicyViolation
+	for _, obj := range resources {
+		metadata, _ := obj["metadata"].(map[string]any)
+		labels, _ := metadata["labels"].(map[string]any)
+		if _, ok := labels["team"]; !ok {
+			out = append(out, PolicyViolation{Policy: "has-team", Resource: fmt.Sprintf("%v/%v", obj["kind"], metadata["name"])})
+		}
+	}
+	return out
+}
+
+func TestPolicyViolationsIntroducedByHead(t *testing.T) {
+	labeled := func(name, data string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\n  labels:\n    team: web\ndata:\n  key: " + data + "\n"
+	}
+	base := []string{manifestFor("ConfigMap", "legacy", "a"), labeled("labeled", "a")}
+	head := []string{manifestFor("ConfigMap", "legacy", "b"), labeled("labeled", "b"), manifestFor("ConfigMap", "added", "a")}
+
+	// The ignored label is diffed away, but policies still see it
+	result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, &DiffOptions{
+		Policies:        labelPolicy{},
+		IgnoredMetadata: []string{"team"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+
+	// legacy violated the policy before the change already
+	want := []PolicyViolation{{Policy: "has-team", Resource: "ConfigMap/added"}}
+	if !slices.Equal(result.Violations, want) {
+		t.Errorf("Violations = %+v, want %+v", result.Violations, want)
+	}
+}
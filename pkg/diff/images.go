@@ -0,0 +1,93 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImageChange is a container whose image differs between base and head.
+// OldImage is empty for added containers, NewImage for removed ones.
+type ImageChange struct {
+	Workload  string // Kind/namespace/name of the workload
+	Container string
+	OldImage  string
+	NewImage  string
+}
+
+// imageChanges extracts container image changes from the pod templates of
+// changed workloads, in change order
+func imageChanges(changes []resourceChange) []ImageChange {
+	var out []ImageChange
+	for _, c := range changes {
+		before := containerImages(c.base)
+		after := containerImages(c.head)
+		if before == nil && after == nil {
+			continue // not a workload
+		}
+
+		workload := resourceName(c.resource)
+		for _, ct := range before {
+			newImage := imageOf(after, ct.name)
+			if newImage != ct.image {
+				out = append(out, ImageChange{Workload: workload, Container: ct.name, OldImage: ct.image, NewImage: newImage})
+			}
+		}
+		for _, ct := range after {
+			if imageOf(before, ct.name) == "" {
+				out = append(out, ImageChange{Workload: workload, Container: ct.name, NewImage: ct.image})
+			}
+		}
+	}
+	return out
+}
+
+// containerImages returns the containers of a workload's pod template, or
+// nil if r is nil or has no pod template
+func containerImages(r *Resource) []container {
+	if r == nil {
+		return nil
+	}
+	spec := podSpec(r.Kind, r.object())
+	if spec == nil {
+		return nil
+	}
+	return containers(spec)
+}
+
+// imageOf returns the image of the named container, or ""
+func imageOf(cs []container, name string) string {
+	for _, ct := range cs {
+		if ct.name == name {
+			return ct.image
+		}
+	}
+	return ""
+}
+
+// formatImageChanges renders the image changes of all apps as a table, or
+// returns "" if there are none
+func formatImageChanges(results []*DiffResult) string {
+	var rows strings.Builder
+	for _, r := range results {
+		for _, ic := range r.ImageChanges {
+			fmt.Fprintf(&rows, "| `%s` | %s | `%s` | `%s` | %s → %s |\n",
+				r.AppInfo.Name, codeOrDash(r.AppInfo.Cluster), ic.Workload, ic.Container,
+				codeOrDash(ic.OldImage), codeOrDash(ic.NewImage))
+		}
+	}
+	if rows.Len() == 0 {
+		return ""
+	}
+	return "### 🐳 Image changes\n\n" +
+		"| App | Cluster | Workload | Container | Image |\n" +
+		"|-----|---------|----------|-----------|-------|\n" +
+		rows.String() + "\n"
+}
+
+// codeOrDash formats s as inline code, or "-" if it is empty
+func codeOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return "`" + s + "`"
+}
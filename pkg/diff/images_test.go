@@ -0,0 +1,125 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func cronJob(image string) string {
+	return `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+  namespace: ops
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: ` + image + `
+`
+}
+
+func rollout(images ...string) string {
+	m := `
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: api
+  namespace: prod
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: ` + images[0] + `
+      containers:
+`
+	for i, image := range images[1:] {
+		m += "      - name: c" + strconv.Itoa(i) + "\n        image: " + image + "\n"
+	}
+	return m
+}
+
+func TestImageChanges(t *testing.T) {
+	base := []string{
+		deployment(1, "web:v1", ""),
+		cronJob("backup:1.0"),
+		rollout("migrate:v1", "api:v1", "sidecar:v1"),
+		manifestFor("ConfigMap", "cfg", "a"),
+	}
+	head := []string{
+		deployment(2, "web:v2", ""),
+		cronJob("backup:1.0"), // unchanged image
+		rollout("migrate:v2", "api:v1", "proxy:v1"),
+		manifestFor("ConfigMap", "cfg", "b"),
+	}
+
+	result, err := GenerateDiff(base, head, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+
+	want := []ImageChange{
+		{Workload: "Deployment/prod/web", Container: "app", OldImage: "web:v1", NewImage: "web:v2"},
+		{Workload: "Rollout/prod/api", Container: "migrate", OldImage: "migrate:v1", NewImage: "migrate:v2"},
+		{Workload: "Rollout/prod/api", Container: "c1", OldImage: "sidecar:v1", NewImage: "proxy:v1"},
+	}
+	if len(result.ImageChanges) != len(want) {
+		t.Fatalf("ImageChanges = %+v, want %+v", result.ImageChanges, want)
+	}
+	for i := range want {
+		if result.ImageChanges[i] != want[i] {
+			t.Errorf("ImageChanges[%d] = %+v, want %+v", i, result.ImageChanges[i], want[i])
+		}
+	}
+}
+
+func TestImageChangesAddedAndDeletedWorkloads(t *testing.T) {
+	result, err := GenerateDiff([]string{cronJob("backup:1.0")}, []string{deployment(1, "web:v1", "")}, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+
+	want := []ImageChange{
+		{Workload: "Deployment/prod/web", Container: "app", NewImage: "web:v1"},
+		{Workload: "CronJob/ops/backup", Container: "backup", OldImage: "backup:1.0"},
+	}
+	if len(result.ImageChanges) != len(want) {
+		t.Fatalf("ImageChanges = %+v, want %+v", result.ImageChanges, want)
+	}
+	for i := range want {
+		if result.ImageChanges[i] != want[i] {
+			t.Errorf("ImageChanges[%d] = %+v, want %+v", i, result.ImageChanges[i], want[i])
+		}
+	}
+}
+
+func TestFormatReportImageTable(t *testing.T) {
+	web, err := GenerateDiff([]string{deployment(1, "web:v1", "")}, []string{deployment(1, "web:v2", "")}, &AppInfo{Name: "web-prod", Cluster: "prod"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	backup, err := GenerateDiff(nil, []string{cronJob("backup:1.0")}, &AppInfo{Name: "backup"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+
+	output := FormatReport(NewDiffReport("ArgoCD Diff", []*DiffResult{web, backup}))
+	want := "### 🐳 Image changes\n\n" +
+		"| App | Cluster | Workload | Container | Image |\n" +
+		"|-----|---------|----------|-----------|-------|\n" +
+		"| `web-prod` | `prod` | `Deployment/prod/web` | `app` | `web:v1` → `web:v2` |\n" +
+		"| `backup` | - | `CronJob/ops/backup` | `backup` | - → `backup:1.0` |\n"
+	if !strings.Contains(output, want) {
+		t.Errorf("report should contain the image table %q, got:\n%s", want, output)
+	}
+	if strings.Index(output, "Image changes") > strings.Index(output, "### 📝") {
+		t.Error("image table should come before the app diffs")
+	}
+}
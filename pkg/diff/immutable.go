@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// syncOptionsAnnotation holds per-resource ArgoCD sync options
+const syncOptionsAnnotation = "argocd.argoproj.io/sync-options"
+
+// immutableFields lists, per kind, the spec paths the API server refuses to
+// update in place. Changing them requires deleting and recreating the resource.
+var immutableFields = map[string][][]string{
+	"Deployment":            {{"spec", "selector"}},
+	"ReplicaSet":            {{"spec", "selector"}},
+	"DaemonSet":             {{"spec", "selector"}},
+	"StatefulSet":           {{"spec", "selector"}, {"spec", "serviceName"}, {"spec", "podManagementPolicy"}, {"spec", "volumeClaimTemplates"}},
+	"Job":                   {{"spec", "selector"}, {"spec", "template"}, {"spec", "completionMode"}},
+	"Service":               {{"spec", "clusterIP"}},
+	"PersistentVolumeClaim": {{"spec", "storageClassName"}, {"spec", "accessModes"}, {"spec", "volumeMode"}, {"spec", "volumeName"}, {"spec", "selector"}},
+	"RoleBinding":           {{"roleRef"}},
+	"ClusterRoleBinding":    {{"roleRef"}},
+}
+
+// parseSyncOptions splits the sync-options annotation into its options
+func parseSyncOptions(annotations map[string]string) []string {
+	value, ok := annotations[syncOptionsAnnotation]
+	if !ok {
+		return nil
+	}
+	var opts []string
+	for opt := range strings.SplitSeq(value, ",") {
+		if opt = strings.TrimSpace(opt); opt != "" {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
+// immutableFieldChanges returns the immutable fields (as dotted paths) that
+// differ between base and head. Hooks are skipped, as ArgoCD and Helm
+// recreate them on every sync.
+func immutableFieldChanges(base, head *Resource) []string {
+	if head.hook != nil || head.Metadata.Name == "" {
+		return nil
+	}
+
+	baseObj, headObj := base.object(), head.object()
+	if baseObj == nil || headObj == nil {
+		return nil
+	}
+
+	var changed []string
+	for _, path := range immutableFields[head.Kind] {
+		if !reflect.DeepEqual(nestedValue(baseObj, path), nestedValue(headObj, path)) {
+			changed = append(changed, strings.Join(path, "."))
+		}
+	}
+
+	// ConfigMaps and Secrets marked immutable cannot change their data
+	if base.Kind == "ConfigMap" || base.Kind == "Secret" {
+		if immutable, _ := baseObj["immutable"].(bool); immutable {
+			for _, field := range []string{"data", "binaryData", "stringData"} {
+				if !reflect.DeepEqual(baseObj[field], headObj[field]) {
+					changed = append(changed, field)
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// nestedValue walks obj along path and returns the value found there
+func nestedValue(obj map[string]any, path []string) any {
+	parent := nestedMap(obj, path[:len(path)-1]...)
+	if parent == nil {
+		return nil
+	}
+	return parent[path[len(path)-1]]
+}
+
+// immutableWarning renders the note shown above the diff of a resource whose
+// immutable fields change, depending on its sync options
+func immutableWarning(fields, syncOptions []string) string {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = "`" + f + "`"
+	}
+	changed := strings.Join(quoted, ", ")
+
+	replace := slices.Contains(syncOptions, "Replace=true")
+	force := slices.Contains(syncOptions, "Force=true")
+	switch {
+	case replace && force:
+		return fmt.Sprintf("> ℹ️ **Immutable fields changed:** %s. `Force=true,Replace=true` is set, so the resource will be deleted and recreated.", changed)
+	case replace:
+		return fmt.Sprintf("> ⚠️ **Immutable fields changed:** %s. `Replace=true` is set, but without `Force=true` the replace is rejected as well and the sync will fail.", changed)
+	default:
+		return fmt.Sprintf("> ⚠️ **Immutable fields changed:** %s. The sync will fail unless the resource is recreated, e.g. with `%s: Force=true,Replace=true`.", changed, syncOptionsAnnotation)
+	}
+}
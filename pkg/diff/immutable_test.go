@@ -0,0 +1,142 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSyncOptions(t *testing.T) {
+	got := parseSyncOptions(map[string]string{syncOptionsAnnotation: "Force=true, Replace=true,"})
+	if want := []string{"Force=true", "Replace=true"}; !slices.Equal(got, want) {
+		t.Errorf("parseSyncOptions() = %v, want %v", got, want)
+	}
+	if got := parseSyncOptions(nil); got != nil {
+		t.Errorf("parseSyncOptions(nil) = %v, want nil", got)
+	}
+}
+
+func TestImmutableFieldChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		head string
+		want []string
+	}{
+		{
+			name: "deployment selector",
+			base: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1\n  selector:\n    matchLabels:\n      app: web",
+			head: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1\n  selector:\n    matchLabels:\n      app: web\n      tier: frontend",
+			want: []string{"spec.selector"},
+		},
+		{
+			name: "deployment replicas are mutable",
+			base: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 1",
+			head: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2",
+		},
+		{
+			name: "service cluster ip",
+			base: "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  clusterIP: 10.0.0.1",
+			head: "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  clusterIP: 10.0.0.2",
+			want: []string{"spec.clusterIP"},
+		},
+		{
+			name: "statefulset volume claim templates",
+			base: "apiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: db\nspec:\n  volumeClaimTemplates:\n  - metadata:\n      name: data\n    spec:\n      resources:\n        requests:\n          storage: 1Gi",
+			head: "apiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: db\nspec:\n  volumeClaimTemplates:\n  - metadata:\n      name: data\n    spec:\n      resources:\n        requests:\n          storage: 5Gi",
+			want: []string{"spec.volumeClaimTemplates"},
+		},
+		{
+			name: "pvc storage class, size is mutable",
+			base: "apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: data\nspec:\n  storageClassName: standard\n  resources:\n    requests:\n      storage: 1Gi",
+			head: "apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: data\nspec:\n  storageClassName: fast\n  resources:\n    requests:\n      storage: 2Gi",
+			want: []string{"spec.storageClassName"},
+		},
+		{
+			name: "immutable configmap data",
+			base: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\nimmutable: true\ndata:\n  a: \"1\"",
+			head: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\nimmutable: true\ndata:\n  a: \"2\"",
+			want: []string{"data"},
+		},
+		{
+			name: "mutable configmap data",
+			base: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\ndata:\n  a: \"1\"",
+			head: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\ndata:\n  a: \"2\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := parseManifests([]string{tt.base})
+			if err != nil {
+				t.Fatal(err)
+			}
+			head, err := parseManifests([]string{tt.head})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := immutableFieldChanges(base[0], head[0]); !slices.Equal(got, tt.want) {
+				t.Errorf("immutableFieldChanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// job renders a Job running image, with optional sync options
+func job(image, syncOptions string) string {
+	m := "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n"
+	if syncOptions != "" {
+		m += "  annotations:\n    argocd.argoproj.io/sync-options: " + syncOptions + "\n"
+	}
+	return m + "spec:\n  template:\n    spec:\n      containers:\n      - name: migrate\n        image: " + image + "\n"
+}
+
+func TestGenerateDiffImmutableWarning(t *testing.T) {
+	tests := []struct {
+		name        string
+		syncOptions string
+		want        string
+	}{
+		{"no sync options", "", "The sync will fail unless the resource is recreated"},
+		{"replace only", "Replace=true", "without `Force=true` the replace is rejected"},
+		{"force and replace", "Force=true,Replace=true", "the resource will be deleted and recreated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := []string{job("migrate:v1", tt.syncOptions)}
+			head := []string{job("migrate:v2", tt.syncOptions)}
+
+			// The annotation is honoured even when filtered from the diff
+			opts := &DiffOptions{IgnoredMetadata: []string{"argocd.argoproj.io/"}}
+			result, err := GenerateDiffWithOptions(base, head, &AppInfo{Name: "app"}, opts)
+			if err != nil {
+				t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+			}
+			if len(result.Diffs) != 1 {
+				t.Fatalf("got %d diffs, want 1", len(result.Diffs))
+			}
+			d := result.Diffs[0]
+			if !strings.HasPrefix(d, "> ") || !strings.Contains(d, "`spec.template`") || !strings.Contains(d, tt.want) {
+				t.Errorf("diff should start with a warning containing %q, got:\n%s", tt.want, d)
+			}
+			if !slices.Equal(result.Changes[0].ImmutableFields, []string{"spec.template"}) {
+				t.Errorf("ImmutableFields = %v", result.Changes[0].ImmutableFields)
+			}
+		})
+	}
+}
+
+func TestGenerateDiffImmutableSkipsHooks(t *testing.T) {
+	hook := func(image string) string {
+		return "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  annotations:\n    argocd.argoproj.io/hook: PreSync\nspec:\n  template:\n    spec:\n      containers:\n      - name: migrate\n        image: " + image + "\n"
+	}
+
+	result, err := GenerateDiffWithOptions([]string{hook("v1")}, []string{hook("v2")}, &AppInfo{Name: "app"}, &DiffOptions{IncludeHooks: true})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+	if len(result.HookDiffs) != 1 || strings.Contains(result.HookDiffs[0], "Immutable") {
+		t.Errorf("hooks are recreated on every sync and should not be flagged, got %v", result.HookDiffs)
+	}
+}
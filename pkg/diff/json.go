@@ -0,0 +1,236 @@
+package diff
+
+import (
+	_ "embed"
+	"encoding/json"
+	"time"
+)
+
+// ReportJSONVersion is the version of the JSON report layout. It is bumped
+// on incompatible changes; new optional fields do not change it, so the
+// schema must allow properties it does not list.
+const ReportJSONVersion = "v1"
+
+// ReportSchema is the JSON Schema describing JSONReport (report.schema.json)
+//
+//go:embed report.schema.json
+var ReportSchema []byte
+
+// JSONReport is the machine-readable form of a DiffReport
+type JSONReport struct {
+	Version       string        `json:"version"`
+	WorkflowName  string        `json:"workflow_name"`
+	GeneratedAt   time.Time     `json:"generated_at"`
+	TotalApps     int           `json:"total_apps"`
+	AppsWithDiffs int           `json:"apps_with_diffs"`
+	Capacity      *JSONCapacity `json:"capacity,omitempty"`
+	Apps          []JSONApp     `json:"apps"`
+}
+
+// JSONApp is a single application in a JSONReport
+type JSONApp struct {
+	Name         string            `json:"name"`
+	Namespace    string            `json:"namespace"`
+	Cluster      string            `json:"cluster,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	Status       string            `json:"status"`
+	Health       string            `json:"health"`
+	HasChanges   bool              `json:"has_changes"`
+	Error        string            `json:"error,omitempty"`
+	DuplicateOf  string            `json:"duplicate_of,omitempty"`
+	Summary      JSONSummary       `json:"summary"`
+	Risks        []JSONRisk        `json:"risks,omitempty"`
+	Violations   []JSONViolation   `json:"policy_violations,omitempty"`
+	SchemaErrors []JSONSchemaError `json:"schema_errors,omitempty"`
+	Deprecated   []JSONDeprecation `json:"deprecated_apis,omitempty"`
+	RBAC         []JSONRBACChange  `json:"rbac_changes,omitempty"`
+	Conflicts    []JSONConflict    `json:"ownership_conflicts,omitempty"`
+	Images       []JSONImage       `json:"image_changes,omitempty"`
+	Capacity     *JSONCapacity     `json:"capacity,omitempty"`
+	Resources    []JSONResource    `json:"resources"`
+}
+
+// JSONRisk is a high-risk change flagged in a JSONApp
+type JSONRisk struct {
+	Rule     string `json:"rule"`
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+}
+
+// JSONViolation is a policy violation in a JSONApp
+type JSONViolation struct {
+	Policy   string `json:"policy"`
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+}
+
+// JSONRBACChange is a permission granted or revoked in a JSONApp
+type JSONRBACChange struct {
+	Resource   string `json:"resource"`
+	Granted    bool   `json:"granted"`
+	Permission string `json:"permission"`
+	Escalation string `json:"escalation,omitempty"`
+}
+
+// JSONConflict is a resource of a JSONApp that another app renders or
+// manages as well
+type JSONConflict struct {
+	Resource string `json:"resource"`
+	App      string `json:"app"`
+	Managed  bool   `json:"managed"`
+}
+
+// JSONDeprecation is a head resource in a JSONApp that uses a deprecated or
+// removed API
+type JSONDeprecation struct {
+	Resource     string `json:"resource"`
+	APIVersion   string `json:"api_version"`
+	Kind         string `json:"kind"`
+	DeprecatedIn string `json:"deprecated_in"`
+	RemovedIn    string `json:"removed_in"`
+	Replacement  string `json:"replacement,omitempty"`
+	Removed      bool   `json:"removed"`
+}
+
+// JSONSchemaError is a schema error of a resource in a JSONApp
+type JSONSchemaError struct {
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+}
+
+// JSONImage is a container image change in a JSONApp
+type JSONImage struct {
+	Workload  string `json:"workload"`
+	Container string `json:"container"`
+	OldImage  string `json:"old_image,omitempty"`
+	NewImage  string `json:"new_image,omitempty"`
+}
+
+// JSONCapacity is a change in CPU and memory requests and limits,
+// multiplied by replicas
+type JSONCapacity struct {
+	CPURequests    int64 `json:"cpu_requests_millicores"`
+	CPULimits      int64 `json:"cpu_limits_millicores"`
+	MemoryRequests int64 `json:"memory_requests_bytes"`
+	MemoryLimits   int64 `json:"memory_limits_bytes"`
+}
+
+// newJSONCapacity returns nil for an unchanged capacity, so it is omitted
+func newJSONCapacity(c Capacity) *JSONCapacity {
+	if c.IsZero() {
+		return nil
+	}
+	jc := JSONCapacity(c)
+	return &jc
+}
+
+// JSONSummary holds the resource change counts of an application
+type JSONSummary struct {
+	Added    int `json:"added"`
+	Modified int `json:"modified"`
+	Deleted  int `json:"deleted"`
+}
+
+// JSONResource is a single changed resource in a JSONApp
+type JSONResource struct {
+	Change    ChangeType `json:"change"`
+	Group     string     `json:"group"`
+	Version   string     `json:"version"`
+	Kind      string     `json:"kind"`
+	Namespace string     `json:"namespace,omitempty"`
+	Name      string     `json:"name"`
+	Hook      bool       `json:"hook,omitempty"`
+	Diff      string     `json:"diff"`
+	Truncated bool       `json:"diff_truncated,omitempty"`
+
+	ImmutableFields []string `json:"immutable_fields,omitempty"`
+	SyncOptions     []string `json:"sync_options,omitempty"`
+	Prune           Prune    `json:"prune,omitempty"`
+}
+
+// NewJSONReport converts a DiffReport to its machine-readable form.
+// Resources are listed for duplicates too, so consumers do not have to
+// follow duplicate_of to find them.
+func NewJSONReport(report *DiffReport) *JSONReport {
+	out := &JSONReport{
+		Version:       ReportJSONVersion,
+		WorkflowName:  report.WorkflowName,
+		GeneratedAt:   report.GeneratedAt,
+		TotalApps:     report.TotalApps,
+		AppsWithDiffs: report.AppsWithDiffs,
+		Apps:          make([]JSONApp, 0, len(report.Results)),
+	}
+
+	var total Capacity
+
+	for _, r := range report.Results {
+		app := JSONApp{
+			HasChanges:  r.HasChanges,
+			Error:       r.ErrorMessage,
+			DuplicateOf: r.DuplicateOf,
+			Summary: JSONSummary{
+				Added:    r.ResourcesAdded,
+				Modified: r.ResourcesModified,
+				Deleted:  r.ResourcesDeleted,
+			},
+			Capacity:  newJSONCapacity(r.Capacity),
+			Resources: make([]JSONResource, 0, len(r.Changes)),
+		}
+		total = total.Add(r.Capacity)
+		if r.AppInfo != nil {
+			app.Name = r.AppInfo.Name
+			app.Namespace = r.AppInfo.Namespace
+			app.Cluster = r.AppInfo.Cluster
+			app.URL = r.AppInfo.ArgoURL()
+			app.Status = r.AppInfo.Status
+			app.Health = r.AppInfo.Health
+		}
+		for _, f := range r.Risks {
+			app.Risks = append(app.Risks, JSONRisk(f))
+		}
+		for _, v := range r.Violations {
+			app.Violations = append(app.Violations, JSONViolation(v))
+		}
+		for _, e := range r.SchemaErrors {
+			app.SchemaErrors = append(app.SchemaErrors, JSONSchemaError(e))
+		}
+		for _, c := range r.RBACChanges {
+			app.RBAC = append(app.RBAC, JSONRBACChange(c))
+		}
+		for _, c := range r.Conflicts {
+			app.Conflicts = append(app.Conflicts, JSONConflict(c))
+		}
+		for _, d := range r.Deprecations {
+			app.Deprecated = append(app.Deprecated, JSONDeprecation(d))
+		}
+		for _, ic := range r.ImageChanges {
+			app.Images = append(app.Images, JSONImage(ic))
+		}
+		for _, c := range r.Changes {
+			app.Resources = append(app.Resources, JSONResource{
+				Change:    c.Type,
+				Group:     c.Group,
+				Version:   c.Version,
+				Kind:      c.Kind,
+				Namespace: c.Namespace,
+				Name:      c.Name,
+				Hook:      c.Hook,
+				Diff:      c.Diff,
+				Truncated: c.Truncated,
+
+				ImmutableFields: c.ImmutableFields,
+				SyncOptions:     c.SyncOptions,
+				Prune:           c.Prune,
+			})
+		}
+		out.Apps = append(out.Apps, app)
+	}
+	out.Capacity = newJSONCapacity(total)
+
+	return out
+}
+
+// FormatReportJSON formats a complete diff report as JSON
+func FormatReportJSON(report *DiffReport) ([]byte, error) {
+	return json.MarshalIndent(NewJSONReport(report), "", "  ")
+}
@@ -0,0 +1,195 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFormatReportJSON(t *testing.T) {
+	base := []string{manifestFor("ConfigMap", "cfg", "a"), manifestFor("Secret", "old", "x")}
+	head := []string{manifestFor("ConfigMap", "cfg", "b"), manifestFor("Service", "svc", "y")}
+
+	appInfo := &AppInfo{Name: "app", Namespace: "argocd", Server: "https://argocd.example.com", Status: "OutOfSync", Health: "Healthy"}
+	result, err := GenerateDiff(base, head, appInfo)
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	dup, err := GenerateDiff(base, head, &AppInfo{Name: "app-copy", Status: "Synced", Health: "Healthy"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	failed := &DiffResult{AppInfo: &AppInfo{Name: "broken"}, ErrorMessage: "Failed to get base manifests: boom"}
+
+	report := NewDiffReport("ArgoCD Diff", []*DiffResult{result, dup, failed})
+	data, err := FormatReportJSON(report)
+	if err != nil {
+		t.Fatalf("FormatReportJSON() error = %v", err)
+	}
+
+	var got JSONReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal report: %v", err)
+	}
+	if got.Version != ReportJSONVersion || got.TotalApps != 3 || got.AppsWithDiffs != 2 || len(got.Apps) != 3 {
+		t.Fatalf("unexpected report header: %+v", got)
+	}
+
+	app := got.Apps[0]
+	if app.URL != "https://argocd.example.com/applications/argocd/app" || app.Status != "OutOfSync" {
+		t.Errorf("unexpected app info: %+v", app)
+	}
+	if app.Summary != (JSONSummary{Added: 1, Modified: 1, Deleted: 1}) {
+		t.Errorf("Summary = %+v", app.Summary)
+	}
+
+	// Resources follow the comment order
+	want := []struct {
+		change ChangeType
+		kind   string
+		name   string
+	}{
+		{ChangeModified, "ConfigMap", "cfg"},
+		{ChangeDeleted, "Secret", "old"},
+		{ChangeAdded, "Service", "svc"},
+	}
+	if len(app.Resources) != len(want) {
+		t.Fatalf("got %d resources, want %d", len(app.Resources), len(want))
+	}
+	for i, w := range want {
+		r := app.Resources[i]
+		if r.Change != w.change || r.Kind != w.kind || r.Name != w.name || r.Group != "" || r.Version != "v1" {
+			t.Errorf("Resources[%d] = %+v, want %s %s/%s", i, r, w.change, w.kind, w.name)
+		}
+		if strings.Contains(r.Diff, "<details") || !strings.HasPrefix(r.Diff, "--- ") {
+			t.Errorf("Resources[%d].Diff should be a plain unified diff, got:\n%s", i, r.Diff)
+		}
+	}
+	if !strings.Contains(app.Resources[2].Diff, "@@ -0,0 +1,") {
+		t.Errorf("added resource diff should start from an empty file, got:\n%s", app.Resources[2].Diff)
+	}
+
+	if got.Apps[1].DuplicateOf != "app" || len(got.Apps[1].Resources) != 3 {
+		t.Errorf("duplicate should link to the original and keep its resources: %+v", got.Apps[1])
+	}
+	if got.Apps[2].Error == "" || got.Apps[2].HasChanges {
+		t.Errorf("failed app should carry its error: %+v", got.Apps[2])
+	}
+}
+
+func TestResourceChangeGroupVersion(t *testing.T) {
+	base := []string{"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: prod\nspec:\n  replicas: 1"}
+	head := []string{"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: prod\nspec:\n  replicas: 2"}
+
+	result, err := GenerateDiff(base, head, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	if len(result.Changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(result.Changes))
+	}
+	c := result.Changes[0]
+	if c.Group != "apps" || c.Version != "v1" || c.Kind != "Deployment" || c.Namespace != "prod" || c.Name != "web" {
+		t.Errorf("unexpected change: %+v", c)
+	}
+}
+
+// TestReportSchemaMatchesJSON keeps report.schema.json in sync with the
+// JSON types: every emitted field must be declared, and every required
+// field must be emitted.
+func TestReportSchemaMatchesJSON(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal(ReportSchema, &schema); err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+
+	// A fully populated report, so optional fields are emitted too
+	report := &JSONReport{
+		Version:      ReportJSONVersion,
+		WorkflowName: "ArgoCD Diff",
+		Capacity:     &JSONCapacity{MemoryLimits: -1 << 20},
+		Apps: []JSONApp{{
+			Name:         "app",
+			URL:          "https://argocd.example.com/applications/argocd/app",
+			Error:        "error",
+			DuplicateOf:  "other",
+			Risks:        []JSONRisk{{Rule: RiskDeletePVC}},
+			Violations:   []JSONViolation{{Policy: "no-host-network"}},
+			SchemaErrors: []JSONSchemaError{{Resource: "Deployment/default/web", Message: "spec.replica: unknown field"}},
+			RBAC:         []JSONRBACChange{{Resource: "ClusterRole/admin", Granted: true, Escalation: "wildcard verbs"}},
+			Conflicts:    []JSONConflict{{Resource: "Service/default/web", App: "other", Managed: true}},
+			Deprecated:   []JSONDeprecation{{Kind: "CronJob", Replacement: "batch/v1", Removed: true}},
+			Images:       []JSONImage{{Workload: "Deployment/web", OldImage: "app:v1", NewImage: "app:v2"}},
+			Cluster:      "in-cluster",
+			Capacity:     &JSONCapacity{CPURequests: 500},
+			Resources: []JSONResource{{
+				Change:    ChangeAdded,
+				Namespace: "default",
+				Hook:      true,
+				Truncated: true,
+
+				ImmutableFields: []string{"spec.selector"},
+				SyncOptions:     []string{"Replace=true"},
+				Prune:           PruneOrphaned,
+			}},
+		}},
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("marshal report: %v", err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("unmarshal report: %v", err)
+	}
+
+	checkSchema(t, schema, schema, doc, "$")
+}
+
+// checkSchema checks the properties, required fields and enums of value
+// against node, recursing into objects and arrays
+func checkSchema(t *testing.T, root, node map[string]any, value any, path string) {
+	t.Helper()
+
+	if ref, ok := node["$ref"].(string); ok {
+		defs := root["$defs"].(map[string]any)
+		node = defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+	}
+
+	if enum, ok := node["enum"].([]any); ok && !slices.Contains(enum, value) {
+		t.Errorf("%s: %v is not one of %v", path, value, enum)
+	}
+	if c, ok := node["const"]; ok && c != value {
+		t.Errorf("%s: %v, want %v", path, value, c)
+	}
+
+	if extra, ok := node["additionalProperties"]; ok && extra == false {
+		t.Errorf("%s: the schema must allow additional properties, since new optional fields keep the version", path)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := node["properties"].(map[string]any)
+		for key, field := range v {
+			sub, ok := props[key].(map[string]any)
+			if !ok {
+				t.Errorf("%s.%s is not declared in the schema", path, key)
+				continue
+			}
+			checkSchema(t, root, sub, field, path+"."+key)
+		}
+		required, _ := node["required"].([]any)
+		for _, key := range required {
+			if _, ok := v[key.(string)]; !ok {
+				t.Errorf("%s.%s is required by the schema but missing", path, key)
+			}
+		}
+	case []any:
+		items, _ := node["items"].(map[string]any)
+		for i, item := range v {
+			checkSchema(t, root, items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
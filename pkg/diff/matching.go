@@ -0,0 +1,76 @@
+package diff
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"github.com/tamcore/argo-diff/pkg/matcher"
+)
+
+// maxMatchDetailRows bounds the matching details table; in a monorepo every
+// app tracks the repository and would be a near miss
+const maxMatchDetailRows = 50
+
+// FormatMatchDetails renders why the matched apps were affected and why the
+// near misses (see matcher.Explanation.NearMiss) were not, as a collapsed
+// section to append to the report. Apps that do not track the repository
+// are only counted.
+func FormatMatchDetails(explanations []*matcher.Explanation) string {
+	var rows []string
+	matched, nearMisses, others := 0, 0, 0
+	for _, e := range explanations {
+		switch {
+		case e.Matched():
+			matched++
+			rows = append(rows, fmt.Sprintf("| `%s` | ✅ matched | %s | %s |",
+				e.App.Name, e.MatchReason, codeList(e.MatchedPaths)))
+		case e.NearMiss():
+			nearMisses++
+			detail := "source paths: " + codeList(e.SourcePaths)
+			switch e.ExcludedReason {
+			case matcher.ExcludedClusterFilter:
+				detail = "cluster: " + codeList([]string{e.Cluster})
+			case matcher.ExcludedProjectPolicy:
+				detail = "project: " + codeList([]string{cmp.Or(e.App.Spec.Project, "default")})
+			}
+			rows = append(rows, fmt.Sprintf("| `%s` | ⏭️ excluded | %s | %s |",
+				e.App.Name, e.ExcludedReason, detail))
+		default:
+			others++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n\n<details>\n<summary>🔍 Matching details: %d matched, %d near misses, %d other apps</summary>\n\n",
+		matched, nearMisses, others)
+	if len(rows) > 0 {
+		sb.WriteString("| Application | Result | Reason | Paths |\n|---|---|---|---|\n")
+		for i, row := range rows {
+			if i == maxMatchDetailRows {
+				fmt.Fprintf(&sb, "\n_…and %d more_\n", len(rows)-maxMatchDetailRows)
+				break
+			}
+			sb.WriteString(row + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "Apps whose sources do not track the repository (%s) are not listed. ", matcher.ExcludedRepoMismatch)
+	sb.WriteString("Apps the ArgoCD token may not see, e.g. because of project roles, are never considered.\n</details>")
+	return sb.String()
+}
+
+// codeList renders paths as inline code, with "" as the repository root
+func codeList(paths []string) string {
+	if len(paths) == 0 {
+		return "-"
+	}
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		if p == "" {
+			p = "/"
+		}
+		quoted[i] = "`" + strings.ReplaceAll(p, "|", `\|`) + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
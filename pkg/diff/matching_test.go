@@ -0,0 +1,67 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tamcore/argo-diff/pkg/matcher"
+)
+
+func explanationApp(name, repoURL, path, cluster string) *appv1.Application {
+	return &appv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: appv1.ApplicationSpec{
+			Source:      &appv1.ApplicationSource{RepoURL: repoURL, Path: path},
+			Destination: appv1.ApplicationDestination{Name: cluster},
+		},
+	}
+}
+
+func TestFormatMatchDetails(t *testing.T) {
+	apps := []*appv1.Application{
+		explanationApp("web", "https://github.com/org/repo", "apps/web", "prod"),
+		explanationApp("api", "https://github.com/org/repo", "apps/api", "prod"),
+		explanationApp("web-staging", "https://github.com/org/repo", "apps/web", "staging"),
+		explanationApp("unrelated", "https://github.com/org/other", "apps/web", "prod"),
+		explanationApp("web-locked", "https://github.com/org/repo", "apps/web", "prod"),
+	}
+	apps[4].Spec.Project = "locked"
+	projects := matcher.Projects{"locked": {Spec: appv1.AppProjectSpec{SourceRepos: []string{"https://github.com/org/other"}}}}
+	explanations := matcher.ExplainMatches(apps, "org/repo", []string{"apps/web/values.yaml"}, []string{"prod"}, projects)
+
+	got := FormatMatchDetails(explanations)
+	for _, want := range []string{
+		"<summary>🔍 Matching details: 1 matched, 3 near misses, 1 other apps</summary>",
+		"| `web` | ✅ matched | source path match | `apps/web/values.yaml` |",
+		"| `api` | ⏭️ excluded | path mismatch | source paths: `apps/api` |",
+		"| `web-staging` | ⏭️ excluded | destination cluster filter | cluster: `staging` |",
+		"| `web-locked` | ⏭️ excluded | project policy | project: `locked` |",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("FormatMatchDetails() missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "unrelated") {
+		t.Errorf("apps not tracking the repository should only be counted:\n%s", got)
+	}
+}
+
+func TestFormatMatchDetailsLimitsRows(t *testing.T) {
+	var apps []*appv1.Application
+	for i := range maxMatchDetailRows + 5 {
+		apps = append(apps, explanationApp(fmt.Sprintf("app-%d", i), "https://github.com/org/repo", fmt.Sprintf("apps/%d", i), "prod"))
+	}
+	explanations := matcher.ExplainMatches(apps, "org/repo", []string{"docs/README.md"}, nil, nil)
+
+	got := FormatMatchDetails(explanations)
+	if strings.Count(got, "| path mismatch |") != maxMatchDetailRows {
+		t.Errorf("expected %d rows, got %d", maxMatchDetailRows, strings.Count(got, "| path mismatch |"))
+	}
+	if !strings.Contains(got, "_…and 5 more_") {
+		t.Errorf("missing truncation note in:\n%s", got)
+	}
+}
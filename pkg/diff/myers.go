@@ -0,0 +1,197 @@
+package diff
+
+// diffLine is a single line of an edit script
+type diffLine struct {
+	text    string
+	change  byte // ' ' = same, '-' = deleted, '+' = added
+	oldLine int  // 1-based line number in old file (0 if not applicable)
+	newLine int  // 1-based line number in new file (0 if not applicable)
+}
+
+// myers computes a minimal line diff using Myers' O((N+M)D) algorithm in its
+// linear-space "middle snake" form: instead of keeping the full edit graph
+// (or an LCS table), each step bisects the problem at the middle of an
+// optimal path and recurses on both halves, so memory stays O(N+M).
+type myers struct {
+	a, b     []int  // interned lines, so comparisons are integer compares
+	removedA []bool // lines of a not present in the common subsequence
+	addedB   []bool // lines of b not present in the common subsequence
+}
+
+// myersDiff returns the edit script turning oldLines into newLines. Within a
+// changed block, deletions are emitted before additions.
+func myersDiff(oldLines, newLines []string) []diffLine {
+	ids := make(map[string]int, len(oldLines))
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+
+	m := &myers{
+		a:        intern(oldLines),
+		b:        intern(newLines),
+		removedA: make([]bool, len(oldLines)),
+		addedB:   make([]bool, len(newLines)),
+	}
+	m.compare(0, len(m.a), 0, len(m.b))
+
+	result := make([]diffLine, 0, max(len(oldLines), len(newLines)))
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && m.removedA[i]:
+			result = append(result, diffLine{text: oldLines[i], change: '-', oldLine: i + 1})
+			i++
+		case j < len(newLines) && m.addedB[j]:
+			result = append(result, diffLine{text: newLines[j], change: '+', newLine: j + 1})
+			j++
+		default:
+			result = append(result, diffLine{text: oldLines[i], change: ' ', oldLine: i + 1, newLine: j + 1})
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// compare marks the differences between a[aLo:aHi] and b[bLo:bHi]
+func (m *myers) compare(aLo, aHi, bLo, bHi int) {
+	// Common prefix and suffix are never part of the edit script
+	for aLo < aHi && bLo < bHi && m.a[aLo] == m.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && m.a[aHi-1] == m.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	if aLo == aHi || bLo == bHi {
+		m.markChanged(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	x, y := m.bisect(aLo, aHi, bLo, bHi)
+	// No common line, or a split that would not shrink the problem
+	if x < 0 || (x == aLo && y == bLo) || (x == aHi && y == bHi) {
+		m.markChanged(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	m.compare(aLo, x, bLo, y)
+	m.compare(x, aHi, y, bHi)
+}
+
+// markChanged marks a[aLo:aHi] as removed and b[bLo:bHi] as added
+func (m *myers) markChanged(aLo, aHi, bLo, bHi int) {
+	for i := aLo; i < aHi; i++ {
+		m.removedA[i] = true
+	}
+	for j := bLo; j < bHi; j++ {
+		m.addedB[j] = true
+	}
+}
+
+// bisect finds the middle snake of an optimal edit path through
+// a[aLo:aHi] x b[bLo:bHi] by running the greedy search forward from the start
+// and backward from the end until the two overlap. It returns the absolute
+// split point, or -1, -1 when the ranges have nothing in common.
+func (m *myers) bisect(aLo, aHi, bLo, bHi int) (int, int) {
+	n, k := aHi-aLo, bHi-bLo
+	maxD := (n + k + 1) / 2
+	vOffset := maxD
+	// Diagonals -maxD..maxD plus one slot either side for the k±1 lookups
+	vLength := 2*maxD + 2
+	v1 := make([]int, vLength)
+	v2 := make([]int, vLength)
+	for i := range v1 {
+		v1[i] = -1
+		v2[i] = -1
+	}
+	v1[vOffset+1] = 0
+	v2[vOffset+1] = 0
+
+	delta := n - k
+	// If the total number of lines is odd, the front path collides with the
+	// reverse path; otherwise the reverse path collides with the front one
+	front := delta%2 != 0
+
+	// Offsets for the start and end of the k loops, used to prune diagonals
+	// that run off the edge of the edit graph
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+
+	for d := range maxD {
+		// Walk the front path one step
+		for k1 := -d + k1start; k1 <= d-k1end; k1 += 2 {
+			k1Offset := vOffset + k1
+			var x1 int
+			if k1 == -d || (k1 != d && v1[k1Offset-1] < v1[k1Offset+1]) {
+				x1 = v1[k1Offset+1]
+			} else {
+				x1 = v1[k1Offset-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < k && m.a[aLo+x1] == m.b[bLo+y1] {
+				x1++
+				y1++
+			}
+			v1[k1Offset] = x1
+			switch {
+			case x1 > n:
+				k1end += 2 // ran off the right of the graph
+			case y1 > k:
+				k1start += 2 // ran off the bottom of the graph
+			case front:
+				k2Offset := vOffset + delta - k1
+				if k2Offset >= 0 && k2Offset < vLength && v2[k2Offset] != -1 {
+					// Mirror x2 onto the top-left coordinate system
+					if x2 := n - v2[k2Offset]; x1 >= x2 {
+						return aLo + x1, bLo + y1
+					}
+				}
+			}
+		}
+
+		// Walk the reverse path one step
+		for k2 := -d + k2start; k2 <= d-k2end; k2 += 2 {
+			k2Offset := vOffset + k2
+			var x2 int
+			if k2 == -d || (k2 != d && v2[k2Offset-1] < v2[k2Offset+1]) {
+				x2 = v2[k2Offset+1]
+			} else {
+				x2 = v2[k2Offset-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < k && m.a[aHi-x2-1] == m.b[bHi-y2-1] {
+				x2++
+				y2++
+			}
+			v2[k2Offset] = x2
+			switch {
+			case x2 > n:
+				k2end += 2 // ran off the left of the graph
+			case y2 > k:
+				k2start += 2 // ran off the top of the graph
+			case !front:
+				k1Offset := vOffset + delta - k2
+				if k1Offset >= 0 && k1Offset < vLength && v1[k1Offset] != -1 {
+					x1 := v1[k1Offset]
+					y1 := vOffset + x1 - k1Offset
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1
+					}
+				}
+			}
+		}
+	}
+
+	return -1, -1
+}
@@ -0,0 +1,148 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+)
+
+// ResourceID identifies a resource on a destination cluster, independent of
+// its API version
+type ResourceID struct {
+	Cluster   string
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// String returns the Kind/namespace/name of the resource
+func (id ResourceID) String() string {
+	if id.Namespace != "" {
+		return fmt.Sprintf("%s/%s/%s", id.Kind, id.Namespace, id.Name)
+	}
+	return fmt.Sprintf("%s/%s", id.Kind, id.Name)
+}
+
+// OwnershipConflict is a head resource of an app that another app renders
+// or manages as well
+type OwnershipConflict struct {
+	Resource string // Kind/namespace/name of the resource
+	App      string // the other application
+	Managed  bool   // the other app is not affected and already manages the resource
+}
+
+// clusterScopedKinds are kinds without a namespace, so they are not
+// defaulted to the app's destination namespace
+var clusterScopedKinds = []string{
+	"APIService",
+	"ClusterIssuer",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"CSIDriver",
+	"CSINode",
+	"CustomResourceDefinition",
+	"IngressClass",
+	"MutatingWebhookConfiguration",
+	"Namespace",
+	"PersistentVolume",
+	"PriorityClass",
+	"RuntimeClass",
+	"StorageClass",
+	"ValidatingAdmissionPolicy",
+	"ValidatingAdmissionPolicyBinding",
+	"ValidatingWebhookConfiguration",
+	"VolumeAttachment",
+}
+
+// resourceIDs returns the identities of resources as deployed by an app.
+// Resources with only a generateName get a new name on every sync and are
+// skipped.
+func resourceIDs(resources []*Resource, appInfo *AppInfo) []ResourceID {
+	var cluster, destNS string
+	if appInfo != nil {
+		cluster, destNS = appInfo.Cluster, appInfo.DestinationNamespace
+	}
+
+	var out []ResourceID
+	for _, r := range resources {
+		if r.Metadata.Name == "" {
+			continue
+		}
+		group := ""
+		if i := strings.LastIndex(r.APIVersion, "/"); i >= 0 {
+			group = r.APIVersion[:i]
+		}
+		ns := r.Metadata.Namespace
+		if ns == "" && !slices.Contains(clusterScopedKinds, r.Kind) {
+			ns = destNS
+		}
+		out = append(out, ResourceID{Cluster: cluster, Group: group, Kind: r.Kind, Namespace: ns, Name: r.Metadata.Name})
+	}
+	return out
+}
+
+// ManagedResources indexes the resources that ArgoCD reports as managed by
+// each application, by the names of the apps managing them
+func ManagedResources(apps []*appv1.Application) map[ResourceID][]string {
+	index := map[ResourceID][]string{}
+	for _, app := range apps {
+		cluster := NewAppInfo(app, "").Cluster
+		for _, res := range app.Status.Resources {
+			if res.Hook {
+				continue
+			}
+			id := ResourceID{Cluster: cluster, Group: res.Group, Kind: res.Kind, Namespace: res.Namespace, Name: res.Name}
+			index[id] = append(index[id], app.Name)
+		}
+	}
+	return index
+}
+
+// DetectOwnershipConflicts records in each result the head resources that
+// another result renders as well, or that managed (see ManagedResources)
+// lists for an application outside of results
+func DetectOwnershipConflicts(results []*DiffResult, managed map[ResourceID][]string) {
+	rendered := map[ResourceID][]string{}
+	for _, r := range results {
+		for _, id := range r.HeadResources {
+			rendered[id] = append(rendered[id], r.AppInfo.Name)
+		}
+	}
+
+	for _, r := range results {
+		r.Conflicts = nil
+		for _, id := range r.HeadResources {
+			for _, app := range rendered[id] {
+				if app != r.AppInfo.Name {
+					r.Conflicts = append(r.Conflicts, OwnershipConflict{Resource: id.String(), App: app})
+				}
+			}
+			for _, app := range managed[id] {
+				if app != r.AppInfo.Name {
+					r.Conflicts = append(r.Conflicts, OwnershipConflict{Resource: id.String(), App: app, Managed: true})
+				}
+			}
+		}
+	}
+}
+
+// formatConflicts renders ownership conflicts as a list
+func formatConflicts(conflicts []OwnershipConflict) string {
+	if len(conflicts) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("**Ownership conflicts:**\n\n")
+	for _, c := range conflicts {
+		if c.Managed {
+			fmt.Fprintf(&sb, "- ⚔️ `%s` is already managed by `%s`\n", c.Resource, c.App)
+		} else {
+			fmt.Fprintf(&sb, "- ⚔️ `%s` is also rendered by `%s`\n", c.Resource, c.App)
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
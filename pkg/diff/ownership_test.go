@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResourceIDs(t *testing.T) {
+	resources, err := parseManifests([]string{
+		manifestFor("ConfigMap", "cfg", "a"), // no namespace
+		`
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+`,
+		`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: other
+`,
+		`
+apiVersion: batch/v1
+kind: Job
+metadata:
+  generateName: migrate-
+`,
+	})
+	if err != nil {
+		t.Fatalf("parseManifests() error = %v", err)
+	}
+
+	got := resourceIDs(resources, &AppInfo{Cluster: "prod", DestinationNamespace: "default"})
+	want := []ResourceID{
+		{Cluster: "prod", Kind: "ConfigMap", Namespace: "default", Name: "cfg"},
+		{Cluster: "prod", Group: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "reader"},
+		{Cluster: "prod", Group: "apps", Kind: "Deployment", Namespace: "other", Name: "web"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("resourceIDs() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("resourceIDs()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDetectOwnershipConflicts(t *testing.T) {
+	generate := func(name, cluster string, manifests ...string) *DiffResult {
+		t.Helper()
+		result, err := GenerateDiff(nil, manifests, &AppInfo{Name: name, Cluster: cluster, DestinationNamespace: "default"})
+		if err != nil {
+			t.Fatalf("GenerateDiff() error = %v", err)
+		}
+		return result
+	}
+	a := generate("a", "prod", manifestFor("ConfigMap", "shared", "a"), manifestFor("ConfigMap", "only-a", "a"))
+	b := generate("b", "prod", manifestFor("ConfigMap", "shared", "b"))
+	c := generate("c", "staging", manifestFor("ConfigMap", "shared", "c")) // other cluster
+
+	managed := ManagedResources([]*appv1.Application{{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy"},
+		Spec: appv1.ApplicationSpec{
+			Destination: appv1.ApplicationDestination{Server: "https://prod.example.com", Name: "prod"},
+		},
+		Status: appv1.ApplicationStatus{Resources: []appv1.ResourceStatus{
+			{Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "only-a"},
+			{Group: "batch", Version: "v1", Kind: "Job", Namespace: "default", Name: "shared", Hook: true},
+		}},
+	}})
+
+	DetectOwnershipConflicts([]*DiffResult{a, b, c}, managed)
+
+	wantA := []OwnershipConflict{
+		{Resource: "ConfigMap/default/shared", App: "b"},
+		{Resource: "ConfigMap/default/only-a", App: "legacy", Managed: true},
+	}
+	if len(a.Conflicts) != len(wantA) {
+		t.Fatalf("a.Conflicts = %+v, want %+v", a.Conflicts, wantA)
+	}
+	for i := range wantA {
+		if a.Conflicts[i] != wantA[i] {
+			t.Errorf("a.Conflicts[%d] = %+v, want %+v", i, a.Conflicts[i], wantA[i])
+		}
+	}
+	if len(b.Conflicts) != 1 || b.Conflicts[0].App != "a" {
+		t.Errorf("b.Conflicts = %+v, want a conflict with a", b.Conflicts)
+	}
+	if len(c.Conflicts) != 0 {
+		t.Errorf("c.Conflicts = %+v, resources on other clusters do not conflict", c.Conflicts)
+	}
+
+	output := FormatAppDiff(a)
+	for _, want := range []string{
+		"**Ownership conflicts:**\n\n",
+		"- ⚔️ `ConfigMap/default/shared` is also rendered by `b`\n",
+		"- ⚔️ `ConfigMap/default/only-a` is already managed by `legacy`\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+}
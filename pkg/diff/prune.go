@@ -0,0 +1,46 @@
+package diff
+
+import "slices"
+
+// Prune describes what a sync does with a resource that is no longer
+// rendered
+type Prune string
+
+const (
+	PruneAutomatic Prune = "pruned"   // deleted by automated sync
+	PruneManual    Prune = "manual"   // deleted only by a sync with pruning enabled, or after confirmation
+	PruneOrphaned  Prune = "orphaned" // never deleted (Prune=false), stays in the cluster
+)
+
+// pruneBehavior returns how ArgoCD handles a deleted resource, from its
+// sync-options annotation and the app's sync policy. Hooks are not pruned
+// but cleaned up by their delete policy, so they get "".
+func pruneBehavior(r *Resource, app *AppInfo) Prune {
+	switch {
+	case r.hook != nil:
+		return ""
+	case slices.Contains(r.syncOptions, "Prune=false"):
+		return PruneOrphaned
+	case slices.Contains(r.syncOptions, "Prune=confirm"):
+		return PruneManual
+	case app != nil && app.AutoPrune:
+		return PruneAutomatic
+	}
+	return PruneManual
+}
+
+// pruneNote explains a prune behavior in the summary of a deleted resource
+func pruneNote(p Prune, syncOptions []string) string {
+	switch p {
+	case PruneAutomatic:
+		return " (pruned by automated sync)"
+	case PruneManual:
+		if slices.Contains(syncOptions, "Prune=confirm") {
+			return " (prune requires confirmation: `Prune=confirm`)"
+		}
+		return " (requires manual prune)"
+	case PruneOrphaned:
+		return " (not pruned: `Prune=false`, stays in the cluster)"
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+)
+
+func TestNewAppInfoAutoPrune(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name   string
+		policy *appv1.SyncPolicy
+		want   bool
+	}{
+		{"manual sync", nil, false},
+		{"automated without prune", &appv1.SyncPolicy{Automated: &appv1.SyncPolicyAutomated{}}, false},
+		{"automated with prune", &appv1.SyncPolicy{Automated: &appv1.SyncPolicyAutomated{Prune: true}}, true},
+		{"automation disabled", &appv1.SyncPolicy{Automated: &appv1.SyncPolicyAutomated{Prune: true, Enabled: &disabled}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &appv1.Application{}
+			app.Spec.SyncPolicy = tt.policy
+			if got := NewAppInfo(app, "").AutoPrune; got != tt.want {
+				t.Errorf("AutoPrune = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneBehavior(t *testing.T) {
+	withSyncOptions := func(opts string) string {
+		return `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cfg
+  annotations:
+    argocd.argoproj.io/sync-options: ` + opts + `
+`
+	}
+
+	tests := []struct {
+		name      string
+		manifest  string
+		autoPrune bool
+		want      Prune
+		note      string
+	}{
+		{"auto prune", manifestFor("ConfigMap", "cfg", "a"), true, PruneAutomatic, "(pruned by automated sync)"},
+		{"manual prune", manifestFor("ConfigMap", "cfg", "a"), false, PruneManual, "(requires manual prune)"},
+		{"prune disabled", withSyncOptions("Prune=false"), true, PruneOrphaned, "(not pruned: `Prune=false`, stays in the cluster)"},
+		{"prune confirm", withSyncOptions("PruneLast=true,Prune=confirm"), true, PruneManual, "(prune requires confirmation: `Prune=confirm`)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := GenerateDiff([]string{tt.manifest}, nil, &AppInfo{Name: "app", AutoPrune: tt.autoPrune})
+			if err != nil {
+				t.Fatalf("GenerateDiff() error = %v", err)
+			}
+			if len(result.Changes) != 1 || result.Changes[0].Prune != tt.want {
+				t.Fatalf("Changes = %+v, want one deletion with Prune %q", result.Changes, tt.want)
+			}
+			if !strings.Contains(result.Diffs[0], "🗑️ Deleted: v1/ConfigMap/cfg "+tt.note+"</summary>") {
+				t.Errorf("summary should contain %q, got:\n%s", tt.note, result.Diffs[0])
+			}
+		})
+	}
+}
+
+func TestPruneBehaviorOnlyForDeletions(t *testing.T) {
+	result, err := GenerateDiff([]string{manifestFor("ConfigMap", "a", "1")}, []string{manifestFor("ConfigMap", "a", "2"), manifestFor("ConfigMap", "b", "1")}, &AppInfo{Name: "app", AutoPrune: true})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	for _, c := range result.Changes {
+		if c.Prune != "" {
+			t.Errorf("%s %s: Prune = %q, want empty", c.Type, c.Name, c.Prune)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RBACChange is a permission granted or revoked by a change to a Role,
+// ClusterRole, RoleBinding or ClusterRoleBinding
+type RBACChange struct {
+	Resource   string // Kind/namespace/name of the role or binding
+	Granted    bool   // false if the permission is revoked
+	Permission string // e.g. "get, list on apps/deployments" or "User alice → ClusterRole/view"
+	Escalation string // why a granted permission is sensitive, empty if it is not
+}
+
+// escalationVerbs let a subject gain permissions beyond its own
+var escalationVerbs = []string{"escalate", "bind", "impersonate"}
+
+// rbacChanges computes the effective rules (verbs × resources × apiGroups)
+// and bindings (subjects × roleRef) added and removed by the changes
+func rbacChanges(changes []resourceChange) []RBACChange {
+	var out []RBACChange
+	for _, c := range changes {
+		if !strings.HasPrefix(c.resource.APIVersion, "rbac.authorization.k8s.io/") {
+			continue
+		}
+		name := resourceName(c.resource)
+		switch c.resource.Kind {
+		case "Role", "ClusterRole":
+			before, after := roleRules(c.base), roleRules(c.head)
+			for _, p := range groupRules(subtract(after, before)) {
+				out = append(out, RBACChange{Resource: name, Granted: true, Permission: p.String(), Escalation: p.escalation()})
+			}
+			for _, p := range groupRules(subtract(before, after)) {
+				out = append(out, RBACChange{Resource: name, Permission: p.String()})
+			}
+		case "RoleBinding", "ClusterRoleBinding":
+			before, after := bindings(c.base), bindings(c.head)
+			for _, b := range subtract(after, before) {
+				out = append(out, RBACChange{Resource: name, Granted: true, Permission: b.String(), Escalation: b.escalation()})
+			}
+			for _, b := range subtract(before, after) {
+				out = append(out, RBACChange{Resource: name, Permission: b.String()})
+			}
+		}
+	}
+	return out
+}
+
+// subtract returns the elements of a that are not in b, in order
+func subtract[T comparable](a, b []T) []T {
+	var out []T
+	for _, x := range a {
+		if !slices.Contains(b, x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// rbacRule is a single verb on a single resource of an API group
+type rbacRule struct {
+	apiGroup string
+	resource string // resource, or non-resource URL
+	verb     string
+}
+
+// roleRules expands the rules of a Role or ClusterRole, or returns nil if r
+// is nil. Rules restricted by resourceNames are not told apart.
+func roleRules(r *Resource) []rbacRule {
+	if r == nil {
+		return nil
+	}
+	rules, _ := r.object()["rules"].([]any)
+	var out []rbacRule
+	for _, item := range rules {
+		rule, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		verbs := stringList(rule["verbs"])
+		for _, url := range stringList(rule["nonResourceURLs"]) {
+			for _, verb := range verbs {
+				out = appendUnique(out, rbacRule{resource: url, verb: verb})
+			}
+		}
+		for _, group := range stringList(rule["apiGroups"]) {
+			for _, res := range stringList(rule["resources"]) {
+				for _, verb := range verbs {
+					out = appendUnique(out, rbacRule{apiGroup: group, resource: res, verb: verb})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// rbacPermission is a set of verbs on one resource, for display
+type rbacPermission struct {
+	apiGroup string
+	resource string
+	verbs    []string
+}
+
+// groupRules merges rules on the same resource into one permission each,
+// in order of first appearance
+func groupRules(rules []rbacRule) []*rbacPermission {
+	var out []*rbacPermission
+	for _, r := range rules {
+		i := slices.IndexFunc(out, func(p *rbacPermission) bool {
+			return p.apiGroup == r.apiGroup && p.resource == r.resource
+		})
+		if i < 0 {
+			out = append(out, &rbacPermission{apiGroup: r.apiGroup, resource: r.resource})
+			i = len(out) - 1
+		}
+		out[i].verbs = append(out[i].verbs, r.verb)
+	}
+	return out
+}
+
+func (p *rbacPermission) String() string {
+	resource := p.resource
+	if p.apiGroup != "" {
+		resource = p.apiGroup + "/" + resource
+	}
+	return strings.Join(p.verbs, ", ") + " on " + resource
+}
+
+// escalation returns why a granted permission is sensitive, or ""
+func (p *rbacPermission) escalation() string {
+	var reasons []string
+	if slices.Contains(p.verbs, "*") {
+		reasons = append(reasons, "wildcard verbs")
+	}
+	for _, verb := range escalationVerbs {
+		if slices.Contains(p.verbs, verb) {
+			reasons = append(reasons, verb)
+		}
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// rbacBinding is a single subject bound to a role
+type rbacBinding struct {
+	subject string // e.g. "User alice" or "ServiceAccount ns/name"
+	roleRef string // e.g. "ClusterRole/view"
+}
+
+// bindings expands the subjects of a RoleBinding or ClusterRoleBinding, or
+// returns nil if r is nil
+func bindings(r *Resource) []rbacBinding {
+	if r == nil {
+		return nil
+	}
+	obj := r.object()
+	roleRef := nestedMap(obj, "roleRef")
+	ref := fmt.Sprintf("%v/%v", roleRef["kind"], roleRef["name"])
+	subjects, _ := obj["subjects"].([]any)
+
+	var out []rbacBinding
+	for _, item := range subjects {
+		s, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		subject := fmt.Sprintf("%v %v", s["kind"], s["name"])
+		if ns, ok := s["namespace"].(string); ok && ns != "" {
+			subject = fmt.Sprintf("%v %s/%v", s["kind"], ns, s["name"])
+		}
+		out = appendUnique(out, rbacBinding{subject: subject, roleRef: ref})
+	}
+	return out
+}
+
+func (b rbacBinding) String() string {
+	return b.subject + " → " + b.roleRef
+}
+
+// escalation returns why a new binding is sensitive, or ""
+func (b rbacBinding) escalation() string {
+	if b.roleRef == "ClusterRole/cluster-admin" {
+		return "binds cluster-admin"
+	}
+	return ""
+}
+
+// stringList returns the strings of a YAML list, skipping other values
+func stringList(v any) []string {
+	list, _ := v.([]any)
+	var out []string
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// appendUnique appends x to list unless it is already present
+func appendUnique[T comparable](list []T, x T) []T {
+	if slices.Contains(list, x) {
+		return list
+	}
+	return append(list, x)
+}
+
+// formatRBACChanges renders RBAC changes as a list, escalations first
+func formatRBACChanges(changes []RBACChange) string {
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("**RBAC changes:**\n\n")
+	for _, c := range changes {
+		if c.Escalation != "" {
+			fmt.Fprintf(&sb, "- 🚨 `%s` grants `%s` (%s)\n", c.Resource, c.Permission, c.Escalation)
+		}
+	}
+	for _, c := range changes {
+		if c.Escalation != "" {
+			continue
+		}
+		if c.Granted {
+			fmt.Fprintf(&sb, "- ➕ `%s` grants `%s`\n", c.Resource, c.Permission)
+		} else {
+			fmt.Fprintf(&sb, "- ➖ `%s` revokes `%s`\n", c.Resource, c.Permission)
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
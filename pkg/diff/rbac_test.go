@@ -0,0 +1,158 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func clusterRole(rules string) string {
+	return `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: deployer
+rules:
+` + rules
+}
+
+func clusterRoleBinding(role string, subjects string) string {
+	return `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: deployer
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: ` + role + `
+subjects:
+` + subjects
+}
+
+func TestRBACChangesRoles(t *testing.T) {
+	base := clusterRole(`
+- apiGroups: ["apps"]
+  resources: ["deployments"]
+  verbs: ["get", "list"]
+- apiGroups: [""]
+  resources: ["secrets"]
+  verbs: ["get"]
+`)
+	head := clusterRole(`
+- apiGroups: ["apps"]
+  resources: ["deployments", "statefulsets"]
+  verbs: ["get", "list", "patch"]
+- apiGroups: ["rbac.authorization.k8s.io"]
+  resources: ["clusterroles"]
+  verbs: ["bind", "escalate"]
+- nonResourceURLs: ["/metrics"]
+  verbs: ["*"]
+`)
+
+	result, err := GenerateDiff([]string{base}, []string{head}, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+
+	want := []RBACChange{
+		{Resource: "ClusterRole/deployer", Granted: true, Permission: "patch on apps/deployments"},
+		{Resource: "ClusterRole/deployer", Granted: true, Permission: "get, list, patch on apps/statefulsets"},
+		{Resource: "ClusterRole/deployer", Granted: true, Permission: "bind, escalate on rbac.authorization.k8s.io/clusterroles", Escalation: "escalate, bind"},
+		{Resource: "ClusterRole/deployer", Granted: true, Permission: "* on /metrics", Escalation: "wildcard verbs"},
+		{Resource: "ClusterRole/deployer", Permission: "get on secrets"},
+	}
+	if len(result.RBACChanges) != len(want) {
+		t.Fatalf("RBACChanges = %+v, want %+v", result.RBACChanges, want)
+	}
+	for i := range want {
+		if result.RBACChanges[i] != want[i] {
+			t.Errorf("RBACChanges[%d] = %+v, want %+v", i, result.RBACChanges[i], want[i])
+		}
+	}
+}
+
+func TestRBACChangesBindings(t *testing.T) {
+	base := clusterRoleBinding("view", `
+- kind: User
+  name: alice
+- kind: ServiceAccount
+  name: ci
+  namespace: tools
+`)
+	head := clusterRoleBinding("cluster-admin", `
+- kind: ServiceAccount
+  name: ci
+  namespace: tools
+`)
+
+	result, err := GenerateDiff([]string{base}, []string{head}, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+
+	want := []RBACChange{
+		{Resource: "ClusterRoleBinding/deployer", Granted: true, Permission: "ServiceAccount tools/ci → ClusterRole/cluster-admin", Escalation: "binds cluster-admin"},
+		{Resource: "ClusterRoleBinding/deployer", Permission: "User alice → ClusterRole/view"},
+		{Resource: "ClusterRoleBinding/deployer", Permission: "ServiceAccount tools/ci → ClusterRole/view"},
+	}
+	if len(result.RBACChanges) != len(want) {
+		t.Fatalf("RBACChanges = %+v, want %+v", result.RBACChanges, want)
+	}
+	for i := range want {
+		if result.RBACChanges[i] != want[i] {
+			t.Errorf("RBACChanges[%d] = %+v, want %+v", i, result.RBACChanges[i], want[i])
+		}
+	}
+}
+
+func TestRBACChangesIgnoresReorderedRules(t *testing.T) {
+	base := clusterRole(`
+- apiGroups: [""]
+  resources: ["pods", "services"]
+  verbs: ["get", "list"]
+`)
+	head := clusterRole(`
+- apiGroups: [""]
+  resources: ["services"]
+  verbs: ["list", "get"]
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list"]
+`)
+
+	result, err := GenerateDiff([]string{base}, []string{head}, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	if !result.HasChanges {
+		t.Fatal("expected a YAML diff")
+	}
+	if len(result.RBACChanges) != 0 {
+		t.Errorf("equivalent rules should not be reported, got %+v", result.RBACChanges)
+	}
+}
+
+func TestFormatAppDiffRBACChanges(t *testing.T) {
+	result, err := GenerateDiff(nil, []string{
+		clusterRole(`
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["get"]
+`),
+		clusterRoleBinding("cluster-admin", `
+- kind: Group
+  name: developers
+`),
+	}, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+
+	output := FormatAppDiff(result)
+	want := "**RBAC changes:**\n\n" +
+		"- 🚨 `ClusterRoleBinding/deployer` grants `Group developers → ClusterRole/cluster-admin` (binds cluster-admin)\n" +
+		"- ➕ `ClusterRole/deployer` grants `get on configmaps`\n\n"
+	if !strings.Contains(output, want) {
+		t.Errorf("output should contain %q, got:\n%s", want, output)
+	}
+}
@@ -0,0 +1,187 @@
+package diff
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Risk rule identifiers, used to select rules per repository
+const (
+	RiskDeletePVC         = "delete-pvc"
+	RiskDeleteNamespace   = "delete-namespace"
+	RiskDeleteCRD         = "delete-crd"
+	RiskScaleToZero       = "scale-to-zero"
+	RiskLatestTag         = "latest-tag"
+	RiskLimitsRemoved     = "limits-removed"
+	RiskServiceTypeChange = "service-type-change"
+)
+
+// RiskRules lists all risk rules. It is also the default rule set.
+var RiskRules = []string{
+	RiskDeletePVC,
+	RiskDeleteNamespace,
+	RiskDeleteCRD,
+	RiskScaleToZero,
+	RiskLatestTag,
+	RiskLimitsRemoved,
+	RiskServiceTypeChange,
+}
+
+// RiskFinding is a high-risk change flagged by a risk rule
+type RiskFinding struct {
+	Rule     string
+	Resource string // Kind/namespace/name of the affected resource
+	Message  string
+}
+
+// riskCheck inspects a single change and returns its findings
+type riskCheck func(c resourceChange) []string
+
+var riskChecks = map[string]riskCheck{
+	RiskDeletePVC:         deletedKindCheck("PersistentVolumeClaim", "the volume's data may be lost"),
+	RiskDeleteNamespace:   deletedKindCheck("Namespace", "every resource in it is deleted as well"),
+	RiskDeleteCRD:         deletedKindCheck("CustomResourceDefinition", "every custom resource of this type is deleted as well"),
+	RiskScaleToZero:       checkScaleToZero,
+	RiskLatestTag:         checkLatestTag,
+	RiskLimitsRemoved:     checkLimitsRemoved,
+	RiskServiceTypeChange: checkServiceTypeChange,
+}
+
+// analyzeRisks runs the selected rules over the changes. A nil rule list
+// selects all rules, an empty one disables the analysis.
+func analyzeRisks(changes []resourceChange, rules []string) []RiskFinding {
+	if rules == nil {
+		rules = RiskRules
+	}
+
+	var findings []RiskFinding
+	for _, c := range changes {
+		// Iterate RiskRules rather than rules so the order does not depend
+		// on the configuration
+		for _, rule := range RiskRules {
+			if !slices.Contains(rules, rule) {
+				continue
+			}
+			for _, msg := range riskChecks[rule](c) {
+				findings = append(findings, RiskFinding{Rule: rule, Resource: resourceName(c.resource), Message: msg})
+			}
+		}
+	}
+	return findings
+}
+
+// resourceName returns the Kind/namespace/name of a resource for display
+func resourceName(r *Resource) string {
+	if r.Metadata.Namespace != "" {
+		return fmt.Sprintf("%s/%s/%s", r.Kind, r.Metadata.Namespace, r.Metadata.identity())
+	}
+	return fmt.Sprintf("%s/%s", r.Kind, r.Metadata.identity())
+}
+
+func deletedKindCheck(kind, consequence string) riskCheck {
+	return func(c resourceChange) []string {
+		if c.changeType != ChangeDeleted || c.resource.Kind != kind {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s is deleted: %s", kind, consequence)}
+	}
+}
+
+func checkScaleToZero(c resourceChange) []string {
+	if c.head == nil {
+		return nil
+	}
+	n, ok := replicas(c.head.object())
+	if !ok || n != 0 {
+		return nil
+	}
+	if c.base != nil {
+		if before, ok := replicas(c.base.object()); ok && before == 0 {
+			return nil // already scaled down
+		}
+	}
+	return []string{"replicas set to 0"}
+}
+
+func checkLatestTag(c resourceChange) []string {
+	if c.head == nil {
+		return nil
+	}
+	spec := podSpec(c.head.Kind, c.head.object())
+	if spec == nil {
+		return nil
+	}
+
+	// Only flag images introduced by this change
+	var before []string
+	if c.base != nil {
+		for _, ct := range containers(podSpec(c.base.Kind, c.base.object())) {
+			before = append(before, ct.image)
+		}
+	}
+
+	var findings []string
+	for _, ct := range containers(spec) {
+		if ct.image == "" || imageTag(ct.image) != "latest" || slices.Contains(before, ct.image) {
+			continue
+		}
+		findings = append(findings, fmt.Sprintf("container `%s` uses mutable image `%s`", ct.name, ct.image))
+	}
+	return findings
+}
+
+func checkLimitsRemoved(c resourceChange) []string {
+	if c.changeType != ChangeModified {
+		return nil
+	}
+	baseSpec := podSpec(c.base.Kind, c.base.object())
+	headSpec := podSpec(c.head.Kind, c.head.object())
+	if baseSpec == nil || headSpec == nil {
+		return nil
+	}
+
+	headLimits := make(map[string]map[string]any)
+	for _, ct := range containers(headSpec) {
+		limits, _ := ct.resources["limits"].(map[string]any)
+		headLimits[ct.name] = limits
+	}
+
+	var findings []string
+	for _, ct := range containers(baseSpec) {
+		after, exists := headLimits[ct.name]
+		if !exists {
+			continue // container removed, not a limit change
+		}
+		limits, _ := ct.resources["limits"].(map[string]any)
+		var names []string
+		for name := range limits {
+			if _, ok := after[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			findings = append(findings, fmt.Sprintf("container `%s` no longer has a %s limit", ct.name, name))
+		}
+	}
+	return findings
+}
+
+func checkServiceTypeChange(c resourceChange) []string {
+	if c.changeType != ChangeModified || c.resource.Kind != "Service" {
+		return nil
+	}
+	before, after := serviceType(c.base.object()), serviceType(c.head.object())
+	if before == after {
+		return nil
+	}
+	return []string{fmt.Sprintf("Service type changes from %s to %s", before, after)}
+}
+
+// serviceType returns spec.type of a Service, defaulting to ClusterIP
+func serviceType(obj map[string]any) string {
+	if t, ok := nestedMap(obj, "spec")["type"].(string); ok && t != "" {
+		return t
+	}
+	return "ClusterIP"
+}
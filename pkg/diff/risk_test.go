@@ -0,0 +1,157 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// deployment renders a Deployment with a single container
+func deployment(replicas int, image, limits string) string {
+	m := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+spec:
+  replicas: ` + strconv.Itoa(replicas) + `
+  template:
+    spec:
+      containers:
+      - name: app
+        image: ` + image + `
+`
+	if limits != "" {
+		m += "        resources:\n          limits:\n" + limits
+	}
+	return m
+}
+
+func service(serviceType string) string {
+	m := "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  namespace: prod\nspec:\n  ports:\n  - port: 80\n"
+	if serviceType != "" {
+		m += "  type: " + serviceType + "\n"
+	}
+	return m
+}
+
+func TestImageTag(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                          "latest",
+		"nginx:latest":                   "latest",
+		"nginx:1.27":                     "1.27",
+		"registry.local:5000/app":        "latest",
+		"registry.local:5000/app:v2":     "v2",
+		"ghcr.io/org/app@sha256:abcdef0": "",
+	}
+	for image, want := range tests {
+		if got := imageTag(image); got != want {
+			t.Errorf("imageTag(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestAnalyzeRisks(t *testing.T) {
+	tests := []struct {
+		name  string
+		base  []string
+		head  []string
+		rules []string
+		want  []string // "rule resource" of each expected finding
+	}{
+		{
+			name: "deleted pvc, namespace and crd",
+			base: []string{
+				"apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: data\n  namespace: prod",
+				"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod",
+				"apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: widgets.example.com",
+				manifestFor("ConfigMap", "cfg", "a"),
+			},
+			head: nil,
+			want: []string{
+				"delete-namespace Namespace/prod",
+				"delete-crd CustomResourceDefinition/widgets.example.com",
+				"delete-pvc PersistentVolumeClaim/prod/data",
+			},
+		},
+		{
+			name: "scaled to zero",
+			base: []string{deployment(3, "app:v1", "")},
+			head: []string{deployment(0, "app:v1", "")},
+			want: []string{"scale-to-zero Deployment/prod/web"},
+		},
+		{
+			name: "already at zero",
+			base: []string{deployment(0, "app:v1", "")},
+			head: []string{deployment(0, "app:v2", "")},
+		},
+		{
+			name: "latest tag introduced",
+			base: []string{deployment(1, "app:v1", "")},
+			head: []string{deployment(1, "app", "")},
+			want: []string{"latest-tag Deployment/prod/web"},
+		},
+		{
+			name: "latest tag unchanged",
+			base: []string{deployment(1, "app:latest", "")},
+			head: []string{deployment(2, "app:latest", "")},
+		},
+		{
+			name: "limits removed",
+			base: []string{deployment(1, "app:v1", "            cpu: 500m\n            memory: 1Gi\n")},
+			head: []string{deployment(1, "app:v1", "            cpu: 500m\n")},
+			want: []string{"limits-removed Deployment/prod/web"},
+		},
+		{
+			name: "service type change",
+			base: []string{service("")},
+			head: []string{service("LoadBalancer")},
+			want: []string{"service-type-change Service/prod/web"},
+		},
+		{
+			name:  "rule not selected",
+			base:  []string{service("")},
+			head:  []string{service("NodePort")},
+			rules: []string{RiskDeletePVC},
+		},
+		{
+			name:  "analysis disabled",
+			base:  []string{deployment(3, "app:v1", "")},
+			head:  []string{deployment(0, "app:v1", "")},
+			rules: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := GenerateDiffWithOptions(tt.base, tt.head, &AppInfo{Name: "app"}, &DiffOptions{RiskRules: tt.rules})
+			if err != nil {
+				t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+			}
+			var got []string
+			for _, f := range result.Risks {
+				got = append(got, f.Rule+" "+f.Resource)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Risks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatReportRisks(t *testing.T) {
+	result, err := GenerateDiff([]string{service("")}, []string{service("NodePort")}, &AppInfo{Name: "web"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	output := FormatReport(NewDiffReport("ArgoCD Diff", []*DiffResult{result}))
+
+	want := "> [!WARNING]\n> **High-risk changes**\n>\n> - `web`: `Service/prod/web` Service type changes from ClusterIP to NodePort\n"
+	if !strings.Contains(output, want) {
+		t.Errorf("report should contain the warning block %q, got:\n%s", want, output)
+	}
+	if strings.Index(output, "[!WARNING]") > strings.Index(output, "### ") {
+		t.Error("warning block should come before the app diffs")
+	}
+}
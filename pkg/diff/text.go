@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ANSI escape sequences used by FormatReportText
+const (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiCyan   = "\033[36m"
+)
+
+// FormatReportText formats a diff report for a terminal: a summary, the risk
+// findings and a plain unified diff per resource. With color, diff lines are
+// colored with ANSI escape sequences.
+func FormatReportText(report *DiffReport, color bool) string {
+	paint := func(code, s string) string {
+		if !color || s == "" {
+			return s
+		}
+		return code + s + ansiReset
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d applications have changes\n", report.AppsWithDiffs, report.TotalApps)
+
+	for _, r := range report.Results {
+		for _, f := range r.Risks {
+			sb.WriteString(paint(ansiYellow, fmt.Sprintf("⚠ %s: %s: %s (%s)", r.AppInfo.Name, f.Resource, f.Message, f.Rule)) + "\n")
+		}
+	}
+
+	for _, result := range report.Results {
+		sb.WriteString("\n")
+		switch {
+		case result.ErrorMessage != "":
+			sb.WriteString(paint(ansiBold+ansiRed, "✗ "+result.AppInfo.Name) + "\n")
+			sb.WriteString(result.ErrorMessage + "\n")
+			continue
+		case !result.HasChanges:
+			sb.WriteString(paint(ansiBold, "✓ "+result.AppInfo.Name) + ": no changes\n")
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%s (%d added, %d modified, %d deleted)\n",
+			paint(ansiBold, "● "+result.AppInfo.Name),
+			result.ResourcesAdded, result.ResourcesModified, result.ResourcesDeleted)
+		if result.DuplicateOf != "" {
+			fmt.Fprintf(&sb, "same diff as %s\n", result.DuplicateOf)
+			continue
+		}
+
+		for _, c := range result.Changes {
+			name := c.Name
+			if c.Namespace != "" {
+				name = c.Namespace + "/" + name
+			}
+			heading := fmt.Sprintf("%s %s %s", c.Type, c.Kind, name)
+			if c.Hook {
+				heading += " (hook)"
+			}
+			sb.WriteString("\n" + paint(ansiBold, heading) + "\n")
+			sb.WriteString(colorDiff(strings.TrimSuffix(c.Diff, "\n"), paint) + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// colorDiff colors the lines of a unified diff with paint
+func colorDiff(unified string, paint func(code, s string) string) string {
+	lines := strings.Split(unified, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			lines[i] = paint(ansiBold, line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = paint(ansiCyan, line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = paint(ansiGreen, line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = paint(ansiRed, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,48 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatReportText(t *testing.T) {
+	base := []string{manifestFor("ConfigMap", "cfg", "a")}
+	head := []string{manifestFor("ConfigMap", "cfg", "b"), manifestFor("Service", "svc", "y")}
+
+	result, err := GenerateDiff(base, head, &AppInfo{Name: "app"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	unchanged, err := GenerateDiff(base, base, &AppInfo{Name: "same"})
+	if err != nil {
+		t.Fatalf("GenerateDiff() error = %v", err)
+	}
+	failed := &DiffResult{AppInfo: &AppInfo{Name: "broken"}, ErrorMessage: "Failed to get base manifests: boom"}
+	report := NewDiffReport("ArgoCD Diff", []*DiffResult{result, unchanged, failed})
+
+	plain := FormatReportText(report, false)
+	for _, want := range []string{
+		"1 of 3 applications have changes",
+		"● app (1 added, 1 modified, 0 deleted)",
+		"modified ConfigMap cfg",
+		"added Service svc",
+		"-  key: a",
+		"+  key: b",
+		"✓ same: no changes",
+		"✗ broken\nFailed to get base manifests: boom",
+	} {
+		if !strings.Contains(plain, want) {
+			t.Errorf("output missing %q:\n%s", want, plain)
+		}
+	}
+	if strings.Contains(plain, "\033[") || strings.Contains(plain, "<details>") || strings.Contains(plain, "```") {
+		t.Errorf("plain output contains escape sequences or markdown:\n%s", plain)
+	}
+
+	colored := FormatReportText(report, true)
+	for _, want := range []string{ansiRed + "-  key: a" + ansiReset, ansiGreen + "+  key: b" + ansiReset} {
+		if !strings.Contains(colored, want) {
+			t.Errorf("colored output missing %q:\n%s", want, colored)
+		}
+	}
+}
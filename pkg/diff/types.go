@@ -1,6 +1,9 @@
 package diff
 
 import (
+	"cmp"
+	"time"
+
 	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 )
 
@@ -9,6 +12,8 @@ type AppInfo struct {
 	Name                 string
 	Namespace            string
 	DestinationNamespace string // destination namespace from app.Spec.Destination.Namespace
+	Cluster              string // destination cluster name, or server URL if unnamed
+	AutoPrune            bool   // automated sync is enabled and prunes resources
 	Server               string // ArgoCD server URL for generating links
 	Status               string // Synced, OutOfSync, Unknown
 	Health               string // Healthy, Progressing, Degraded, Suspended, Missing, Unknown
@@ -20,11 +25,16 @@ func NewAppInfo(app *appv1.Application, serverURL string) *AppInfo {
 		Name:                 app.Name,
 		Namespace:            app.Namespace,
 		DestinationNamespace: app.Spec.Destination.Namespace,
+		Cluster:              cmp.Or(app.Spec.Destination.Name, app.Spec.Destination.Server),
 		Server:               serverURL,
 		Status:               "Unknown",
 		Health:               "Unknown",
 	}
 
+	if policy := app.Spec.SyncPolicy; policy != nil && policy.IsAutomatedSyncEnabled() {
+		info.AutoPrune = policy.Automated.Prune
+	}
+
 	if app.Status.Sync.Status != "" {
 		info.Status = string(app.Status.Sync.Status)
 	}
@@ -82,10 +92,21 @@ func (a *AppInfo) ArgoURL() string {
 
 // DiffResult contains the result of diffing an application
 type DiffResult struct {
-	AppInfo      *AppInfo
-	Diffs        []string // Individual resource diffs
-	HasChanges   bool
-	ErrorMessage string
+	AppInfo       *AppInfo
+	Diffs         []string            // Individual resource diffs
+	HookDiffs     []string            // Helm/ArgoCD hook diffs, only set with DiffOptions.IncludeHooks
+	Changes       []ResourceChange    // Structured form of Diffs followed by HookDiffs
+	Risks         []RiskFinding       // High-risk changes flagged by DiffOptions.RiskRules
+	Violations    []PolicyViolation   // Policy violations of head resources that base did not have, set with DiffOptions.Policies
+	SchemaErrors  []SchemaError       // Schema errors of added and modified resources, set with DiffOptions.Schema
+	ImageChanges  []ImageChange       // Container image changes of changed workloads
+	Capacity      Capacity            // Change in CPU/memory requests and limits (head - base)
+	RBACChanges   []RBACChange        // Permissions granted or revoked by Role/ClusterRole/binding changes
+	Conflicts     []OwnershipConflict // Head resources other apps render or manage too, set by DetectOwnershipConflicts
+	HeadResources []ResourceID        // Identities of the head resources (excluding hooks)
+	Deprecations  []APIDeprecation    // Head resources using APIs deprecated in DiffOptions.KubeVersion
+	HasChanges    bool
+	ErrorMessage  string
 	// Resource change counts
 	ResourcesAdded    int
 	ResourcesModified int
@@ -94,16 +115,77 @@ type DiffResult struct {
 	DuplicateOf string // Name of the app this is a duplicate of (empty if not a duplicate)
 }
 
+// ChangeType describes how a resource differs between base and head
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeModified ChangeType = "modified"
+	ChangeDeleted  ChangeType = "deleted"
+)
+
+// ResourceChange is a single changed resource, for machine-readable output
+type ResourceChange struct {
+	Type      ChangeType
+	Group     string // empty for the core API group
+	Version   string
+	Kind      string
+	Namespace string
+	Name      string // metadata.name, or metadata.generateName if unset
+	Hook      bool   // Helm or ArgoCD hook
+	Diff      string // unified diff text (without markdown)
+	Truncated bool   // Diff was cut off after DiffOptions.MaxDiffLines lines
+
+	ImmutableFields []string // Changed fields that cannot be updated in place
+	SyncOptions     []string // From the argocd.argoproj.io/sync-options annotation
+	Prune           Prune    // What a sync does with a deleted resource (empty for other changes and hooks)
+}
+
+// PolicyViolation is a head resource that does not satisfy a policy
+type PolicyViolation struct {
+	Policy   string
+	Resource string // Kind/namespace/name of the violating resource
+	Message  string
+}
+
+// PolicyChecker evaluates policies against the parsed base or head
+// resources of an application (see pkg/policy)
+type PolicyChecker interface {
+	Check(resources []map[string]any) []PolicyViolation
+}
+
+// SchemaError is an unknown field or type error in a head resource
+type SchemaError struct {
+	Resource string // Kind/namespace/name of the resource
+	Message  string // e.g. "spec.replica: unknown field"
+}
+
+// SchemaValidator validates a parsed manifest against its API schema and
+// returns its errors (see pkg/schema)
+type SchemaValidator interface {
+	Validate(obj map[string]any) []string
+}
+
 // DiffOptions contains options for diff generation
 type DiffOptions struct {
-	IgnoreArgocdTracking bool     // Deprecated: Use IgnoredMetadata instead. Remove argocd.argoproj.io/* labels/annotations before comparing
-	IgnoredMetadata      []string // List of label/annotation keys or prefixes to ignore (e.g., "argocd.argoproj.io/", "app.kubernetes.io/version")
+	IgnoreArgocdTracking bool            // Deprecated: Use IgnoredMetadata instead. Remove argocd.argoproj.io/* labels/annotations before comparing
+	IgnoredMetadata      []string        // List of label/annotation keys or prefixes to ignore (e.g., "argocd.argoproj.io/", "app.kubernetes.io/version")
+	KindOrder            []string        // Kind priority for ordering resource diffs (empty = DefaultKindOrder)
+	GroupByKind          bool            // Render a heading per kind above the resource diffs
+	MaxDiffLines         int             // Diffs of a resource are cut off after this many lines (0 = no limit)
+	NormalizeEmbedded    bool            // Parse and pretty-print JSON/YAML/TOML embedded in ConfigMap data before diffing
+	IncludeHooks         bool            // Diff Helm and ArgoCD hooks and render them in a separate section
+	RiskRules            []string        // Risk rules to run (nil = all of RiskRules, empty = none)
+	Policies             PolicyChecker   // Optional: organization policies; violations head introduces are reported
+	KubeVersion          string          // Target Kubernetes version for API deprecations, e.g. "1.29" (empty = report all deprecated APIs)
+	Schema               SchemaValidator // Optional: validates added and modified head resources
 }
 
 // DiffReport contains the complete diff report for all applications
 type DiffReport struct {
 	WorkflowName  string
-	Timestamp     string
+	GeneratedAt   time.Time
+	Timestamp     string // GeneratedAt formatted for the PR comment
 	TotalApps     int
 	AppsWithDiffs int
 	Results       []*DiffResult
@@ -0,0 +1,116 @@
+package diff
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// object parses the resource's manifest into a generic map. It returns nil
+// if the manifest cannot be parsed.
+func (r *Resource) object() map[string]any {
+	if r == nil {
+		return nil
+	}
+	var obj map[string]any
+	if err := yaml.Unmarshal([]byte(r.raw), &obj); err != nil {
+		return nil
+	}
+	return obj
+}
+
+// originalObject parses the resource as rendered, before metadata
+// filtering, or returns nil if it cannot be parsed
+func (r *Resource) originalObject() map[string]any {
+	if r == nil {
+		return nil
+	}
+	var obj map[string]any
+	if err := yaml.Unmarshal([]byte(r.original), &obj); err != nil {
+		return nil
+	}
+	return obj
+}
+
+// nestedMap walks obj along path and returns the map found there, or nil
+func nestedMap(obj map[string]any, path ...string) map[string]any {
+	current := obj
+	for _, p := range path {
+		next, ok := current[p].(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+// podSpec returns the pod spec of a workload resource, or nil if the kind
+// has none
+func podSpec(kind string, obj map[string]any) map[string]any {
+	switch kind {
+	case "Pod":
+		return nestedMap(obj, "spec")
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job", "Rollout":
+		return nestedMap(obj, "spec", "template", "spec")
+	case "CronJob":
+		return nestedMap(obj, "spec", "jobTemplate", "spec", "template", "spec")
+	}
+	return nil
+}
+
+// container is the subset of a container spec used for analysis
+type container struct {
+	name      string
+	image     string
+	init      bool
+	resources map[string]any
+}
+
+// containers returns the init and regular containers of a pod spec
+func containers(spec map[string]any) []container {
+	var out []container
+	for _, field := range []string{"initContainers", "containers"} {
+		list, _ := spec[field].([]any)
+		for _, item := range list {
+			c, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _ := c["name"].(string)
+			image, _ := c["image"].(string)
+			resources, _ := c["resources"].(map[string]any)
+			out = append(out, container{name: name, image: image, init: field == "initContainers", resources: resources})
+		}
+	}
+	return out
+}
+
+// replicas returns spec.replicas of a scalable resource, and whether it is set
+func replicas(obj map[string]any) (int, bool) {
+	spec := nestedMap(obj, "spec")
+	if spec == nil {
+		return 0, false
+	}
+	switch v := spec["replicas"].(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// imageTag returns the tag of an image reference, "latest" for untagged
+// references, and "" for references pinned by digest
+func imageTag(image string) string {
+	if strings.Contains(image, "@") {
+		return ""
+	}
+	// A colon before the last slash belongs to a registry port
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return "latest"
+}
@@ -0,0 +1,59 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/tamcore/argo-diff/pkg/metrics"
+)
+
+// maxListedFiles is the most files GitHub lists for a pull request
+const maxListedFiles = 3000
+
+// ListChangedFiles returns the paths of the files changed by a pull request.
+// Renamed files are listed under their old and new path, so apps tracking
+// either are affected. Returns an error if the pull request changes more
+// files than GitHub lists, rather than silently missing some.
+func (c *Client) ListChangedFiles(ctx context.Context, prNumber int) ([]string, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	seen := map[string]bool{}
+	var paths []string
+	listed := 0
+
+	for {
+		files, resp, err := c.client.PullRequests.ListFiles(ctx, c.owner, c.repo, prNumber, opts)
+		metrics.RecordGithubCall("list_files", err)
+		if err != nil {
+			return nil, fmt.Errorf("list pull request files: %w", err)
+		}
+
+		for _, f := range files {
+			listed++
+			for _, path := range []string{f.GetPreviousFilename(), f.GetFilename()} {
+				if path != "" && !seen[path] {
+					seen[path] = true
+					paths = append(paths, path)
+				}
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	if listed >= maxListedFiles {
+		pr, _, err := c.client.PullRequests.Get(ctx, c.owner, c.repo, prNumber)
+		metrics.RecordGithubCall("get_pull_request", err)
+		if err != nil {
+			return nil, fmt.Errorf("get pull request: %w", err)
+		}
+		if pr.GetChangedFiles() > listed {
+			return nil, fmt.Errorf("pull request changes %d files, but GitHub lists only %d", pr.GetChangedFiles(), listed)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,95 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+)
+
+// newTestClient returns a client for owner/repo talking to handler
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	url := srv.URL + "/"
+	client, err := github.NewClient(github.WithURLs(&url, &url))
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	return &Client{client: client, owner: "owner", repo: "repo"}
+}
+
+// serveFiles serves pages of PR files, linking to the next page like GitHub
+func serveFiles(pages [][]map[string]string, changedFiles int) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/pulls/7/files", func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+		if page < len(pages) {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=%d>; rel="next"`, r.Host, r.URL.Path, page+1))
+		}
+		_ = json.NewEncoder(w).Encode(pages[page-1])
+	})
+	mux.HandleFunc("GET /repos/owner/repo/pulls/7", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]int{"number": 7, "changed_files": changedFiles})
+	})
+	return mux
+}
+
+func TestListChangedFiles(t *testing.T) {
+	pages := [][]map[string]string{
+		{
+			{"filename": "apps/a/values.yaml", "status": "modified"},
+			{"filename": "apps/new/kustomization.yaml", "previous_filename": "apps/old/kustomization.yaml", "status": "renamed"},
+		},
+		{
+			{"filename": "apps/b/deploy.yaml", "status": "removed"},
+			{"filename": "apps/old/kustomization.yaml", "status": "added"},
+		},
+	}
+	c := newTestClient(t, serveFiles(pages, 4))
+
+	got, err := c.ListChangedFiles(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("ListChangedFiles() error = %v", err)
+	}
+	want := []string{"apps/a/values.yaml", "apps/old/kustomization.yaml", "apps/new/kustomization.yaml", "apps/b/deploy.yaml"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ListChangedFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestListChangedFilesBeyondLimit(t *testing.T) {
+	var pages [][]map[string]string
+	for p := range maxListedFiles / 100 {
+		var page []map[string]string
+		for i := range 100 {
+			page = append(page, map[string]string{"filename": fmt.Sprintf("f%d-%d", p, i)})
+		}
+		pages = append(pages, page)
+	}
+
+	c := newTestClient(t, serveFiles(pages, maxListedFiles))
+	got, err := c.ListChangedFiles(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("ListChangedFiles() error = %v", err)
+	}
+	if len(got) != maxListedFiles {
+		t.Errorf("got %d files, want %d", len(got), maxListedFiles)
+	}
+
+	c = newTestClient(t, serveFiles(pages, maxListedFiles+1))
+	if _, err := c.ListChangedFiles(context.Background(), 7); err == nil {
+		t.Error("expected an error for a pull request with more files than GitHub lists")
+	}
+}
@@ -0,0 +1,35 @@
+// Package kubeversion parses Kubernetes versions like "1.29"
+package kubeversion
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parse parses a Kubernetes version like "1.29", "v1.29" or "1.29.3" into
+// its major and minor version
+func Parse(v string) (major, minor int, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 1 {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil || minor < 0 {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// Compare compares two valid versions by major and minor
+func Compare(a, b string) int {
+	aMajor, aMinor, _ := Parse(a)
+	bMajor, bMinor, _ := Parse(b)
+	if aMajor != bMajor {
+		return aMajor - bMajor
+	}
+	return aMinor - bMinor
+}
@@ -0,0 +1,42 @@
+package kubeversion
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in           string
+		major, minor int
+		ok           bool
+	}{
+		{"1.29", 1, 29, true},
+		{"v1.31", 1, 31, true},
+		{"1.30.2", 1, 30, true},
+		{"1", 0, 0, false},
+		{"1.x", 0, 0, false},
+		{"latest", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := Parse(tt.in)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("Parse(%q) = %d, %d, %v, want %d, %d, %v", tt.in, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.9", "1.10", -1},
+		{"v1.29", "1.29.3", 0},
+		{"2.0", "1.31", 1},
+	}
+	for _, tt := range tests {
+		got := Compare(tt.a, tt.b)
+		if (got < 0) != (tt.want < 0) || (got > 0) != (tt.want > 0) {
+			t.Errorf("Compare(%q, %q) = %d, want sign of %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
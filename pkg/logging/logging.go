@@ -2,6 +2,7 @@ package logging
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"os"
 	"sync"
@@ -22,8 +23,13 @@ var (
 	once   sync.Once
 )
 
-// Init initializes the global logger
+// Init initializes the global logger, writing JSON to stdout
 func Init(level string) {
+	InitWriter(os.Stdout, level)
+}
+
+// InitWriter initializes the global logger, writing JSON to w
+func InitWriter(w io.Writer, level string) {
 	var logLevel slog.Level
 	switch level {
 	case "debug":
@@ -38,7 +44,7 @@ func Init(level string) {
 		logLevel = slog.LevelInfo
 	}
 
-	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
 		Level: logLevel,
 	})
 	logger = slog.New(handler)
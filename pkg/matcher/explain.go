@@ -0,0 +1,85 @@
+package matcher
+
+import (
+	"cmp"
+
+	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+)
+
+// Reasons an application was not matched, see Explanation
+const (
+	ExcludedRepoMismatch  = "repo URL mismatch"          // no source tracks the repository
+	ExcludedPathMismatch  = "path mismatch"              // no changed file is under a source path
+	ExcludedClusterFilter = "destination cluster filter" // would match, but targets another cluster
+	ExcludedProjectPolicy = "project policy"             // would match, but its project does not permit the repository
+)
+
+// Explanation tells why an application was or was not matched
+type Explanation struct {
+	MatchResult
+	ExcludedReason string   // empty if the app was matched
+	Cluster        string   // destination cluster name, or server URL if unnamed
+	RepoURLs       []string // repository URLs of the app's sources
+	SourcePaths    []string // paths of the sources tracking the repository ("" = whole repository)
+}
+
+// Matched reports whether the app is affected by the changed files
+func (e *Explanation) Matched() bool {
+	return e.ExcludedReason == ""
+}
+
+// NearMiss reports whether an app was excluded although one of its sources
+// tracks the repository, or only because of the destination cluster filter
+// or its project
+func (e *Explanation) NearMiss() bool {
+	switch e.ExcludedReason {
+	case ExcludedPathMismatch, ExcludedClusterFilter, ExcludedProjectPolicy:
+		return true
+	}
+	return false
+}
+
+// ExplainMatches returns an explanation for every application: the match
+// details of the apps MatchApplicationsWithDetails returns, and why the
+// others were excluded.
+func ExplainMatches(apps []*appv1.Application, repo string, changedFiles []string, destinationClusters []string, projects Projects) []*Explanation {
+	matched := make(map[*appv1.Application]*MatchResult)
+	for _, result := range MatchApplicationsWithDetails(apps, repo, changedFiles, destinationClusters, projects) {
+		matched[result.App] = result
+	}
+	clusterSet := buildClusterSet(destinationClusters)
+
+	explanations := make([]*Explanation, 0, len(apps))
+	for _, app := range apps {
+		e := &Explanation{
+			MatchResult: MatchResult{App: app, MatchedPaths: []string{}},
+			Cluster:     cmp.Or(app.Spec.Destination.Name, app.Spec.Destination.Server),
+		}
+		for _, source := range appSources(app) {
+			e.RepoURLs = append(e.RepoURLs, source.RepoURL)
+			if tracksRepo(&source, repo) {
+				e.SourcePaths = append(e.SourcePaths, source.Path)
+			}
+		}
+		e.RepoURLs = uniqueStrings(e.RepoURLs)
+		e.SourcePaths = uniqueStrings(e.SourcePaths)
+
+		// Only the apps MatchApplicationsWithDetails excluded need a reason
+		result, ok := matched[app]
+		wouldMatch := !ok && matchApp(app, repo, changedFiles) != nil
+		switch {
+		case ok:
+			e.MatchResult = *result
+		case !wouldMatch && len(e.SourcePaths) == 0:
+			e.ExcludedReason = ExcludedRepoMismatch
+		case !wouldMatch:
+			e.ExcludedReason = ExcludedPathMismatch
+		case len(clusterSet) > 0 && !clusterSet[app.Spec.Destination.Name]:
+			e.ExcludedReason = ExcludedClusterFilter
+		default:
+			e.ExcludedReason = ExcludedProjectPolicy
+		}
+		explanations = append(explanations, e)
+	}
+	return explanations
+}
@@ -1,6 +1,7 @@
 package matcher
 
 import (
+	"cmp"
 	"log/slog"
 	"path/filepath"
 	"slices"
@@ -16,10 +17,38 @@ type MatchResult struct {
 	MatchReason  string   // Why the app was matched (source path, app definition, etc.)
 }
 
+// Projects are the ArgoCD projects of the applications by name. An app whose
+// project does not permit the repository as a source is not matched, since
+// ArgoCD would refuse to render it. Apps of projects that are not listed
+// (e.g. because the token may not see them) are not checked.
+type Projects map[string]*appv1.AppProject
+
+// permits reports whether the project of app permits one of its sources
+// tracking repo. Apps without such a source, e.g. matched by their
+// definition file, are permitted.
+func (p Projects) permits(app *appv1.Application, repo string) bool {
+	proj, ok := p[cmp.Or(app.Spec.Project, "default")]
+	if !ok {
+		return true
+	}
+	tracking := false
+	for _, source := range appSources(app) {
+		if !tracksRepo(&source, repo) {
+			continue
+		}
+		if proj.IsSourcePermitted(source) {
+			return true
+		}
+		tracking = true
+	}
+	return !tracking
+}
+
 // MatchApplications returns applications affected by changed files.
 // If destinationClusters is non-empty, only apps targeting one of those cluster names are included.
-func MatchApplications(apps []*appv1.Application, repo string, changedFiles []string, destinationClusters []string) []*appv1.Application {
-	results := MatchApplicationsWithDetails(apps, repo, changedFiles, destinationClusters)
+// Apps whose project does not permit the repository are excluded, see Projects.
+func MatchApplications(apps []*appv1.Application, repo string, changedFiles []string, destinationClusters []string, projects Projects) []*appv1.Application {
+	results := MatchApplicationsWithDetails(apps, repo, changedFiles, destinationClusters, projects)
 	matched := make([]*appv1.Application, 0, len(results))
 	for _, r := range results {
 		matched = append(matched, r.App)
@@ -29,7 +58,8 @@ func MatchApplications(apps []*appv1.Application, repo string, changedFiles []st
 
 // MatchApplicationsWithDetails returns applications affected by changed files with match details.
 // If destinationClusters is non-empty, only apps targeting one of those cluster names are included.
-func MatchApplicationsWithDetails(apps []*appv1.Application, repo string, changedFiles []string, destinationClusters []string) []*MatchResult {
+// Apps whose project does not permit the repository are excluded, see Projects.
+func MatchApplicationsWithDetails(apps []*appv1.Application, repo string, changedFiles []string, destinationClusters []string, projects Projects) []*MatchResult {
 	slog.Debug("Starting application matching",
 		"repo", repo,
 		"normalizedRepo", normalizeRepoURL(repo),
@@ -44,6 +74,9 @@ func MatchApplicationsWithDetails(apps []*appv1.Application, repo string, change
 		if len(clusterSet) > 0 && !clusterSet[app.Spec.Destination.Name] {
 			continue
 		}
+		if !projects.permits(app, repo) {
+			continue
+		}
 		if result := matchApp(app, repo, changedFiles); result != nil {
 			results = append(results, result)
 		}
@@ -142,12 +175,17 @@ func isAppDefinitionFile(file, appName string) bool {
 	return false
 }
 
-// matchesSourceWithPaths checks if a source matches the repository and returns matched file paths
-func matchesSourceWithPaths(source *appv1.ApplicationSource, repo string, changedFiles []string) []string {
-	if source == nil {
-		return nil
+// appSources returns the single source of an application followed by its
+// multiple sources
+func appSources(app *appv1.Application) []appv1.ApplicationSource {
+	if app.Spec.Source == nil {
+		return app.Spec.Sources
 	}
+	return append([]appv1.ApplicationSource{*app.Spec.Source}, app.Spec.Sources...)
+}
 
+// tracksRepo reports whether a source tracks the repository
+func tracksRepo(source *appv1.ApplicationSource, repo string) bool {
 	sourceRepo := normalizeRepoURL(source.RepoURL)
 	targetRepo := normalizeRepoURL(repo)
 
@@ -158,7 +196,12 @@ func matchesSourceWithPaths(source *appv1.ApplicationSource, repo string, change
 		"targetRepoNormalized", targetRepo,
 		"sourcePath", source.Path)
 
-	if sourceRepo != targetRepo {
+	return sourceRepo == targetRepo
+}
+
+// matchesSourceWithPaths checks if a source matches the repository and returns matched file paths
+func matchesSourceWithPaths(source *appv1.ApplicationSource, repo string, changedFiles []string) []string {
+	if source == nil || !tracksRepo(source, repo) {
 		return nil
 	}
 
@@ -1,6 +1,7 @@
 package matcher
 
 import (
+	"slices"
 	"testing"
 
 	appv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
@@ -144,7 +145,7 @@ func TestMatchApplications(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := MatchApplications(tt.apps, tt.repo, tt.changedFiles, nil)
+			got := MatchApplications(tt.apps, tt.repo, tt.changedFiles, nil, nil)
 			if len(got) != tt.wantCount {
 				t.Errorf("MatchApplications() returned %d apps, want %d", len(got), tt.wantCount)
 			}
@@ -191,7 +192,7 @@ func TestMatchApplicationsWithDetails(t *testing.T) {
 		},
 	}
 
-	results := MatchApplicationsWithDetails(apps, "https://github.com/user/repo", []string{"app1/deployment.yaml"}, nil)
+	results := MatchApplicationsWithDetails(apps, "https://github.com/user/repo", []string{"app1/deployment.yaml"}, nil, nil)
 	if len(results) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(results))
 	}
@@ -296,21 +297,21 @@ func TestMatchApplicationsWithDestinationClusters(t *testing.T) {
 	changedFiles := []string{"app1/deployment.yaml"}
 
 	t.Run("nil clusters matches all", func(t *testing.T) {
-		got := MatchApplications(apps, "user/repo", changedFiles, nil)
+		got := MatchApplications(apps, "user/repo", changedFiles, nil, nil)
 		if len(got) != 3 {
 			t.Errorf("expected 3 apps, got %d", len(got))
 		}
 	})
 
 	t.Run("empty clusters matches all", func(t *testing.T) {
-		got := MatchApplications(apps, "user/repo", changedFiles, []string{})
+		got := MatchApplications(apps, "user/repo", changedFiles, []string{}, nil)
 		if len(got) != 3 {
 			t.Errorf("expected 3 apps, got %d", len(got))
 		}
 	})
 
 	t.Run("single cluster filter", func(t *testing.T) {
-		got := MatchApplications(apps, "user/repo", changedFiles, []string{"cluster-a"})
+		got := MatchApplications(apps, "user/repo", changedFiles, []string{"cluster-a"}, nil)
 		if len(got) != 1 {
 			t.Fatalf("expected 1 app, got %d", len(got))
 		}
@@ -320,7 +321,7 @@ func TestMatchApplicationsWithDestinationClusters(t *testing.T) {
 	})
 
 	t.Run("multiple cluster filter", func(t *testing.T) {
-		got := MatchApplications(apps, "user/repo", changedFiles, []string{"cluster-a", "cluster-c"})
+		got := MatchApplications(apps, "user/repo", changedFiles, []string{"cluster-a", "cluster-c"}, nil)
 		if len(got) != 2 {
 			t.Fatalf("expected 2 apps, got %d", len(got))
 		}
@@ -331,9 +332,107 @@ func TestMatchApplicationsWithDestinationClusters(t *testing.T) {
 	})
 
 	t.Run("non-matching cluster filter", func(t *testing.T) {
-		got := MatchApplications(apps, "user/repo", changedFiles, []string{"cluster-x"})
+		got := MatchApplications(apps, "user/repo", changedFiles, []string{"cluster-x"}, nil)
 		if len(got) != 0 {
 			t.Errorf("expected 0 apps, got %d", len(got))
 		}
 	})
 }
+
+func TestExplainMatches(t *testing.T) {
+	app := func(name, repoURL, path, cluster string) *appv1.Application {
+		return &appv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: appv1.ApplicationSpec{
+				Source:      &appv1.ApplicationSource{RepoURL: repoURL, Path: path},
+				Destination: appv1.ApplicationDestination{Name: cluster},
+			},
+		}
+	}
+	restricted := app("restricted-project", "https://github.com/user/repo", "app1", "prod")
+	restricted.Spec.Project = "restricted"
+	apps := []*appv1.Application{
+		app("matched", "https://github.com/user/repo", "app1", "prod"),
+		app("other-path", "https://github.com/user/repo", "app2", "prod"),
+		app("other-repo", "https://github.com/user/other", "app1", "prod"),
+		app("other-cluster", "https://github.com/user/repo.git", "app1", "staging"),
+		app("other-cluster-and-path", "https://github.com/user/repo", "app3", "staging"),
+		restricted,
+	}
+	projects := Projects{
+		"default":    {Spec: appv1.AppProjectSpec{SourceRepos: []string{"*"}}},
+		"restricted": {Spec: appv1.AppProjectSpec{SourceRepos: []string{"https://github.com/user/other"}}},
+	}
+
+	got := ExplainMatches(apps, "user/repo", []string{"app1/values.yaml"}, []string{"prod"}, projects)
+	if len(got) != len(apps) {
+		t.Fatalf("expected %d explanations, got %d", len(apps), len(got))
+	}
+
+	want := []struct {
+		reason   string
+		nearMiss bool
+	}{
+		{"", false},
+		{ExcludedPathMismatch, true},
+		{ExcludedRepoMismatch, false},
+		{ExcludedClusterFilter, true},
+		{ExcludedPathMismatch, true},
+		{ExcludedProjectPolicy, true},
+	}
+	for i, e := range got {
+		if e.App != apps[i] {
+			t.Errorf("explanation %d is for %s, want %s", i, e.App.Name, apps[i].Name)
+		}
+		if e.ExcludedReason != want[i].reason || e.NearMiss() != want[i].nearMiss {
+			t.Errorf("%s: ExcludedReason = %q, NearMiss = %v, want %q, %v",
+				e.App.Name, e.ExcludedReason, e.NearMiss(), want[i].reason, want[i].nearMiss)
+		}
+	}
+
+	matched := got[0]
+	if !matched.Matched() || matched.MatchReason != "source path match" || len(matched.MatchedPaths) != 1 {
+		t.Errorf("matched = %+v", matched)
+	}
+	if paths := got[1].SourcePaths; len(paths) != 1 || paths[0] != "app2" {
+		t.Errorf("SourcePaths = %v, want [app2]", paths)
+	}
+	if len(got[2].SourcePaths) != 0 || len(got[2].RepoURLs) != 1 {
+		t.Errorf("other-repo SourcePaths = %v, RepoURLs = %v", got[2].SourcePaths, got[2].RepoURLs)
+	}
+	if got[3].Cluster != "staging" {
+		t.Errorf("Cluster = %q, want staging", got[3].Cluster)
+	}
+}
+
+func TestMatchApplicationsProjects(t *testing.T) {
+	app := func(name, project string) *appv1.Application {
+		return &appv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: appv1.ApplicationSpec{
+				Project: project,
+				Source:  &appv1.ApplicationSource{RepoURL: "https://github.com/user/repo.git", Path: "app1"},
+			},
+		}
+	}
+	apps := []*appv1.Application{
+		app("permitted", "team"),
+		app("denied", "locked"),
+		app("unknown-project", "unlisted"),
+		app("default-project", ""),
+	}
+	projects := Projects{
+		"default": {Spec: appv1.AppProjectSpec{SourceRepos: []string{"https://github.com/user/*"}}},
+		"team":    {Spec: appv1.AppProjectSpec{SourceRepos: []string{"https://github.com/user/repo"}}},
+		"locked":  {Spec: appv1.AppProjectSpec{SourceRepos: []string{"https://github.com/user/*", "!https://github.com/user/repo"}}},
+	}
+
+	var names []string
+	for _, a := range MatchApplications(apps, "user/repo", []string{"app1/values.yaml"}, nil, projects) {
+		names = append(names, a.Name)
+	}
+	want := []string{"permitted", "unknown-project", "default-project"}
+	if !slices.Equal(names, want) {
+		t.Errorf("MatchApplications() = %v, want %v", names, want)
+	}
+}
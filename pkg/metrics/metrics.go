@@ -18,13 +18,14 @@ var (
 		[]string{"repository", "status"},
 	)
 
-	// JobsInQueue tracks the current number of jobs waiting in the queue
-	JobsInQueue = promauto.NewGauge(
+	// JobsInQueue tracks the current number of jobs waiting in the queue by repository
+	JobsInQueue = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "jobs_in_queue",
 			Help:      "Current number of jobs in the queue",
 		},
+		[]string{"repository"},
 	)
 
 	// ProcessingDuration tracks job processing time
@@ -118,6 +119,16 @@ var (
 		},
 		[]string{"repository", "application", "change_type"},
 	)
+
+	// PolicyViolations counts policy violations introduced by head resources by repository and policy
+	PolicyViolations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "policy_violations_total",
+			Help:      "Total number of policy violations found in diffed resources",
+		},
+		[]string{"repository", "policy"},
+	)
 )
 
 // RecordJobSuccess records a successful job completion
@@ -130,6 +141,32 @@ func RecordJobFailure(repository string) {
 	JobsTotal.WithLabelValues(repository, "failure").Inc()
 }
 
+// RecordJobSuperseded records a job that was skipped or cancelled because
+// a newer job for the same PR and workflow was submitted
+func RecordJobSuperseded(repository string) {
+	JobsTotal.WithLabelValues(repository, "superseded").Inc()
+}
+
+// RecordJobHandedOver records a running job left to another replica
+func RecordJobHandedOver(repository string) {
+	JobsTotal.WithLabelValues(repository, "handed_over").Inc()
+}
+
+// RecordJobCancelled records a job cancelled by an operator
+func RecordJobCancelled(repository string) {
+	JobsTotal.WithLabelValues(repository, "cancelled").Inc()
+}
+
+// RecordJobRetry records a job that failed transiently and will be retried
+func RecordJobRetry(repository string) {
+	JobsTotal.WithLabelValues(repository, "retried").Inc()
+}
+
+// SetJobsInQueue records the number of queued jobs of a repository
+func SetJobsInQueue(repository string, count int) {
+	JobsInQueue.WithLabelValues(repository).Set(float64(count))
+}
+
 // RecordArgocdCall records an ArgoCD API call
 func RecordArgocdCall(operation string, err error) {
 	status := "success"
@@ -184,3 +221,8 @@ func RecordResourceChanges(repository, application, changeType string, count int
 	}
 	DiffResourceChanges.WithLabelValues(repository, application, changeType).Add(float64(count))
 }
+
+// RecordPolicyViolation records a policy violation found in a diff
+func RecordPolicyViolation(repository, policy string) {
+	PolicyViolations.WithLabelValues(repository, policy).Inc()
+}
@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"cel.dev/cel-go/cel"
+	"github.com/tamcore/argo-diff/pkg/diff"
+	"gopkg.in/yaml.v3"
+)
+
+// costLimit bounds the work a single policy evaluation may do, so a
+// pathological expression cannot stall a job
+const costLimit = 1_000_000
+
+// Policy is a single organization policy as written in the policy file
+type Policy struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"` // shown for violations
+	Kinds       []string `yaml:"kinds"`       // kinds the policy applies to (empty = all)
+	Expression  string   `yaml:"expression"`  // CEL expression, true if the resource complies
+}
+
+// File is the layout of the policy file
+type File struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+type compiledPolicy struct {
+	Policy
+	program cel.Program
+}
+
+// Set is a compiled set of policies. It implements diff.PolicyChecker.
+//
+// Expressions see two variables: object, the resource being checked, and
+// resources, all head resources of the same application (for policies like
+// "every Deployment has a PodDisruptionBudget").
+type Set struct {
+	policies []compiledPolicy
+}
+
+// Load reads and compiles the policies in the file at path
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse policy file: %w", err)
+	}
+	return Compile(f.Policies)
+}
+
+// Compile compiles policies, failing on the first invalid one
+func Compile(policies []Policy) (*Set, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("resources", cel.ListType(cel.DynType)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create CEL environment: %w", err)
+	}
+
+	set := &Set{}
+	seen := make(map[string]bool)
+	for i, p := range policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("policy %d: name is required", i)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("policy %q: duplicate name", p.Name)
+		}
+		seen[p.Name] = true
+
+		ast, issues := env.Compile(p.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("policy %q: %w", p.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("policy %q: expression must return a bool, got %s", p.Name, ast.OutputType())
+		}
+		program, err := env.Program(ast, cel.CostLimit(costLimit))
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", p.Name, err)
+		}
+		set.policies = append(set.policies, compiledPolicy{Policy: p, program: program})
+	}
+	return set, nil
+}
+
+// Len returns the number of policies in the set
+func (s *Set) Len() int {
+	return len(s.policies)
+}
+
+// Check evaluates every policy against every resource it applies to.
+// Expressions that fail to evaluate (e.g. on a missing field without has())
+// are reported as violations, so broken policies do not pass silently.
+func (s *Set) Check(resources []map[string]any) []diff.PolicyViolation {
+	list := make([]any, len(resources))
+	for i, r := range resources {
+		list[i] = r
+	}
+
+	var violations []diff.PolicyViolation
+	for _, obj := range resources {
+		kind, _ := obj["kind"].(string)
+		for _, p := range s.policies {
+			if len(p.Kinds) > 0 && !slices.Contains(p.Kinds, kind) {
+				continue
+			}
+
+			message := p.Description
+			out, _, err := p.program.Eval(map[string]any{"object": obj, "resources": list})
+			switch {
+			case err != nil:
+				message = fmt.Sprintf("evaluation failed: %v", err)
+			case out.Value() == true:
+				continue
+			case out.Value() != false:
+				message = fmt.Sprintf("evaluation failed: expected a bool, got %v", out.Value())
+			}
+			if message == "" {
+				message = p.Expression
+			}
+			violations = append(violations, diff.PolicyViolation{
+				Policy:   p.Name,
+				Resource: resourceName(obj),
+				Message:  message,
+			})
+		}
+	}
+	return violations
+}
+
+// resourceName returns the Kind/namespace/name of an object for display
+func resourceName(obj map[string]any) string {
+	kind, _ := obj["kind"].(string)
+	metadata, _ := obj["metadata"].(map[string]any)
+	name, _ := metadata["name"].(string)
+	if name == "" {
+		name, _ = metadata["generateName"].(string)
+	}
+	if ns, _ := metadata["namespace"].(string); ns != "" {
+		return fmt.Sprintf("%s/%s/%s", kind, ns, name)
+	}
+	return fmt.Sprintf("%s/%s", kind, name)
+}
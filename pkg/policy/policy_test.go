@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tamcore/argo-diff/pkg/diff"
+)
+
+const testPolicies = `
+policies:
+  - name: no-host-network
+    description: Pods must not use the host network
+    kinds: [Deployment, DaemonSet]
+    expression: "!has(object.spec.template.spec.hostNetwork) || !object.spec.template.spec.hostNetwork"
+  - name: deployment-has-pdb
+    description: Every Deployment needs a PodDisruptionBudget
+    kinds: [Deployment]
+    expression: |
+      resources.exists(r, r.kind == "PodDisruptionBudget" &&
+        r.spec.selector.matchLabels == object.spec.selector.matchLabels)
+`
+
+func writePolicyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	set, err := Load(writePolicyFile(t, testPolicies))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if set.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", set.Len())
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() should fail for a missing file")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []Policy
+		wantErr  string
+	}{
+		{"missing name", []Policy{{Expression: "true"}}, "name is required"},
+		{"duplicate name", []Policy{{Name: "a", Expression: "true"}, {Name: "a", Expression: "true"}}, "duplicate name"},
+		{"syntax error", []Policy{{Name: "a", Expression: "object.spec ==="}}, `policy "a"`},
+		{"not a bool", []Policy{{Name: "a", Expression: "1 + 1"}}, "must return a bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.policies)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Compile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func deploymentManifest(name string, hostNetwork bool) string {
+	m := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ` + name + `
+  namespace: prod
+spec:
+  selector:
+    matchLabels:
+      app: ` + name + `
+  template:
+    spec:
+`
+	if hostNetwork {
+		m += "      hostNetwork: true\n"
+	}
+	return m + "      containers:\n      - name: app\n        image: app:v1\n"
+}
+
+const pdbManifest = `
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: web
+  namespace: prod
+spec:
+  selector:
+    matchLabels:
+      app: web
+`
+
+func TestCheckViaDiffEngine(t *testing.T) {
+	set, err := Load(writePolicyFile(t, testPolicies))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	head := []string{deploymentManifest("web", false), pdbManifest, deploymentManifest("worker", true)}
+	result, err := diff.GenerateDiffWithOptions(nil, head, &diff.AppInfo{Name: "app"}, &diff.DiffOptions{Policies: set})
+	if err != nil {
+		t.Fatalf("GenerateDiffWithOptions() error = %v", err)
+	}
+
+	var got []string
+	for _, v := range result.Violations {
+		got = append(got, v.Policy+" "+v.Resource)
+	}
+	want := []string{
+		"no-host-network Deployment/prod/worker",
+		"deployment-has-pdb Deployment/prod/worker",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Violations = %v, want %v", got, want)
+	}
+
+	output := diff.FormatAppDiff(result)
+	if !strings.Contains(output, "- 🚫 `Deployment/prod/worker` violates `no-host-network`: Pods must not use the host network") {
+		t.Errorf("violations should be listed in the app section, got:\n%s", output)
+	}
+}
+
+func TestCheckReportsEvaluationErrors(t *testing.T) {
+	set, err := Compile([]Policy{{Name: "needs-field", Expression: "object.spec.missing == 1"}})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	violations := set.Check([]map[string]any{{
+		"kind":     "ConfigMap",
+		"metadata": map[string]any{"name": "cfg"},
+		"spec":     map[string]any{},
+	}})
+	if len(violations) != 1 || !strings.HasPrefix(violations[0].Message, "evaluation failed:") {
+		t.Errorf("Check() = %v, want one evaluation failure", violations)
+	}
+	if violations[0].Resource != "ConfigMap/cfg" {
+		t.Errorf("Resource = %q, want %q", violations[0].Resource, "ConfigMap/cfg")
+	}
+}
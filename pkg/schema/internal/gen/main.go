@@ -0,0 +1,143 @@
+// Command gen converts the swagger.json of Kubernetes releases into the
+// compact schema bundles embedded by package schema.
+//
+//	go run ./internal/gen -out schemas 1.33 1.34
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tamcore/argo-diff/pkg/schema"
+)
+
+const refPrefix = "#/definitions/"
+
+func main() {
+	source := flag.String("source", "https://raw.githubusercontent.com/kubernetes/kubernetes/release-%s/api/openapi-spec/swagger.json",
+		"URL or file path of swagger.json, with %s replaced by the version")
+	out := flag.String("out", "schemas", "output directory")
+	flag.Parse()
+
+	for _, version := range flag.Args() {
+		if err := generate(*source, version, *out); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", version, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// swaggerSchema is the subset of a swagger.json definition we convert
+type swaggerSchema struct {
+	Type                 string                    `json:"type"`
+	Format               string                    `json:"format"`
+	Ref                  string                    `json:"$ref"`
+	Properties           map[string]*swaggerSchema `json:"properties"`
+	Items                *swaggerSchema            `json:"items"`
+	AdditionalProperties *swaggerSchema            `json:"additionalProperties"`
+	GroupVersionKinds    []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+func generate(source, version, out string) error {
+	data, err := read(fmt.Sprintf(source, version))
+	if err != nil {
+		return err
+	}
+	var swagger struct {
+		Definitions map[string]*swaggerSchema `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &swagger); err != nil {
+		return fmt.Errorf("parse swagger.json: %w", err)
+	}
+
+	bundle := schema.Bundle{
+		Version:     version,
+		Kinds:       map[string]string{},
+		Definitions: map[string]*schema.Schema{},
+	}
+	for name, def := range swagger.Definitions {
+		bundle.Definitions[name] = convert(def)
+		if len(def.Properties) == 0 {
+			continue
+		}
+		for _, gvk := range def.GroupVersionKinds {
+			// Skip shared types like DeleteOptions and WatchEvent, which
+			// list every group
+			if _, ok := def.Properties["apiVersion"]; ok && gvk.Kind != "DeleteOptions" && gvk.Kind != "WatchEvent" {
+				bundle.Kinds[gvk.Group+"/"+gvk.Version+"/"+gvk.Kind] = name
+			}
+		}
+	}
+
+	// Types with custom JSON encodings
+	bundle.Definitions["io.k8s.apimachinery.pkg.util.intstr.IntOrString"] = &schema.Schema{Format: "int-or-string"}
+	bundle.Definitions["io.k8s.apimachinery.pkg.api.resource.Quantity"] = &schema.Schema{Format: "quantity"}
+
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(out, version+".json.gz"))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	zw, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(zw).Encode(bundle); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func convert(s *swaggerSchema) *schema.Schema {
+	if s == nil {
+		return nil
+	}
+	out := &schema.Schema{
+		Type:                 s.Type,
+		Ref:                  strings.TrimPrefix(s.Ref, refPrefix),
+		Items:                convert(s.Items),
+		AdditionalProperties: convert(s.AdditionalProperties),
+	}
+	if s.Format == "int-or-string" {
+		out.Type, out.Format = "", s.Format
+	}
+	if len(s.Properties) > 0 {
+		out.Properties = make(map[string]*schema.Schema, len(s.Properties))
+		for name, p := range s.Properties {
+			out.Properties[name] = convert(p)
+		}
+	}
+	return out
+}
+
+func read(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", source, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,355 @@
+// Package schema validates Kubernetes manifests against the OpenAPI schemas
+// of the built-in API types, embedded per Kubernetes version, and against
+// the schemas of CustomResourceDefinitions.
+package schema
+
+import (
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tamcore/argo-diff/pkg/kubeversion"
+)
+
+//go:generate go run ./internal/gen -out schemas 1.31 1.32 1.33 1.34
+
+//go:embed schemas/*.json.gz
+var bundles embed.FS
+
+// Schema is the subset of an OpenAPI schema used for validation. Objects
+// with Properties reject unknown fields, objects without Properties and
+// AdditionalProperties accept any fields.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"` // "int-or-string" and "quantity" accept numbers and strings
+	Ref                  string             `json:"ref,omitempty"`    // name of a definition in the bundle
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	PreserveUnknown      bool               `json:"preserveUnknown,omitempty"`  // x-kubernetes-preserve-unknown-fields
+	EmbeddedResource     bool               `json:"embeddedResource,omitempty"` // x-kubernetes-embedded-resource
+}
+
+// Bundle holds the schemas of a Kubernetes version, as generated from its
+// swagger.json
+type Bundle struct {
+	Version     string             `json:"version"`
+	Kinds       map[string]string  `json:"kinds"` // "group/version/Kind" to definition name
+	Definitions map[string]*Schema `json:"definitions"`
+}
+
+// Versions returns the embedded Kubernetes versions, oldest first
+func Versions() []string {
+	entries, _ := bundles.ReadDir("schemas")
+	var versions []string
+	for _, e := range entries {
+		versions = append(versions, strings.TrimSuffix(e.Name(), ".json.gz"))
+	}
+	slices.SortFunc(versions, kubeversion.Compare)
+	return versions
+}
+
+// Validator validates manifests against the schemas of a Kubernetes version
+// and optional CRDs
+type Validator struct {
+	version string
+	defs    map[string]*Schema
+	kinds   map[string]*Schema // "group/version/Kind" to root schema
+}
+
+var (
+	loadedMu sync.Mutex
+	loaded   = map[string]*Validator{}
+)
+
+// Load returns the validator for the newest embedded version not newer than
+// version, or for the oldest embedded version if all are newer. An empty
+// version selects the newest embedded version. Validators are cached, so
+// they must not be modified; see WithCRDs.
+func Load(version string) (*Validator, error) {
+	versions := Versions()
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no schemas embedded")
+	}
+	selected := versions[0]
+	if version == "" {
+		selected = versions[len(versions)-1]
+	} else {
+		if _, _, ok := kubeversion.Parse(version); !ok {
+			return nil, fmt.Errorf("invalid Kubernetes version %q", version)
+		}
+		for _, v := range versions {
+			if kubeversion.Compare(v, version) <= 0 {
+				selected = v
+			}
+		}
+	}
+
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+	if v, ok := loaded[selected]; ok {
+		return v, nil
+	}
+	v, err := loadBundle(selected)
+	if err != nil {
+		return nil, err
+	}
+	loaded[selected] = v
+	return v, nil
+}
+
+func loadBundle(version string) (*Validator, error) {
+	data, err := bundles.ReadFile(path.Join("schemas", version+".json.gz"))
+	if err != nil {
+		return nil, fmt.Errorf("read schemas for %s: %w", version, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress schemas for %s: %w", version, err)
+	}
+	var b Bundle
+	if err := json.NewDecoder(zr).Decode(&b); err != nil {
+		return nil, fmt.Errorf("parse schemas for %s: %w", version, err)
+	}
+
+	v := &Validator{version: b.Version, defs: b.Definitions, kinds: map[string]*Schema{}}
+	for gvk, def := range b.Kinds {
+		if s, ok := b.Definitions[def]; ok {
+			v.kinds[gvk] = s
+		}
+	}
+	return v, nil
+}
+
+// Version returns the Kubernetes version of the validator's schemas
+func (v *Validator) Version() string {
+	return v.version
+}
+
+// WithCRDs returns a copy of v that also validates the custom resources of
+// the given CustomResourceDefinition objects. CRDs without a structural
+// schema are skipped, so their resources are not validated.
+func (v *Validator) WithCRDs(crds []map[string]any) *Validator {
+	out := &Validator{version: v.version, defs: v.defs, kinds: maps.Clone(v.kinds)}
+	for _, crd := range crds {
+		spec, _ := crd["spec"].(map[string]any)
+		group, _ := spec["group"].(string)
+		names, _ := spec["names"].(map[string]any)
+		kind, _ := names["kind"].(string)
+		versions, _ := spec["versions"].([]any)
+		if group == "" || kind == "" {
+			continue
+		}
+		for _, item := range versions {
+			ver, _ := item.(map[string]any)
+			name, _ := ver["name"].(string)
+			schema, _ := ver["schema"].(map[string]any)
+			openAPI, _ := schema["openAPIV3Schema"].(map[string]any)
+			if name == "" || openAPI == nil {
+				continue
+			}
+			root := fromOpenAPIV3(openAPI)
+			// apiVersion, kind and metadata are implicit for custom resources
+			root.EmbeddedResource = true
+			out.kinds[group+"/"+name+"/"+kind] = root
+		}
+	}
+	return out
+}
+
+// fromOpenAPIV3 converts a CRD's openAPIV3Schema
+func fromOpenAPIV3(s map[string]any) *Schema {
+	out := &Schema{}
+	out.Type, _ = s["type"].(string)
+	out.PreserveUnknown, _ = s["x-kubernetes-preserve-unknown-fields"].(bool)
+	out.EmbeddedResource, _ = s["x-kubernetes-embedded-resource"].(bool)
+	if intOrString, _ := s["x-kubernetes-int-or-string"].(bool); intOrString {
+		out.Type, out.Format = "", "int-or-string"
+	}
+	if props, ok := s["properties"].(map[string]any); ok {
+		out.Properties = make(map[string]*Schema, len(props))
+		for name, p := range props {
+			if ps, ok := p.(map[string]any); ok {
+				out.Properties[name] = fromOpenAPIV3(ps)
+			}
+		}
+	}
+	if items, ok := s["items"].(map[string]any); ok {
+		out.Items = fromOpenAPIV3(items)
+	}
+	if additional, ok := s["additionalProperties"].(map[string]any); ok {
+		out.AdditionalProperties = fromOpenAPIV3(additional)
+	} else if allowed, _ := s["additionalProperties"].(bool); allowed {
+		out.AdditionalProperties = &Schema{}
+	}
+	return out
+}
+
+// Validate returns the unknown fields and type errors of a manifest, e.g.
+// "spec.replica: unknown field". Kinds without a schema are not validated.
+func (v *Validator) Validate(obj map[string]any) []string {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	if !strings.Contains(apiVersion, "/") {
+		apiVersion = "/" + apiVersion // core group
+	}
+	root, ok := v.kinds[apiVersion+"/"+kind]
+	if !ok {
+		return nil
+	}
+	var errs []string
+	v.validate(root, obj, "", &errs)
+	return errs
+}
+
+// objectMeta is the definition used for metadata of custom and embedded
+// resources
+const objectMeta = "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+
+func (v *Validator) validate(s *Schema, value any, path string, errs *[]string) {
+	if s.Ref != "" {
+		def, ok := v.defs[s.Ref]
+		if !ok {
+			return
+		}
+		s = def
+	}
+	if value == nil {
+		return // null is the same as unset
+	}
+
+	switch s.Format {
+	case "int-or-string":
+		switch value.(type) {
+		case int, string:
+			return
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: expected integer or string, got %s", field(path), typeName(value)))
+		return
+	case "quantity":
+		switch value.(type) {
+		case int, float64, string:
+			return
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: expected quantity, got %s", field(path), typeName(value)))
+		return
+	}
+
+	switch s.Type {
+	case "":
+		if s.Properties == nil && !s.EmbeddedResource {
+			return // any value
+		}
+	case "string":
+		switch value.(type) {
+		case string, time.Time: // unquoted timestamps are decoded as time.Time
+		default:
+			*errs = append(*errs, fmt.Sprintf("%s: expected string, got %s", field(path), typeName(value)))
+		}
+		return
+	case "integer":
+		switch n := value.(type) {
+		case int:
+			return
+		case float64:
+			if n == float64(int64(n)) {
+				return
+			}
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: expected integer, got %s", field(path), typeName(value)))
+		return
+	case "number":
+		switch value.(type) {
+		case int, float64:
+			return
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: expected number, got %s", field(path), typeName(value)))
+		return
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected boolean, got %s", field(path), typeName(value)))
+		}
+		return
+	case "array":
+		list, ok := value.([]any)
+		if !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: expected array, got %s", field(path), typeName(value)))
+			return
+		}
+		if s.Items != nil {
+			for i, item := range list {
+				v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+		return
+	}
+
+	obj, ok := value.(map[string]any)
+	if !ok {
+		*errs = append(*errs, fmt.Sprintf("%s: expected object, got %s", field(path), typeName(value)))
+		return
+	}
+	for _, name := range slices.Sorted(maps.Keys(obj)) {
+		child := join(path, name)
+		if p, ok := s.Properties[name]; ok {
+			v.validate(p, obj[name], child, errs)
+			continue
+		}
+		if s.EmbeddedResource {
+			switch name {
+			case "apiVersion", "kind":
+				v.validate(&Schema{Type: "string"}, obj[name], child, errs)
+				continue
+			case "metadata":
+				v.validate(&Schema{Ref: objectMeta}, obj[name], child, errs)
+				continue
+			}
+		}
+		switch {
+		case s.AdditionalProperties != nil:
+			v.validate(s.AdditionalProperties, obj[name], child, errs)
+		case s.Properties != nil && !s.PreserveUnknown:
+			*errs = append(*errs, fmt.Sprintf("%s: unknown field", child))
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// field returns path, or "(root)" for the top level
+func field(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// typeName returns the JSON type of a decoded YAML value
+func typeName(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case int, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,241 @@
+package schema
+
+import (
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tamcore/argo-diff/pkg/kubeversion"
+)
+
+func parse(t *testing.T, manifest string) map[string]any {
+	t.Helper()
+	var obj map[string]any
+	if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+		t.Fatalf("parse manifest: %v", err)
+	}
+	return obj
+}
+
+func TestVersions(t *testing.T) {
+	versions := Versions()
+	if len(versions) == 0 {
+		t.Fatal("no schemas embedded")
+	}
+	if !slices.IsSortedFunc(versions, kubeversion.Compare) {
+		t.Errorf("Versions() = %v, want sorted", versions)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	versions := Versions()
+	oldest, newest := versions[0], versions[len(versions)-1]
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"", newest},
+		{newest, newest},
+		{"v" + newest + ".3", newest},
+		{"1.99", newest},
+		{"1.20", oldest}, // older than every embedded version
+	}
+	for _, tt := range tests {
+		v, err := Load(tt.version)
+		if err != nil {
+			t.Fatalf("Load(%q) error = %v", tt.version, err)
+		}
+		if v.Version() != tt.want {
+			t.Errorf("Load(%q).Version() = %q, want %q", tt.version, v.Version(), tt.want)
+		}
+	}
+
+	if _, err := Load("latest"); err == nil {
+		t.Error("Load(\"latest\") should fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	v, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		want     []string
+	}{
+		{
+			name: "valid deployment",
+			manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+  creationTimestamp: null
+  annotations:
+    deployed-at: 2024-01-01T00:00:00Z
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: app
+        image: web:v1
+        ports:
+        - containerPort: 8080
+        resources:
+          requests:
+            cpu: 0.5
+            memory: 128Mi
+          limits:
+            cpu: 1
+        readinessProbe:
+          httpGet:
+            port: http
+`,
+		},
+		{
+			name: "unknown fields and type errors",
+			manifest: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    version: 2
+spec:
+  replica: 3
+  template:
+    spec:
+      containers:
+      - name: app
+        image: web:v1
+        imagePullPolicy: true
+        ports:
+        - containerPort: "8080"
+      - name: sidecar
+        imagee: proxy:v1
+`,
+			want: []string{
+				"metadata.labels.version: expected string, got number",
+				"spec.replica: unknown field",
+				"spec.template.spec.containers[0].imagePullPolicy: expected string, got boolean",
+				"spec.template.spec.containers[0].ports[0].containerPort: expected integer, got string",
+				"spec.template.spec.containers[1].imagee: unknown field",
+			},
+		},
+		{
+			name: "core group",
+			manifest: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  creationTimestamp: 2024-01-01T00:00:00Z
+spec:
+  ports:
+  - port: 80
+    targetPort: [8080]
+`,
+			want: []string{"spec.ports[0].targetPort: expected integer or string, got array"},
+		},
+		{
+			name: "unknown kind",
+			manifest: `
+apiVersion: example.com/v1
+kind: Widget
+spec:
+  anything: goes
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := v.Validate(parse(t, tt.manifest))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCRD(t *testing.T) {
+	base, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	crd := parse(t, `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              size:
+                type: integer
+              port:
+                x-kubernetes-int-or-string: true
+              config:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+              tags:
+                type: object
+                additionalProperties:
+                  type: string
+`)
+	v := base.WithCRDs([]map[string]any{crd})
+
+	got := v.Validate(parse(t, `
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+  annotations:
+    a: b
+spec:
+  size: "large"
+  port: http
+  config:
+    anything: goes
+  tags:
+    team: 1
+  colour: red
+status: {}
+`))
+	want := []string{
+		"spec.colour: unknown field",
+		"spec.size: expected integer, got string",
+		"spec.tags.team: expected string, got number",
+		"status: unknown field",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Validate() = %q, want %q", got, want)
+	}
+
+	if errs := base.Validate(parse(t, "apiVersion: example.com/v1\nkind: Widget\nspec:\n  colour: red\n")); errs != nil {
+		t.Errorf("WithCRDs should not modify the cached validator, got %q", errs)
+	}
+}
@@ -0,0 +1,203 @@
+package worker
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tamcore/argo-diff/pkg/logging"
+	"github.com/tamcore/argo-diff/pkg/metrics"
+)
+
+// Job states reported by Pool.Jobs
+const (
+	JobQueued   = "queued"
+	JobRetrying = "retrying" // waiting for its backoff to expire
+	JobRunning  = "running"
+)
+
+type jobContextKey struct{}
+
+// jobContext is stored in the context of jobs processed by a pool
+type jobContext struct {
+	pool *Pool
+	job  Job
+	run  *runningJob
+}
+
+// SetStage records what the job of ctx is currently doing, e.g. "listing
+// applications", for Pool.Jobs. It is a no-op for contexts not created by a
+// pool.
+func SetStage(ctx context.Context, stage string) {
+	info, ok := ctx.Value(jobContextKey{}).(jobContext)
+	if !ok {
+		return
+	}
+	info.pool.trackMu.Lock()
+	defer info.pool.trackMu.Unlock()
+
+	info.run.stage = stage
+}
+
+// JobInfo describes a queued, retrying or running job. It omits the job's
+// tokens, since it is exposed via the admin API.
+type JobInfo struct {
+	ID           string     `json:"id"`
+	State        string     `json:"state"`
+	Repository   string     `json:"repository"`
+	PRNumber     int        `json:"pr_number"`
+	WorkflowName string     `json:"workflow_name,omitempty"`
+	BaseRef      string     `json:"base_ref"`
+	HeadRef      string     `json:"head_ref"`
+	Attempt      int        `json:"attempt"`
+	SubmittedAt  time.Time  `json:"submitted_at"`
+	AgeSeconds   float64    `json:"age_seconds"`
+	WorkerID     *int       `json:"worker_id,omitempty"`  // running jobs only
+	StartedAt    *time.Time `json:"started_at,omitempty"` // running jobs only
+	Stage        string     `json:"stage,omitempty"`      // running jobs only, see SetStage
+}
+
+func newJobInfo(job Job, state string, now time.Time) JobInfo {
+	info := JobInfo{
+		ID:           strconv.FormatUint(job.seq, 10),
+		State:        state,
+		Repository:   job.Repository,
+		PRNumber:     job.PRNumber,
+		WorkflowName: job.WorkflowName,
+		BaseRef:      job.BaseRef,
+		HeadRef:      job.HeadRef,
+		Attempt:      job.attempt + 1,
+		SubmittedAt:  job.submittedAt,
+	}
+	if !job.submittedAt.IsZero() {
+		info.AgeSeconds = now.Sub(job.submittedAt).Seconds()
+	}
+	return info
+}
+
+// Jobs returns the running jobs, the jobs waiting for a retry and the queued
+// jobs, oldest first. With a shared queue, the queued jobs of all replicas
+// are listed, but only the jobs this replica runs or retries.
+func (p *Pool) Jobs() []JobInfo {
+	now := time.Now()
+	var jobs []JobInfo
+
+	p.trackMu.Lock()
+	for _, r := range p.running {
+		info := newJobInfo(r.job, JobRunning, now)
+		workerID, startedAt := r.workerID, r.startedAt
+		info.WorkerID = &workerID
+		info.StartedAt = &startedAt
+		info.Stage = r.stage
+		jobs = append(jobs, info)
+	}
+	p.trackMu.Unlock()
+
+	p.retryMu.Lock()
+	for _, r := range p.retries {
+		jobs = append(jobs, newJobInfo(r.job, JobRetrying, now))
+	}
+	p.retryMu.Unlock()
+
+	for _, job := range p.queue.list() {
+		jobs = append(jobs, newJobInfo(job, JobQueued, now))
+	}
+
+	slices.SortStableFunc(jobs, func(a, b JobInfo) int {
+		return cmp.Compare(b.AgeSeconds, a.AgeSeconds)
+	})
+	return jobs
+}
+
+// Cancel cancels the job with the given ID (see JobInfo): a running job is
+// cancelled with cause ErrCancelled, a queued or retrying one is dropped.
+// Returns false if there is no such job.
+func (p *Pool) Cancel(id string) bool {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	p.trackMu.Lock()
+	for _, r := range p.running {
+		if r.seq == seq {
+			r.cancel(ErrCancelled)
+			p.trackMu.Unlock()
+			logging.Info("Running job cancelled", "repository", r.job.Repository, "pr_number", r.job.PRNumber, "id", id)
+			return true
+		}
+	}
+	p.trackMu.Unlock()
+
+	if job, ok := p.cancelRetry(seq); ok {
+		p.dropped(job)
+		return true
+	}
+	for _, job := range p.queue.list() {
+		if job.seq == seq && p.queue.remove(job) {
+			p.dropped(job)
+			return true
+		}
+	}
+	return false
+}
+
+// cancelRetry stops the pending retry of the job with the given sequence
+// number
+func (p *Pool) cancelRetry(seq uint64) (Job, bool) {
+	p.retryMu.Lock()
+	defer p.retryMu.Unlock()
+
+	for timer, r := range p.retries {
+		if r.job.seq == seq {
+			timer.Stop()
+			delete(p.retries, timer)
+			return r.job, true
+		}
+	}
+	return Job{}, false
+}
+
+// dropped removes the tracking state of a queued or retrying job that was
+// cancelled
+func (p *Pool) dropped(job Job) {
+	p.trackMu.Lock()
+	if p.latest[job.key()] == job.seq {
+		delete(p.latest, job.key())
+	}
+	p.trackMu.Unlock()
+
+	metrics.RecordJobCancelled(job.Repository)
+	logging.Info("Queued job cancelled", "repository", job.Repository, "pr_number", job.PRNumber, "id", strconv.FormatUint(job.seq, 10))
+}
+
+// Pause stops the workers from taking new jobs. Running jobs finish and new
+// jobs are still accepted. With a shared queue, only this replica pauses.
+func (p *Pool) Pause() {
+	p.paused.Store(true)
+	p.queue.pause(true)
+	logging.Info("Worker pool paused")
+}
+
+// Resume lets the workers take new jobs again after Pause
+func (p *Pool) Resume() {
+	p.paused.Store(false)
+	p.queue.pause(false)
+	logging.Info("Worker pool resumed")
+}
+
+// Drain stops accepting new jobs, so the pool reports not ready, and lets
+// the workers finish the already-accepted jobs, even if paused. Jobs waiting
+// for a retry are dead-lettered. The pool cannot be restarted.
+//
+// With a shared queue, queued jobs and jobs waiting for a retry are left to
+// the other replicas.
+func (p *Pool) Drain() {
+	p.draining.Store(true)
+	p.paused.Store(false)
+	p.queue.pause(false)
+	p.queue.close()
+	p.stopRetries()
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoolJobs(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	pool := NewPool(1, 10, time.Minute, func(ctx context.Context, job Job) error {
+		SetStage(ctx, "diffing app")
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	pool.Start()
+	defer pool.Stop(time.Second)
+	defer close(release)
+
+	pool.Submit(Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc", WorkflowName: "prod", GitHubToken: "ghs_x"})
+	<-started
+	pool.Submit(Job{Repository: "org/app", PRNumber: 2, HeadRef: "def"})
+
+	jobs := pool.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("Jobs() returned %d jobs, want 2", len(jobs))
+	}
+
+	running, queued := jobs[0], jobs[1]
+	if running.State != JobRunning || running.PRNumber != 1 || running.WorkflowName != "prod" {
+		t.Errorf("jobs[0] = %+v, want the running job of PR 1", running)
+	}
+	if running.WorkerID == nil || *running.WorkerID != 0 || running.StartedAt == nil {
+		t.Errorf("running job worker = %v, started = %v, want worker 0", running.WorkerID, running.StartedAt)
+	}
+	if running.Stage != "diffing app" || running.Attempt != 1 || running.AgeSeconds <= 0 {
+		t.Errorf("running job = %+v", running)
+	}
+	if queued.State != JobQueued || queued.PRNumber != 2 || queued.WorkerID != nil || queued.ID == running.ID {
+		t.Errorf("jobs[1] = %+v, want the queued job of PR 2", queued)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	started := make(chan struct{}, 1)
+	cause := make(chan error, 1)
+
+	pool := NewPool(1, 10, time.Minute, func(ctx context.Context, job Job) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+		return ctx.Err()
+	})
+	pool.Start()
+	defer pool.Stop(time.Second)
+
+	pool.Submit(Job{Repository: "org/app", PRNumber: 1})
+	<-started
+	pool.Submit(Job{Repository: "org/app", PRNumber: 2})
+
+	jobs := pool.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("Jobs() returned %d jobs, want 2", len(jobs))
+	}
+	if !pool.Cancel(jobs[1].ID) {
+		t.Fatal("Cancel() = false for a queued job")
+	}
+	if got := pool.Status().QueueLength; got != 0 {
+		t.Errorf("QueueLength = %d after cancelling the queued job, want 0", got)
+	}
+
+	if !pool.Cancel(jobs[0].ID) {
+		t.Fatal("Cancel() = false for a running job")
+	}
+	select {
+	case err := <-cause:
+		if err != ErrCancelled {
+			t.Errorf("context cause = %v, want ErrCancelled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("running job was not cancelled")
+	}
+
+	if pool.Cancel("12345") || pool.Cancel("not-a-number") {
+		t.Error("Cancel() = true for an unknown job")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if dl := pool.DeadLetters(); len(dl) != 0 {
+		t.Errorf("DeadLetters() = %+v, want none for cancelled jobs", dl)
+	}
+}
+
+func TestPoolCancelPendingRetry(t *testing.T) {
+	failed := make(chan struct{}, 1)
+	pool := NewPool(1, 10, time.Minute, func(ctx context.Context, job Job) error {
+		failed <- struct{}{}
+		return context.DeadlineExceeded
+	})
+	pool.SetRetryPolicy(3, time.Hour)
+	pool.Start()
+	defer pool.Stop(time.Second)
+
+	pool.Submit(Job{Repository: "org/app", PRNumber: 1})
+	<-failed
+	deadline := time.Now().Add(time.Second)
+	for pool.Status().PendingRetries == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	jobs := pool.Jobs()
+	if len(jobs) != 1 || jobs[0].State != JobRetrying || jobs[0].Attempt != 2 {
+		t.Fatalf("Jobs() = %+v, want one retrying job", jobs)
+	}
+	if !pool.Cancel(jobs[0].ID) {
+		t.Fatal("Cancel() = false for a retrying job")
+	}
+	if got := pool.Status().PendingRetries; got != 0 {
+		t.Errorf("PendingRetries = %d, want 0", got)
+	}
+}
+
+func TestPoolPauseResume(t *testing.T) {
+	processed := make(chan int, 1)
+	pool := NewPool(1, 10, time.Minute, func(ctx context.Context, job Job) error {
+		processed <- job.PRNumber
+		return nil
+	})
+	pool.Start()
+	defer pool.Stop(time.Second)
+
+	pool.Pause()
+	if !pool.Status().Paused {
+		t.Error("Status().Paused = false after Pause()")
+	}
+	if !pool.Submit(Job{Repository: "org/app", PRNumber: 1}) {
+		t.Fatal("Submit() should accept jobs while paused")
+	}
+	select {
+	case <-processed:
+		t.Fatal("job processed while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.Resume()
+	select {
+	case <-processed:
+	case <-time.After(time.Second):
+		t.Fatal("job not processed after Resume()")
+	}
+}
+
+func TestPoolDrain(t *testing.T) {
+	processed := make(chan int, 2)
+	pool := NewPool(1, 10, time.Minute, func(ctx context.Context, job Job) error {
+		processed <- job.PRNumber
+		return nil
+	})
+	pool.Start()
+
+	pool.Pause()
+	pool.Submit(Job{Repository: "org/app", PRNumber: 1})
+	pool.Drain()
+
+	if pool.IsReady() {
+		t.Error("IsReady() = true after Drain()")
+	}
+	if pool.Submit(Job{Repository: "org/app", PRNumber: 2}) {
+		t.Error("Submit() should reject jobs after Drain()")
+	}
+	select {
+	case pr := <-processed:
+		if pr != 1 {
+			t.Errorf("processed PR %d, want 1", pr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued job not processed after Drain() of a paused pool")
+	}
+	pool.Stop(time.Second)
+}
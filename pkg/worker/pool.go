@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -10,17 +11,54 @@ import (
 	"github.com/tamcore/argo-diff/pkg/metrics"
 )
 
+// ErrSuperseded is the context cause of a running job that was cancelled
+// because a newer job for the same PR and workflow was submitted
+var ErrSuperseded = errors.New("superseded by a newer job")
+
+// ErrHandedOver is the context cause of a running job that another replica
+// took over, because this one is stopping or lost the job's lease
+var ErrHandedOver = errors.New("handed over to another replica")
+
+// ErrCancelled is the context cause of a running job cancelled via Cancel
+var ErrCancelled = errors.New("cancelled by an operator")
+
 // Pool manages a pool of workers that process jobs
 type Pool struct {
-	jobQueue    chan Job
+	queue       queue
+	weights     map[string]int
 	workerCount int
 	jobTimeout  time.Duration
-	mu          sync.RWMutex
-	closeOnce   sync.Once
 	wg          sync.WaitGroup
 	processor   JobProcessor
 	draining    atomic.Bool
+	paused      atomic.Bool
 	activeJobs  atomic.Int32
+
+	// Tracks the newest submitted and the running job per PR and workflow,
+	// so older jobs are cancelled and their retries dropped
+	trackMu sync.Mutex
+	latest  map[jobKey]uint64
+	running map[jobKey]*runningJob
+
+	// Transiently failed jobs are retried with exponential backoff; jobs
+	// that will not be retried are kept in the dead-letter list
+	maxRetries   int
+	retryBackoff time.Duration
+	retryMu      sync.Mutex
+	retries      map[*time.Timer]pendingRetry
+	deadLetters  []DeadLetter
+}
+
+// runningJob is a job being processed by a worker
+type runningJob struct {
+	job       Job
+	seq       uint64
+	headRef   string
+	cancel    context.CancelCauseFunc
+	workerID  int
+	startedAt time.Time
+	stage     string // guarded by Pool.trackMu, see SetStage
+	willRetry bool   // guarded by Pool.trackMu, see WillRetry
 }
 
 // JobProcessor is a function that processes a job
@@ -31,13 +69,32 @@ type JobProcessor func(ctx context.Context, job Job) error
 // a worker forever.
 func NewPool(workerCount, queueSize int, jobTimeout time.Duration, processor JobProcessor) *Pool {
 	return &Pool{
-		jobQueue:    make(chan Job, queueSize),
+		queue:       newFairQueue(queueSize),
 		workerCount: workerCount,
 		jobTimeout:  jobTimeout,
 		processor:   processor,
+		latest:      make(map[jobKey]uint64),
+		running:     make(map[jobKey]*runningJob),
+		retries:     make(map[*time.Timer]pendingRetry),
 	}
 }
 
+// SetRepoWeights sets how many jobs a repository may dequeue per turn when
+// several repositories have queued jobs. Keys are repository names or "*"
+// for all others; repositories without a weight get 1. Call before Start.
+func (p *Pool) SetRepoWeights(weights map[string]int) {
+	p.weights = weights
+	p.queue.setWeights(weights)
+}
+
+// SetRetryPolicy retries jobs failing with a transient error (see
+// IsTransient) up to maxRetries times, waiting backoff before the first
+// retry and doubling it for each further one. Call before Start.
+func (p *Pool) SetRetryPolicy(maxRetries int, backoff time.Duration) {
+	p.maxRetries = maxRetries
+	p.retryBackoff = backoff
+}
+
 // Start starts all workers in the pool
 func (p *Pool) Start() {
 	for i := 0; i < p.workerCount; i++ {
@@ -47,38 +104,100 @@ func (p *Pool) Start() {
 	logging.Info("Worker pool started", "workers", p.workerCount)
 }
 
-// Submit adds a job to the queue
+// Submit adds a job to its repository's queue
 // Returns false if the pool is draining or queue is full
+//
+// The job supersedes older jobs for the same repository, PR and workflow:
+// a queued one is replaced, and a running one is cancelled (with cause
+// ErrSuperseded) unless it diffs the same head ref.
 func (p *Pool) Submit(job Job) bool {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
 	if p.draining.Load() {
 		return false
 	}
 
-	select {
-	case p.jobQueue <- job:
-		metrics.JobsInQueue.Inc()
-		return true
-	default:
+	p.trackMu.Lock()
+	defer p.trackMu.Unlock()
+
+	job.submittedAt = time.Now()
+	job, ok := p.queue.push(job)
+	if !ok {
 		return false
 	}
+
+	key := job.key()
+	p.latest[key] = job.seq
+	if r, ok := p.running[key]; ok && r.headRef != job.HeadRef {
+		r.cancel(ErrSuperseded)
+	}
+	return true
 }
 
-// Stop gracefully stops the pool. It stops accepting new jobs, lets the
-// workers drain all already-accepted (queued) jobs, and waits up to timeout
-// for them to finish.
-func (p *Pool) Stop(timeout time.Duration) {
-	p.draining.Store(true)
+// start registers a dequeued job as running on a worker and returns its
+// context
+func (p *Pool) start(job Job, workerID int) (context.Context, context.CancelCauseFunc) {
+	p.trackMu.Lock()
+	defer p.trackMu.Unlock()
+
+	key := job.key()
+	// Jobs from a shared queue may have been submitted by another replica
+	if p.latest[key] < job.seq {
+		p.latest[key] = job.seq
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	run := &runningJob{
+		job:       job,
+		seq:       job.seq,
+		headRef:   job.HeadRef,
+		cancel:    cancel,
+		workerID:  workerID,
+		startedAt: time.Now(),
+	}
+	p.running[key] = run
+	return context.WithValue(ctx, jobContextKey{}, jobContext{pool: p, job: job, run: run}), cancel
+}
+
+// cancelJob cancels a running job with the given cause
+func (p *Pool) cancelJob(job Job, cause error) {
+	p.trackMu.Lock()
+	defer p.trackMu.Unlock()
+
+	if r, ok := p.running[job.key()]; ok && r.seq == job.seq {
+		r.cancel(cause)
+	}
+}
+
+// isLatest reports whether no newer job for the same PR and workflow was
+// submitted
+func (p *Pool) isLatest(job Job) bool {
+	p.trackMu.Lock()
+	defer p.trackMu.Unlock()
+
+	return p.latest[job.key()] == job.seq
+}
+
+// finish removes the tracking state of a processed job, unless a newer job
+// for the same PR and workflow replaced it. A job that will be retried stays
+// the latest one, so a newer job still supersedes the retry.
+func (p *Pool) finish(job Job, retrying bool) {
+	p.queue.done(job)
+
+	p.trackMu.Lock()
+	defer p.trackMu.Unlock()
 
-	// Close the queue under the write lock so no Submit can race a send
-	// against the close.
-	p.closeOnce.Do(func() {
-		p.mu.Lock()
-		close(p.jobQueue)
-		p.mu.Unlock()
-	})
+	key := job.key()
+	if r, ok := p.running[key]; ok && r.seq == job.seq {
+		delete(p.running, key)
+	}
+	if !retrying && p.latest[key] == job.seq {
+		delete(p.latest, key)
+	}
+}
+
+// Stop gracefully stops the pool. It drains the pool (see Drain) and waits
+// up to timeout for the workers to finish. With a shared queue, the jobs
+// still running after timeout are left to the other replicas.
+func (p *Pool) Stop(timeout time.Duration) {
+	p.Drain()
 
 	// Wait for workers with timeout
 	done := make(chan struct{})
@@ -92,17 +211,23 @@ func (p *Pool) Stop(timeout time.Duration) {
 		logging.Info("Worker pool stopped gracefully")
 	case <-time.After(timeout):
 		logging.Warn("Worker pool stop timed out", "timeout", timeout)
+		for _, job := range p.queue.handover() {
+			p.cancelJob(job, ErrHandedOver)
+		}
 	}
 }
 
 // Status returns the current status of the pool
 func (p *Pool) Status() PoolStatus {
 	return PoolStatus{
-		QueueLength: len(p.jobQueue),
-		QueueSize:   cap(p.jobQueue),
-		ActiveJobs:  int(p.activeJobs.Load()),
-		WorkerCount: p.workerCount,
-		Draining:    p.draining.Load(),
+		QueueLength:        p.queue.len(),
+		QueueSize:          p.queue.capacity(),
+		QueuedByRepository: p.queue.lengths(),
+		ActiveJobs:         int(p.activeJobs.Load()),
+		PendingRetries:     p.pendingRetries(),
+		WorkerCount:        p.workerCount,
+		Draining:           p.draining.Load(),
+		Paused:             p.paused.Load(),
 	}
 }
 
@@ -113,11 +238,14 @@ func (p *Pool) IsReady() bool {
 
 // PoolStatus represents the current state of the worker pool
 type PoolStatus struct {
-	QueueLength int  `json:"queue_length"`
-	QueueSize   int  `json:"queue_size"`
-	ActiveJobs  int  `json:"active_jobs"`
-	WorkerCount int  `json:"worker_count"`
-	Draining    bool `json:"draining"`
+	QueueLength        int            `json:"queue_length"`
+	QueueSize          int            `json:"queue_size"`
+	QueuedByRepository map[string]int `json:"queued_by_repository"`
+	ActiveJobs         int            `json:"active_jobs"`
+	PendingRetries     int            `json:"pending_retries"`
+	WorkerCount        int            `json:"worker_count"`
+	Draining           bool           `json:"draining"`
+	Paused             bool           `json:"paused"`
 }
 
 func (p *Pool) worker(id int) {
@@ -127,27 +255,53 @@ func (p *Pool) worker(id int) {
 	workerLog.Info("Worker started")
 	defer workerLog.Info("Worker stopped")
 
-	for job := range p.jobQueue {
-		metrics.JobsInQueue.Dec()
-		p.activeJobs.Add(1)
+	for {
+		job, ok := p.queue.pop()
+		if !ok {
+			return
+		}
 
 		jobLog := logging.WithFields(
 			"worker_id", id,
 			"repository", job.Repository,
 			"pr_number", job.PRNumber,
+			"attempt", job.attempt+1,
 		)
+
+		parent, cancelParent := p.start(job, id)
+		p.activeJobs.Add(1)
 		jobLog.Info("Processing job")
 
 		startTime := time.Now()
-		ctx, cancel := context.WithTimeout(context.Background(), p.jobTimeout)
+		ctx, cancel := context.WithTimeout(parent, p.jobTimeout)
 		err := p.processor(ctx, job)
+		superseded := errors.Is(context.Cause(ctx), ErrSuperseded)
+		handedOver := errors.Is(context.Cause(ctx), ErrHandedOver)
+		cancelled := errors.Is(context.Cause(ctx), ErrCancelled)
+		retry := !superseded && !handedOver && !cancelled && WillRetry(ctx, err)
 		cancel()
+		cancelParent(nil)
+		p.finish(job, retry)
 		duration := time.Since(startTime).Seconds()
 
 		p.activeJobs.Add(-1)
 		metrics.ProcessingDuration.WithLabelValues(job.Repository).Observe(duration)
 
-		if err != nil {
+		if superseded {
+			metrics.RecordJobSuperseded(job.Repository)
+			jobLog.Info("Job cancelled by a newer job", "duration_seconds", duration)
+		} else if handedOver {
+			metrics.RecordJobHandedOver(job.Repository)
+			jobLog.Info("Job handed over to another replica", "duration_seconds", duration)
+		} else if cancelled {
+			metrics.RecordJobCancelled(job.Repository)
+			jobLog.Info("Job cancelled by an operator", "duration_seconds", duration)
+		} else if retry {
+			delay := p.scheduleRetry(job, err)
+			metrics.RecordJobRetry(job.Repository)
+			jobLog.Warn("Job failed, retrying", "error", err, "duration_seconds", duration, "retry_in", delay)
+		} else if err != nil {
+			p.deadLetter(job, err, IsTransient(err))
 			metrics.RecordJobFailure(job.Repository)
 			jobLog.Error("Job failed", "error", err, "duration_seconds", duration)
 		} else {
@@ -18,8 +18,8 @@ func TestNewPool(t *testing.T) {
 	if pool.workerCount != 3 {
 		t.Errorf("expected workerCount=3, got %d", pool.workerCount)
 	}
-	if cap(pool.jobQueue) != 10 {
-		t.Errorf("expected queue capacity=10, got %d", cap(pool.jobQueue))
+	if pool.queue.capacity() != 10 {
+		t.Errorf("expected queue capacity=10, got %d", pool.queue.capacity())
 	}
 }
 
@@ -274,3 +274,121 @@ func TestPoolConcurrentSubmit(t *testing.T) {
 		t.Errorf("expected 50 processed jobs, got %d", processed.Load())
 	}
 }
+
+func TestPoolDropsSupersededQueuedJobs(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var processed []string
+
+	processor := func(ctx context.Context, job Job) error {
+		if job.HeadRef == "blocker" {
+			<-release
+		}
+		mu.Lock()
+		processed = append(processed, job.HeadRef)
+		mu.Unlock()
+		return nil
+	}
+
+	pool := NewPool(1, 10, time.Minute, processor)
+	pool.Start()
+
+	// Keep the only worker busy so the following jobs stay queued
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 99, HeadRef: "blocker"})
+	time.Sleep(20 * time.Millisecond)
+
+	for _, ref := range []string{"a", "b", "c"} {
+		pool.Submit(Job{Repository: "test/repo", PRNumber: 1, WorkflowName: "diff", HeadRef: ref})
+	}
+	// Other PRs and workflows are not superseded
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 2, WorkflowName: "diff", HeadRef: "other-pr"})
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, WorkflowName: "lint", HeadRef: "other-workflow"})
+
+	close(release)
+	pool.Stop(time.Second)
+
+	want := []string{"blocker", "c", "other-pr", "other-workflow"}
+	if len(processed) != len(want) {
+		t.Fatalf("processed = %v, want %v", processed, want)
+	}
+	for i := range want {
+		if processed[i] != want[i] {
+			t.Errorf("processed = %v, want %v", processed, want)
+			break
+		}
+	}
+}
+
+func TestPoolCancelsSupersededRunningJob(t *testing.T) {
+	started := make(chan string, 2)
+	cause := make(chan error, 1)
+
+	processor := func(ctx context.Context, job Job) error {
+		started <- job.HeadRef
+		if job.HeadRef == "old" {
+			<-ctx.Done()
+			cause <- context.Cause(ctx)
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	pool := NewPool(2, 10, time.Minute, processor)
+	pool.Start()
+	defer pool.Stop(time.Second)
+
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "old"})
+	if ref := <-started; ref != "old" {
+		t.Fatalf("started %q, want old", ref)
+	}
+
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "new"})
+
+	select {
+	case err := <-cause:
+		if err != ErrSuperseded {
+			t.Errorf("context cause = %v, want ErrSuperseded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("running job was not cancelled")
+	}
+	if ref := <-started; ref != "new" {
+		t.Errorf("started %q, want new", ref)
+	}
+}
+
+func TestPoolKeepsRunningJobForSameHeadRef(t *testing.T) {
+	release := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	var runs atomic.Int32
+
+	processor := func(ctx context.Context, job Job) error {
+		if runs.Add(1) > 1 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			cancelled <- true
+		case <-release:
+			cancelled <- false
+		}
+		return nil
+	}
+
+	pool := NewPool(2, 10, time.Minute, processor)
+	pool.Start()
+
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "same"})
+	time.Sleep(20 * time.Millisecond)
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "same"})
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	pool.Stop(time.Second)
+
+	if <-cancelled {
+		t.Error("a job for the same head ref should not cancel the running one")
+	}
+	if runs.Load() != 2 {
+		t.Errorf("runs = %d, want 2", runs.Load())
+	}
+}
@@ -0,0 +1,312 @@
+package worker
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tamcore/argo-diff/pkg/metrics"
+)
+
+// queue holds the jobs waiting for a worker. fairQueue keeps them in memory,
+// redisQueue shares them between replicas.
+type queue interface {
+	setWeights(weights map[string]int)
+	// push adds a new job, replacing a queued job with the same key, and
+	// returns it with its sequence number set. Returns false if the queue
+	// is full or closed.
+	push(job Job) (Job, bool)
+	// requeue adds a job to be retried, unless a newer job with the same key
+	// was pushed. Returns false if the queue is full or closed.
+	requeue(job Job) bool
+	// pop blocks until a job is available and returns it. A job is not
+	// available while a popped job with the same key is unfinished, so one
+	// PR is never diffed twice at once. Returns false once the queue is
+	// closed.
+	pop() (Job, bool)
+	// done marks a popped job as finished
+	done(job Job)
+	// pause makes pop wait (or stop waiting) for resume
+	pause(paused bool)
+	// list returns the queued jobs
+	list() []Job
+	// remove drops a queued job, if it is still queued. Returns false
+	// otherwise.
+	remove(job Job) bool
+	// close stops the queue: fairQueue rejects pushes and lets pop drain
+	// the queued jobs, redisQueue stops claiming jobs and leaves them to
+	// the other replicas
+	close()
+	// handover returns unfinished popped jobs to the queue, so another
+	// replica takes them over, and returns those jobs
+	handover() []Job
+	len() int
+	capacity() int
+	lengths() map[string]int
+}
+
+// fairQueue is a bounded job queue with a sub-queue per repository. Jobs are
+// dequeued round-robin across repositories, taking up to the repository's
+// weight jobs per turn, so a repository with a large backlog cannot starve
+// the others. Jobs of one repository stay in submission order.
+type fairQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	size    int
+	length  int
+	closed  bool
+	paused  bool
+	nextSeq uint64
+
+	queues  map[string][]Job
+	active  map[jobKey]bool // keys of popped, unfinished jobs
+	order   []string        // repositories with queued jobs, in round-robin order
+	next    int             // index in order of the repository whose turn it is
+	served  int             // jobs taken from order[next] in its current turn
+	weights map[string]int
+}
+
+func newFairQueue(capacity int) *fairQueue {
+	q := &fairQueue{
+		size:   capacity,
+		queues: make(map[string][]Job),
+		active: make(map[jobKey]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// setWeights sets the number of jobs a repository may dequeue per turn.
+// Keys are repository names or "*" for all others; the default weight is 1.
+func (q *fairQueue) setWeights(weights map[string]int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.weights = make(map[string]int, len(weights))
+	for repo, w := range weights {
+		q.weights[strings.ToLower(repo)] = w
+	}
+}
+
+func (q *fairQueue) weight(repo string) int {
+	if w, ok := q.weights[strings.ToLower(repo)]; ok && w > 0 {
+		return w
+	}
+	if w, ok := q.weights["*"]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// push adds a job to its repository's sub-queue. A queued job with the same
+// key is superseded: the new job takes its place.
+func (q *fairQueue) push(job Job) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return job, false
+	}
+	q.nextSeq++
+	job.seq = q.nextSeq
+
+	queued := q.queues[job.Repository]
+	if i := slices.IndexFunc(queued, func(j Job) bool { return j.key() == job.key() }); i >= 0 {
+		queued[i] = job
+		metrics.RecordJobSuperseded(job.Repository)
+		return job, true
+	}
+	return job, q.add(job)
+}
+
+// requeue adds a retried job, unless a newer job with the same key is queued
+func (q *fairQueue) requeue(job Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	if slices.ContainsFunc(q.queues[job.Repository], func(j Job) bool { return j.key() == job.key() }) {
+		metrics.RecordJobSuperseded(job.Repository)
+		return true
+	}
+	return q.add(job)
+}
+
+// add appends a job to its repository's sub-queue
+func (q *fairQueue) add(job Job) bool {
+	if q.length >= q.size {
+		return false
+	}
+	repo := job.Repository
+	if len(q.queues[repo]) == 0 {
+		q.order = append(q.order, repo)
+	}
+	q.queues[repo] = append(q.queues[repo], job)
+	q.length++
+	metrics.SetJobsInQueue(repo, len(q.queues[repo]))
+	q.cond.Signal()
+	return true
+}
+
+// pop blocks until a job is available and the queue is not paused, and
+// returns it. Returns false once the queue is closed and empty.
+func (q *fairQueue) pop() (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.length == 0 && q.closed {
+			return Job{}, false
+		}
+		if !q.paused || q.closed {
+			if job, ok := q.take(); ok {
+				return job, true
+			}
+		}
+		q.cond.Wait()
+	}
+}
+
+// take removes and returns the first job whose key is not active, from the
+// repository whose turn it is or, if all of its jobs wait for a running job
+// with the same key, from the next repository that has one. Only jobs taken
+// in turn count towards the repository's weight.
+func (q *fairQueue) take() (Job, bool) {
+	for offset := range len(q.order) {
+		i := (q.next + offset) % len(q.order)
+		repo := q.order[i]
+		jobs := q.queues[repo]
+		j := slices.IndexFunc(jobs, func(job Job) bool { return !q.active[job.key()] })
+		if j < 0 {
+			continue
+		}
+
+		job := jobs[j]
+		q.active[job.key()] = true
+		q.length--
+		metrics.SetJobsInQueue(repo, len(jobs)-1)
+
+		if len(jobs) == 1 {
+			q.dropRepo(i)
+			return job, true
+		}
+
+		// Delete clears the vacated slot, dropping the reference to the
+		// job's tokens
+		q.queues[repo] = slices.Delete(jobs, j, j+1)
+		if offset == 0 {
+			q.served++
+			if q.served >= q.weight(repo) {
+				q.served = 0
+				q.next = (q.next + 1) % len(q.order)
+			}
+		}
+		return job, true
+	}
+	return Job{}, false
+}
+
+// dropRepo removes the repository at index i of order, whose sub-queue is
+// empty
+func (q *fairQueue) dropRepo(i int) {
+	delete(q.queues, q.order[i])
+	q.order = slices.Delete(q.order, i, i+1)
+	switch {
+	case i < q.next:
+		q.next--
+	case i == q.next:
+		// The next repository moves into its slot and starts a new turn
+		q.served = 0
+	}
+	if q.next >= len(q.order) {
+		q.next = 0
+	}
+}
+
+func (q *fairQueue) pause(paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.paused = paused
+	q.cond.Broadcast()
+}
+
+// list returns the queued jobs in round-robin order of their repositories
+func (q *fairQueue) list() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]Job, 0, q.length)
+	for _, repo := range q.order {
+		jobs = append(jobs, q.queues[repo]...)
+	}
+	return jobs
+}
+
+func (q *fairQueue) remove(job Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := q.queues[job.Repository]
+	i := slices.IndexFunc(jobs, func(j Job) bool { return j.seq == job.seq })
+	if i < 0 {
+		return false
+	}
+	q.length--
+	metrics.SetJobsInQueue(job.Repository, len(jobs)-1)
+	if len(jobs) == 1 {
+		q.dropRepo(slices.Index(q.order, job.Repository))
+		return true
+	}
+	q.queues[job.Repository] = slices.Delete(jobs, i, i+1)
+	return true
+}
+
+// done lets queued jobs with the key of a finished job be popped
+func (q *fairQueue) done(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.active, job.key())
+	q.cond.Broadcast()
+}
+
+// handover returns nil, since other replicas cannot see this queue
+func (q *fairQueue) handover() []Job { return nil }
+
+// close rejects further pushes and wakes blocked pops, which drain the
+// remaining jobs before returning false
+func (q *fairQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// len returns the number of queued jobs
+func (q *fairQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.length
+}
+
+// capacity returns the maximum number of queued jobs
+func (q *fairQueue) capacity() int {
+	return q.size
+}
+
+// lengths returns the number of queued jobs per repository
+func (q *fairQueue) lengths() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make(map[string]int, len(q.queues))
+	for repo, jobs := range q.queues {
+		out[repo] = len(jobs)
+	}
+	return out
+}
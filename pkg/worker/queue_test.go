@@ -0,0 +1,232 @@
+package worker
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+// drain pops every queued job and returns "repository#pr" per job
+func drain(t *testing.T, q *fairQueue) []string {
+	t.Helper()
+	q.close()
+	var order []string
+	for {
+		job, ok := q.pop()
+		if !ok {
+			return order
+		}
+		order = append(order, fmt.Sprintf("%s#%d", job.Repository, job.PRNumber))
+	}
+}
+
+func TestFairQueueRoundRobin(t *testing.T) {
+	q := newFairQueue(10)
+	for pr := 1; pr <= 4; pr++ {
+		q.push(Job{Repository: "org/monorepo", PRNumber: pr})
+	}
+	q.push(Job{Repository: "org/app", PRNumber: 1})
+	q.push(Job{Repository: "org/other", PRNumber: 1})
+	q.push(Job{Repository: "org/app", PRNumber: 2})
+
+	want := map[string]int{"org/monorepo": 4, "org/app": 2, "org/other": 1}
+	if got := q.lengths(); !maps.Equal(got, want) {
+		t.Errorf("lengths() = %v, want %v", got, want)
+	}
+
+	got := drain(t, q)
+	wantOrder := []string{
+		"org/monorepo#1", "org/app#1", "org/other#1",
+		"org/monorepo#2", "org/app#2",
+		"org/monorepo#3", "org/monorepo#4",
+	}
+	if !slices.Equal(got, wantOrder) {
+		t.Errorf("dequeue order = %v, want %v", got, wantOrder)
+	}
+}
+
+func TestFairQueueWeights(t *testing.T) {
+	q := newFairQueue(10)
+	q.setWeights(map[string]int{"Org/Platform": 3, "*": 2})
+	for pr := 1; pr <= 4; pr++ {
+		q.push(Job{Repository: "org/platform", PRNumber: pr})
+	}
+	for pr := 1; pr <= 3; pr++ {
+		q.push(Job{Repository: "org/app", PRNumber: pr})
+	}
+
+	got := drain(t, q)
+	want := []string{
+		"org/platform#1", "org/platform#2", "org/platform#3",
+		"org/app#1", "org/app#2",
+		"org/platform#4",
+		"org/app#3",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("dequeue order = %v, want %v", got, want)
+	}
+}
+
+func TestFairQueueCapacity(t *testing.T) {
+	q := newFairQueue(2)
+	push := func(job Job) bool {
+		_, ok := q.push(job)
+		return ok
+	}
+	if !push(Job{Repository: "a/a"}) || !push(Job{Repository: "b/b"}) {
+		t.Fatal("push should succeed below capacity")
+	}
+	if push(Job{Repository: "c/c"}) {
+		t.Error("push should fail when the queue is full across repositories")
+	}
+	if !push(Job{Repository: "a/a", HeadRef: "newer"}) {
+		t.Error("push should replace a queued job with the same key even when full")
+	}
+	q.close()
+	if push(Job{Repository: "a/a"}) {
+		t.Error("push should fail after close")
+	}
+	if q.len() != 2 {
+		t.Errorf("len() = %d, want 2", q.len())
+	}
+}
+
+func TestFairQueueReplacesQueuedJob(t *testing.T) {
+	q := newFairQueue(10)
+	first, _ := q.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "a"})
+	q.push(Job{Repository: "org/app", PRNumber: 2, HeadRef: "x"})
+	second, _ := q.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "b"})
+	if second.seq <= first.seq {
+		t.Errorf("seq = %d, want more than %d", second.seq, first.seq)
+	}
+
+	// A retry of the first job is dropped, since a newer one is queued
+	if !q.requeue(first) {
+		t.Error("requeue of a superseded job should succeed")
+	}
+	if q.len() != 2 {
+		t.Fatalf("len() = %d, want 2", q.len())
+	}
+	job, _ := q.pop()
+	if job.HeadRef != "b" || job.seq != second.seq {
+		t.Errorf("pop() = %s (seq %d), want the newer job b in the place of a", job.HeadRef, job.seq)
+	}
+
+	// Once dequeued, the retry is queued again
+	if !q.requeue(job) || q.len() != 2 {
+		t.Errorf("requeue() should add the job, len() = %d", q.len())
+	}
+}
+
+func TestFairQueuePopBlocksUntilPush(t *testing.T) {
+	q := newFairQueue(1)
+	done := make(chan Job)
+	go func() {
+		job, _ := q.pop()
+		done <- job
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("pop should block on an empty queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.push(Job{Repository: "org/app", PRNumber: 7})
+	select {
+	case job := <-done:
+		if job.PRNumber != 7 {
+			t.Errorf("pop() = PR %d, want 7", job.PRNumber)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pop did not return after push")
+	}
+}
+
+func TestFairQueueHoldsJobOfRunningKey(t *testing.T) {
+	q := newFairQueue(10)
+	q.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "a"})
+	running, _ := q.pop()
+
+	// A job for the running PR waits, while other PRs are served
+	q.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "a"})
+	q.push(Job{Repository: "org/app", PRNumber: 2})
+	if job, _ := q.pop(); job.PRNumber != 2 {
+		t.Fatalf("pop() = PR %d, want 2 while PR 1 is running", job.PRNumber)
+	}
+
+	done := make(chan Job)
+	go func() {
+		job, _ := q.pop()
+		done <- job
+	}()
+	select {
+	case job := <-done:
+		t.Fatalf("pop() = PR %d while a job for PR 1 is running", job.PRNumber)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.done(running)
+	select {
+	case job := <-done:
+		if job.PRNumber != 1 {
+			t.Errorf("pop() = PR %d, want 1", job.PRNumber)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pop did not return after the running job finished")
+	}
+}
+
+func TestFairQueueRemove(t *testing.T) {
+	q := newFairQueue(10)
+	var removed Job
+	for pr := 1; pr <= 2; pr++ {
+		q.push(Job{Repository: "org/monorepo", PRNumber: pr})
+	}
+	removed, _ = q.push(Job{Repository: "org/app", PRNumber: 1})
+	q.push(Job{Repository: "org/other", PRNumber: 1})
+
+	if !q.remove(removed) {
+		t.Fatal("remove() = false for a queued job")
+	}
+	if q.remove(removed) {
+		t.Error("remove() = true for a job that is no longer queued")
+	}
+	if got := len(q.list()); got != 3 {
+		t.Errorf("len(list()) = %d, want 3", got)
+	}
+
+	want := []string{"org/monorepo#1", "org/other#1", "org/monorepo#2"}
+	if got := drain(t, q); !slices.Equal(got, want) {
+		t.Errorf("dequeue order = %v, want %v", got, want)
+	}
+}
+
+func TestFairQueuePause(t *testing.T) {
+	q := newFairQueue(1)
+	q.pause(true)
+	q.push(Job{Repository: "org/app", PRNumber: 7})
+	done := make(chan Job)
+	go func() {
+		job, _ := q.pop()
+		done <- job
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("pop should block while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.pause(false)
+	select {
+	case job := <-done:
+		if job.PRNumber != 7 {
+			t.Errorf("pop() = PR %d, want 7", job.PRNumber)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pop did not return after resume")
+	}
+}
@@ -0,0 +1,708 @@
+package worker
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/tamcore/argo-diff/pkg/logging"
+	"github.com/tamcore/argo-diff/pkg/metrics"
+)
+
+const (
+	// redisTimeout bounds each queue operation
+	redisTimeout = 5 * time.Second
+	// redisPollInterval is how often idle workers look for new jobs
+	redisPollInterval = time.Second
+)
+
+// redisQueue is a queue shared by all replicas through Redis. Replicas claim
+// jobs with a lease that they renew while the job runs; the jobs of a replica
+// that stops renewing (e.g. because it crashed) are claimed by another one
+// once their lease expires. A job is never claimed while another job with
+// the same key is leased, so one PR is not diffed by two replicas at once.
+//
+// All state changes are Lua scripts, so they are atomic. They get their keys
+// in KEYS, except the per-repository queues, which claimScript finds through
+// repos. Leases expire by the clock of the Redis server, so replicas need not
+// agree on the time. The tokens of a job are encrypted with a key shared by
+// all replicas, so they are not readable by other clients of the Redis. Keys,
+// below the prefix:
+//
+//	repos              list of repositories with claimable jobs, in round-robin order
+//	served             jobs taken from the first repository in its current turn
+//	queue:<repo>       list of the keys of a repository's claimable jobs
+//	waiting            hash of the repository of a queued job whose key is leased, by key
+//	counts             hash of the number of queued jobs by repository
+//	jobs, seqs         hashes of a queued job and its sequence number by key
+//	leases, leased     hashes of a lease (owner, seq, repo) and its job by key
+//	expiries           sorted set of leased keys by lease expiry
+//	latest             hash of the newest submitted job (seq, head) by key
+//	seq                sequence number counter
+type redisQueue struct {
+	client  redis.UniversalClient
+	prefix  string
+	keys    []string    // redisKeys with the prefix
+	aead    cipher.AEAD // encrypts the tokens of a job
+	size    int
+	lease   time.Duration
+	owner   string
+	cancel  func(job Job, cause error) // cancels a running job, set by the pool
+	weights string                     // JSON, see fairQueue.setWeights
+
+	paused atomic.Bool // only pauses this replica
+	mu     sync.Mutex
+	held   map[jobKey]heldLease
+	closed chan struct{}
+	once   sync.Once
+}
+
+// heldLease is a job claimed by this replica
+type heldLease struct {
+	job  Job
+	stop context.CancelFunc // stops renewing the lease
+}
+
+// wireJob is a job as stored in Redis
+type wireJob struct {
+	Job
+	Tokens      []byte    `json:"tokens,omitempty"` // wireTokens, encrypted
+	Attempt     int       `json:"attempt,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// wireTokens are the tokens of a job, which Job leaves out of its JSON
+type wireTokens struct {
+	GitHub string `json:"github,omitempty"`
+	Argocd string `json:"argocd,omitempty"`
+}
+
+// UseRedis makes the pool share its queue with the other replicas using the
+// same Redis and prefix. The tokens of queued jobs are encrypted with a key
+// derived from secret, which must be the same on all replicas. Running jobs
+// hold a lease that is renewed every third of its duration. Call before
+// SetRepoWeights and Start.
+func (p *Pool) UseRedis(client redis.UniversalClient, prefix, secret string, lease time.Duration) {
+	hostname, _ := os.Hostname()
+	// The hash tag puts all keys in the same Redis Cluster slot, so scripts
+	// can use them together
+	prefix = "{" + prefix + "}:queue:"
+	keys := make([]string, len(redisKeys))
+	for i, key := range redisKeys {
+		keys[i] = prefix + key
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, _ := aes.NewCipher(key[:]) // cannot fail for a 32 byte key
+	aead, _ := cipher.NewGCM(block)
+	p.queue = &redisQueue{
+		client:  client,
+		prefix:  prefix,
+		keys:    keys,
+		aead:    aead,
+		size:    p.queue.capacity(),
+		lease:   lease,
+		owner:   hostname + "/" + uuid.NewString()[:8],
+		cancel:  p.cancelJob,
+		weights: "{}",
+		held:    make(map[jobKey]heldLease),
+		closed:  make(chan struct{}),
+	}
+	p.queue.setWeights(p.weights)
+}
+
+// keyString is the Redis representation of a job key
+func keyString(job Job) string {
+	return fmt.Sprintf("%s#%d#%s", job.Repository, job.PRNumber, job.WorkflowName)
+}
+
+func (q *redisQueue) setWeights(weights map[string]int) {
+	lower := make(map[string]int, len(weights))
+	for repo, w := range weights {
+		lower[strings.ToLower(repo)] = w
+	}
+	data, _ := json.Marshal(lower)
+	q.weights = string(data)
+}
+
+// redisKeys are the names, below the prefix, of the keys every script gets
+// in KEYS, in the order luaQueue unpacks them
+var redisKeys = []string{"repos", "served", "jobs", "seqs", "waiting", "counts", "leases", "leased", "expiries", "latest", "seq"}
+
+// luaQueue is shared by all scripts. ARGV[1] is the prefix of the
+// per-repository queues.
+const luaQueue = `
+local repos, served, jobs, seqs, waiting, counts, leases, leased, expiries, latest, counter = unpack(KEYS)
+local queues = ARGV[1]
+
+-- now returns the time of the Redis server in milliseconds
+local function now()
+  local t = redis.call('TIME')
+  return tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+
+-- count adds delta to the number of queued jobs of a repository, and
+-- returns it
+local function count(repo, delta)
+  local n = redis.call('HINCRBY', counts, repo, delta)
+  if n <= 0 then
+    redis.call('HDEL', counts, repo)
+  end
+  return n
+end
+
+-- ready adds a key to its repository's queue of claimable jobs
+local function ready(key, repo, front)
+  local q = queues .. repo
+  if redis.call('LLEN', q) == 0 then
+    redis.call('RPUSH', repos, repo)
+  end
+  if front then
+    redis.call('LPUSH', q, key)
+  else
+    redis.call('RPUSH', q, key)
+  end
+end
+
+-- enqueue adds a job, which waits while a job with the same key is leased.
+-- Returns the number of queued jobs of the repository.
+local function enqueue(key, repo, job, seq, front)
+  redis.call('HSET', jobs, key, job)
+  redis.call('HSET', seqs, key, seq)
+  if redis.call('HEXISTS', leases, key) == 1 then
+    redis.call('HSET', waiting, key, repo)
+  else
+    ready(key, repo, front)
+  end
+  return count(repo, 1)
+end
+
+local function newer(key, seq)
+  local l = redis.call('HGET', latest, key)
+  return l and cjson.decode(l).seq > seq
+end
+
+-- unlease removes the lease of a key, and lets a job waiting for it be
+-- claimed
+local function unlease(key)
+  redis.call('HDEL', leases, key)
+  redis.call('HDEL', leased, key)
+  redis.call('ZREM', expiries, key)
+  local repo = redis.call('HGET', waiting, key)
+  if repo then
+    redis.call('HDEL', waiting, key)
+    ready(key, repo, true)
+  end
+end
+
+-- restore queues a leased job again, unless a newer one was submitted
+local function restore(key, lease)
+  local job = redis.call('HGET', leased, key)
+  unlease(key)
+  if job and redis.call('HEXISTS', jobs, key) == 0 and not newer(key, lease.seq) then
+    enqueue(key, lease.repo, job, lease.seq, true)
+  end
+end
+`
+
+// pushScript replaces the queued job with the same key, or appends the job
+// if the queue has room. Returns {seq, replaced, queued jobs of the
+// repository}, with seq 0 if the queue is full.
+var pushScript = redis.NewScript(luaQueue + `
+local key, repo, job, head, size = ARGV[2], ARGV[3], ARGV[4], ARGV[5], tonumber(ARGV[6])
+local replaced = redis.call('HEXISTS', jobs, key)
+if replaced == 0 and redis.call('HLEN', jobs) >= size then
+  return {0, 0, 0}
+end
+local seq = redis.call('INCR', counter)
+redis.call('HSET', latest, key, cjson.encode({seq = seq, head = head}))
+if replaced == 1 then
+  redis.call('HSET', jobs, key, job)
+  redis.call('HSET', seqs, key, seq)
+  return {seq, 1, tonumber(redis.call('HGET', counts, repo))}
+end
+return {seq, 0, enqueue(key, repo, job, seq, false)}
+`)
+
+// requeueScript appends a retried job, unless a newer job with the same key
+// was submitted. Returns the queued jobs of the repository, -1 if
+// superseded or 0 if full.
+var requeueScript = redis.NewScript(luaQueue + `
+local key, repo, job, head, seq, size = ARGV[2], ARGV[3], ARGV[4], ARGV[5], tonumber(ARGV[6]), tonumber(ARGV[7])
+if newer(key, seq) or redis.call('HEXISTS', jobs, key) == 1 then
+  return -1
+end
+if redis.call('HLEN', jobs) >= size then
+  return 0
+end
+redis.call('HSET', latest, key, cjson.encode({seq = seq, head = head}))
+return enqueue(key, repo, job, seq, false)
+`)
+
+// claimScript requeues jobs with an expired lease, then leases the next
+// claimable job in round-robin order across repositories. Returns {job, seq,
+// repo, queued jobs of the repository}, or nil if there is none.
+var claimScript = redis.NewScript(luaQueue + `
+local owner, lease, weights = ARGV[2], tonumber(ARGV[3]), cjson.decode(ARGV[4])
+local t = now()
+
+for _, key in ipairs(redis.call('ZRANGEBYSCORE', expiries, '-inf', t)) do
+  local raw = redis.call('HGET', leases, key)
+  if raw then
+    restore(key, cjson.decode(raw))
+  else
+    redis.call('ZREM', expiries, key)
+  end
+end
+
+local repo = redis.call('LINDEX', repos, 0)
+if not repo then
+  return false
+end
+local q = queues .. repo
+local key = redis.call('LPOP', q)
+local job = redis.call('HGET', jobs, key)
+local seq = tonumber(redis.call('HGET', seqs, key))
+redis.call('HDEL', jobs, key)
+redis.call('HDEL', seqs, key)
+local left = count(repo, -1)
+
+-- The repository keeps its turn until it took its weight in jobs
+local weight = weights[string.lower(repo)] or weights['*'] or 1
+if redis.call('INCR', served) >= weight or redis.call('LLEN', q) == 0 then
+  redis.call('LPOP', repos)
+  if redis.call('LLEN', q) > 0 then
+    redis.call('RPUSH', repos, repo)
+  end
+  redis.call('SET', served, 0)
+end
+
+redis.call('HSET', leases, key, cjson.encode({owner = owner, seq = seq, repo = repo}))
+redis.call('HSET', leased, key, job)
+redis.call('ZADD', expiries, t + lease, key)
+return {job, seq, repo, left}
+`)
+
+// renewScript extends a lease. Returns "ok", "lost" if the lease expired
+// and was taken over, or "superseded" if a job for another head ref was
+// submitted.
+var renewScript = redis.NewScript(luaQueue + `
+local key, owner, seq, lease, head = ARGV[2], ARGV[3], tonumber(ARGV[4]), tonumber(ARGV[5]), ARGV[6]
+local raw = redis.call('HGET', leases, key)
+if not raw then
+  return 'lost'
+end
+local l = cjson.decode(raw)
+if l.owner ~= owner or l.seq ~= seq then
+  return 'lost'
+end
+local newest = redis.call('HGET', latest, key)
+if newest then
+  newest = cjson.decode(newest)
+  if newest.seq > seq and newest.head ~= head then
+    return 'superseded'
+  end
+end
+redis.call('ZADD', expiries, now() + lease, key)
+return 'ok'
+`)
+
+// completeScript removes the lease of a finished job
+var completeScript = redis.NewScript(luaQueue + `
+local key, owner, seq = ARGV[2], ARGV[3], tonumber(ARGV[4])
+local raw = redis.call('HGET', leases, key)
+if not raw then
+  return 0
+end
+local l = cjson.decode(raw)
+if l.owner ~= owner or l.seq ~= seq then
+  return 0
+end
+unlease(key)
+local newest = redis.call('HGET', latest, key)
+if newest and cjson.decode(newest).seq == seq then
+  redis.call('HDEL', latest, key)
+end
+return 1
+`)
+
+// removeScript drops a queued job if it has the given sequence number.
+// Returns the queued jobs of the repository, or -1 if the job is no longer
+// queued.
+var removeScript = redis.NewScript(luaQueue + `
+local key, repo, seq = ARGV[2], ARGV[3], tonumber(ARGV[4])
+if tonumber(redis.call('HGET', seqs, key)) ~= seq then
+  return -1
+end
+redis.call('HDEL', jobs, key)
+redis.call('HDEL', seqs, key)
+if redis.call('HDEL', waiting, key) == 0 then
+  local q = queues .. repo
+  redis.call('LREM', q, 1, key)
+  if redis.call('LLEN', q) == 0 then
+    if redis.call('LINDEX', repos, 0) == repo then
+      redis.call('SET', served, 0)
+    end
+    redis.call('LREM', repos, 1, repo)
+  end
+end
+local newest = redis.call('HGET', latest, key)
+if newest and cjson.decode(newest).seq == seq then
+  redis.call('HDEL', latest, key)
+end
+return count(repo, -1)
+`)
+
+// releaseScript queues a leased job again for another replica
+var releaseScript = redis.NewScript(luaQueue + `
+local key, owner, seq = ARGV[2], ARGV[3], tonumber(ARGV[4])
+local raw = redis.call('HGET', leases, key)
+if not raw then
+  return 0
+end
+local l = cjson.decode(raw)
+if l.owner ~= owner or l.seq ~= seq then
+  return 0
+end
+restore(key, l)
+return 1
+`)
+
+// encode returns the JSON of job as stored in Redis. The tokens are bound to
+// the job's key, so they cannot be moved to another job.
+func (q *redisQueue) encode(job Job) ([]byte, error) {
+	tokens, err := json.Marshal(wireTokens{GitHub: job.GitHubToken, Argocd: job.ArgocdToken})
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, q.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(wireJob{
+		Job:         job,
+		Tokens:      q.aead.Seal(nonce, nonce, tokens, []byte(keyString(job))),
+		Attempt:     job.attempt,
+		SubmittedAt: job.submittedAt,
+	})
+}
+
+// decode returns the job stored as data with its tokens and unexported
+// fields set
+func (q *redisQueue) decode(data string, seq uint64) (Job, error) {
+	var w wireJob
+	if err := json.Unmarshal([]byte(data), &w); err != nil {
+		return Job{}, fmt.Errorf("decode job: %w", err)
+	}
+	job := w.Job
+	size := q.aead.NonceSize()
+	if len(w.Tokens) < size {
+		return Job{}, errors.New("decode job: missing tokens")
+	}
+	plain, err := q.aead.Open(nil, w.Tokens[:size], w.Tokens[size:], []byte(keyString(job)))
+	if err != nil {
+		return Job{}, fmt.Errorf("decrypt job tokens (is the key the same on all replicas?): %w", err)
+	}
+	var tokens wireTokens
+	if err := json.Unmarshal(plain, &tokens); err != nil {
+		return Job{}, fmt.Errorf("decode job tokens: %w", err)
+	}
+	job.GitHubToken = tokens.GitHub
+	job.ArgocdToken = tokens.Argocd
+	job.seq = seq
+	job.attempt = w.Attempt
+	job.submittedAt = w.SubmittedAt
+	return job, nil
+}
+
+func (q *redisQueue) push(job Job) (Job, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := q.encode(job)
+	if err != nil {
+		logging.Error("Failed to encode job", "repository", job.Repository, "error", err)
+		return job, false
+	}
+	res, err := pushScript.Run(ctx, q.client, q.keys, q.prefix+"queue:", keyString(job), job.Repository, data, job.HeadRef, q.size).Int64Slice()
+	if err != nil {
+		logging.Error("Failed to queue job in Redis", "repository", job.Repository, "error", err)
+		return job, false
+	}
+	if res[0] == 0 {
+		return job, false
+	}
+	job.seq = uint64(res[0])
+	if res[1] == 1 {
+		metrics.RecordJobSuperseded(job.Repository)
+	}
+	metrics.SetJobsInQueue(job.Repository, int(res[2]))
+	return job, true
+}
+
+func (q *redisQueue) requeue(job Job) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := q.encode(job)
+	if err != nil {
+		logging.Error("Failed to encode job", "repository", job.Repository, "error", err)
+		return false
+	}
+	n, err := requeueScript.Run(ctx, q.client, q.keys, q.prefix+"queue:", keyString(job), job.Repository, data, job.HeadRef, job.seq, q.size).Int64()
+	if err != nil {
+		logging.Error("Failed to requeue job in Redis", "repository", job.Repository, "error", err)
+		return false
+	}
+	switch {
+	case n < 0:
+		metrics.RecordJobSuperseded(job.Repository)
+	case n > 0:
+		metrics.SetJobsInQueue(job.Repository, int(n))
+	}
+	return n != 0
+}
+
+// pop polls for a claimable job until one is found or the queue is closed
+func (q *redisQueue) pop() (Job, bool) {
+	for {
+		select {
+		case <-q.closed:
+			return Job{}, false
+		default:
+		}
+
+		if !q.paused.Load() {
+			job, ok, err := q.claim()
+			if err != nil {
+				logging.Warn("Failed to claim job from Redis", "error", err)
+			}
+			if ok {
+				return job, true
+			}
+		}
+
+		select {
+		case <-q.closed:
+			return Job{}, false
+		case <-time.After(redisPollInterval):
+		}
+	}
+}
+
+// claim leases the next job and starts renewing the lease
+func (q *redisQueue) claim() (Job, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	res, err := claimScript.Run(ctx, q.client, q.keys, q.prefix+"queue:", q.owner, q.lease.Milliseconds(), q.weights).Slice()
+	if errors.Is(err, redis.Nil) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	if len(res) != 4 {
+		return Job{}, false, fmt.Errorf("unexpected claim result %v", res)
+	}
+	data, _ := res[0].(string)
+	seq, _ := res[1].(int64)
+	repo, _ := res[2].(string)
+	left, _ := res[3].(int64)
+	metrics.SetJobsInQueue(repo, int(left))
+
+	job, err := q.decode(data, uint64(seq))
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	renewCtx, stop := context.WithCancel(context.Background())
+	q.mu.Lock()
+	q.held[job.key()] = heldLease{job: job, stop: stop}
+	q.mu.Unlock()
+	go q.renew(renewCtx, job)
+	return job, true, nil
+}
+
+// renew extends the lease of a running job until stopped. The job is
+// cancelled if its lease was lost or a job for another head ref was
+// submitted on any replica.
+func (q *redisQueue) renew(ctx context.Context, job Job) {
+	ticker := time.NewTicker(q.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, redisTimeout)
+		res, err := renewScript.Run(callCtx, q.client, q.keys, q.prefix+"queue:", keyString(job), q.owner, job.seq, q.lease.Milliseconds(), job.HeadRef).Text()
+		cancel()
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				logging.Warn("Failed to renew job lease", "repository", job.Repository, "pr_number", job.PRNumber, "error", err)
+			}
+		case res == "superseded":
+			q.cancel(job, ErrSuperseded)
+			return
+		case res == "lost":
+			q.cancel(job, ErrHandedOver)
+			return
+		}
+	}
+}
+
+// release stops renewing the lease of a held job
+func (q *redisQueue) release(job Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	h, ok := q.held[job.key()]
+	if !ok || h.job.seq != job.seq {
+		return false
+	}
+	h.stop()
+	delete(q.held, job.key())
+	return true
+}
+
+func (q *redisQueue) done(job Job) {
+	if !q.release(job) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if err := completeScript.Run(ctx, q.client, q.keys, q.prefix+"queue:", keyString(job), q.owner, job.seq).Err(); err != nil {
+		logging.Warn("Failed to complete job lease", "repository", job.Repository, "pr_number", job.PRNumber, "error", err)
+	}
+}
+
+func (q *redisQueue) pause(paused bool) {
+	q.paused.Store(paused)
+}
+
+// list returns the jobs queued by all replicas
+func (q *redisQueue) list() []Job {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	var jobs, seqs *redis.MapStringStringCmd
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		jobs = pipe.HGetAll(ctx, q.prefix+"jobs")
+		seqs = pipe.HGetAll(ctx, q.prefix+"seqs")
+		return nil
+	})
+	if err != nil {
+		logging.Warn("Failed to list queued jobs in Redis", "error", err)
+		return nil
+	}
+
+	var out []Job
+	for key, data := range jobs.Val() {
+		seq, err := strconv.ParseUint(seqs.Val()[key], 10, 64)
+		if err != nil {
+			continue
+		}
+		job, err := q.decode(data, seq)
+		if err != nil {
+			logging.Warn("Failed to decode queued job", "key", key, "error", err)
+			continue
+		}
+		out = append(out, job)
+	}
+	return out
+}
+
+func (q *redisQueue) remove(job Job) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	n, err := removeScript.Run(ctx, q.client, q.keys, q.prefix+"queue:", keyString(job), job.Repository, job.seq).Int64()
+	if err != nil {
+		logging.Error("Failed to remove job from Redis", "repository", job.Repository, "error", err)
+		return false
+	}
+	if n < 0 {
+		return false
+	}
+	metrics.SetJobsInQueue(job.Repository, int(n))
+	return true
+}
+
+func (q *redisQueue) close() {
+	q.once.Do(func() { close(q.closed) })
+}
+
+func (q *redisQueue) handover() []Job {
+	q.mu.Lock()
+	var jobs []Job
+	for _, h := range q.held {
+		jobs = append(jobs, h.job)
+	}
+	q.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	var released []Job
+	for _, job := range jobs {
+		if !q.release(job) {
+			continue
+		}
+		if err := releaseScript.Run(ctx, q.client, q.keys, q.prefix+"queue:", keyString(job), q.owner, job.seq).Err(); err != nil {
+			// The lease expires, so another replica takes it over later
+			logging.Warn("Failed to hand over job", "repository", job.Repository, "pr_number", job.PRNumber, "error", err)
+		}
+		released = append(released, job)
+	}
+	return released
+}
+
+func (q *redisQueue) len() int {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	n, err := q.client.HLen(ctx, q.prefix+"jobs").Result()
+	if err != nil {
+		logging.Warn("Failed to read queue length from Redis", "error", err)
+	}
+	return int(n)
+}
+
+func (q *redisQueue) capacity() int {
+	return q.size
+}
+
+func (q *redisQueue) lengths() map[string]int {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	counts, err := q.client.HGetAll(ctx, q.prefix+"counts").Result()
+	if err != nil {
+		logging.Warn("Failed to read queue lengths from Redis", "error", err)
+		return map[string]int{}
+	}
+	out := make(map[string]int, len(counts))
+	for repo, n := range counts {
+		out[repo], _ = strconv.Atoi(n)
+	}
+	return out
+}
@@ -0,0 +1,389 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedisPool returns a pool sharing the queue in mr, as one replica
+func newRedisPool(t *testing.T, mr *miniredis.Miniredis, lease time.Duration, processor JobProcessor) (*Pool, *redisQueue) {
+	t.Helper()
+	return newRedisPoolWith(t, mr, "argo-diff", "secret", lease, processor)
+}
+
+// newRedisPoolWith is newRedisPool with the given key prefix and secret
+func newRedisPoolWith(t *testing.T, mr *miniredis.Miniredis, prefix, secret string, lease time.Duration, processor JobProcessor) (*Pool, *redisQueue) {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	pool := NewPool(1, 10, time.Minute, processor)
+	pool.UseRedis(client, prefix, secret, lease)
+	return pool, pool.queue.(*redisQueue)
+}
+
+// claimAll claims jobs until none is left and returns their head refs
+func claimAll(t *testing.T, q *redisQueue) []string {
+	t.Helper()
+	var refs []string
+	for {
+		job, ok, err := q.claim()
+		if err != nil {
+			t.Fatalf("claim() error = %v", err)
+		}
+		if !ok {
+			return refs
+		}
+		refs = append(refs, job.HeadRef)
+		q.done(job)
+	}
+}
+
+func TestRedisQueueSharedBetweenReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	processed := make(chan Job, 1)
+
+	a, _ := newRedisPool(t, mr, time.Minute, nil)
+	b, _ := newRedisPool(t, mr, time.Minute, func(ctx context.Context, job Job) error {
+		processed <- job
+		return nil
+	})
+
+	job := Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc", ChangedFiles: []string{}, GitHubToken: "ghs_x"}
+	if !a.Submit(job) {
+		t.Fatal("Submit() = false")
+	}
+	if got := a.Status().QueueLength; got != 1 {
+		t.Errorf("QueueLength = %d, want 1", got)
+	}
+	b.Start()
+	defer b.Stop(time.Second)
+
+	select {
+	case got := <-processed:
+		if got.Repository != "org/app" || got.HeadRef != "abc" || got.GitHubToken != "ghs_x" {
+			t.Errorf("processed %+v", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("job submitted to one replica was not processed by the other")
+	}
+}
+
+func TestRedisQueueEncryptsTokens(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, _ := newRedisPool(t, mr, time.Minute, nil)
+	_, other := newRedisPoolWith(t, mr, "argo-diff", "other", time.Minute, nil)
+	_, b := newRedisPool(t, mr, time.Minute, nil)
+
+	now := time.Now()
+	mr.SetTime(now)
+
+	job := Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc", GitHubToken: "ghs_secret", ArgocdToken: "argo_secret"}
+	if !a.Submit(job) {
+		t.Fatal("Submit() = false")
+	}
+	for _, key := range mr.Keys() {
+		if mr.Type(key) != "hash" {
+			continue
+		}
+		fields, _ := mr.HKeys(key)
+		for _, field := range fields {
+			if value := mr.HGet(key, field); strings.Contains(value, "ghs_secret") || strings.Contains(value, "argo_secret") {
+				t.Errorf("%s[%s] contains a token in plaintext: %s", key, field, value)
+			}
+		}
+	}
+
+	if _, ok, err := other.claim(); err == nil || ok {
+		t.Errorf("claim() with another key = %v, %v, want an error", ok, err)
+	}
+	// The job is leased by the failed claim until its lease expires
+	mr.SetTime(now.Add(2 * time.Minute))
+
+	got, ok, err := b.claim()
+	if err != nil || !ok {
+		t.Fatalf("claim() = %v, %v", ok, err)
+	}
+	if got.GitHubToken != "ghs_secret" || got.ArgocdToken != "argo_secret" {
+		t.Errorf("claimed tokens = %q, %q", got.GitHubToken, got.ArgocdToken)
+	}
+}
+
+func TestRedisQueuePrefixSeparatesDeployments(t *testing.T) {
+	mr := miniredis.RunT(t)
+	prod, _ := newRedisPoolWith(t, mr, "argo-diff", "secret", time.Minute, nil)
+	_, staging := newRedisPoolWith(t, mr, "argo-diff-staging", "secret", time.Minute, nil)
+
+	if !prod.Submit(Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc"}) {
+		t.Fatal("Submit() = false")
+	}
+	if refs := claimAll(t, staging); len(refs) != 0 {
+		t.Errorf("other deployment claimed %v", refs)
+	}
+	if got := prod.Status().QueueLength; got != 1 {
+		t.Errorf("QueueLength = %d, want 1", got)
+	}
+}
+
+func TestRedisQueueDeduplicatesByPR(t *testing.T) {
+	mr := miniredis.RunT(t)
+	_, q := newRedisPool(t, mr, time.Minute, nil)
+
+	var seqs []uint64
+	for _, ref := range []string{"a", "b", "c"} {
+		job, ok := q.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: ref})
+		if !ok {
+			t.Fatalf("push(%s) = false", ref)
+		}
+		seqs = append(seqs, job.seq)
+	}
+	q.push(Job{Repository: "org/app", PRNumber: 2, HeadRef: "other-pr"})
+
+	if !slices.IsSorted(seqs) || seqs[0] == seqs[2] {
+		t.Errorf("seqs = %v, want increasing", seqs)
+	}
+	if got := q.len(); got != 2 {
+		t.Errorf("len() = %d, want 2", got)
+	}
+	if got, want := claimAll(t, q), []string{"c", "other-pr"}; !slices.Equal(got, want) {
+		t.Errorf("claimed %v, want %v", got, want)
+	}
+}
+
+func TestRedisQueueCapacity(t *testing.T) {
+	mr := miniredis.RunT(t)
+	_, q := newRedisPool(t, mr, time.Minute, nil)
+	q.size = 1
+
+	if _, ok := q.push(Job{Repository: "org/app", PRNumber: 1}); !ok {
+		t.Fatal("push() should succeed below capacity")
+	}
+	if _, ok := q.push(Job{Repository: "org/app", PRNumber: 2}); ok {
+		t.Error("push() should fail when the queue is full")
+	}
+	if _, ok := q.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "newer"}); !ok {
+		t.Error("push() should replace a queued job with the same key even when full")
+	}
+}
+
+func TestRedisQueueRoundRobin(t *testing.T) {
+	mr := miniredis.RunT(t)
+	_, q := newRedisPool(t, mr, time.Minute, nil)
+	q.setWeights(map[string]int{"Org/Platform": 2})
+
+	for _, ref := range []string{"m1", "m2", "m3"} {
+		q.push(Job{Repository: "org/monorepo", PRNumber: int(ref[1] - '0'), HeadRef: ref})
+	}
+	for _, ref := range []string{"p1", "p2", "p3"} {
+		q.push(Job{Repository: "org/platform", PRNumber: int(ref[1] - '0'), HeadRef: ref})
+	}
+	q.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "a1"})
+
+	want := []string{"m1", "p1", "p2", "a1", "m2", "p3", "m3"}
+	if got := q.lengths(); got["org/monorepo"] != 3 || got["org/platform"] != 3 || got["org/app"] != 1 {
+		t.Errorf("lengths() = %v", got)
+	}
+	if got := claimAll(t, q); !slices.Equal(got, want) {
+		t.Errorf("claimed %v, want %v", got, want)
+	}
+}
+
+func TestRedisQueueOneReplicaPerPR(t *testing.T) {
+	mr := miniredis.RunT(t)
+	_, q1 := newRedisPool(t, mr, time.Minute, nil)
+	_, q2 := newRedisPool(t, mr, time.Minute, nil)
+
+	q1.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc"})
+	running, ok, _ := q1.claim()
+	if !ok {
+		t.Fatal("claim() found no job")
+	}
+
+	// A duplicate webhook for the running PR waits for it to finish
+	q2.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc"})
+	q2.push(Job{Repository: "org/app", PRNumber: 2, HeadRef: "other-pr"})
+	if got := claimAll(t, q2); !slices.Equal(got, []string{"other-pr"}) {
+		t.Errorf("claimed %v while PR 1 is running, want [other-pr]", got)
+	}
+	if got := q2.lengths(); got["org/app"] != 1 {
+		t.Errorf("lengths() = %v, want the waiting job counted", got)
+	}
+
+	q1.done(running)
+	if got := claimAll(t, q2); !slices.Equal(got, []string{"abc"}) {
+		t.Errorf("claimed %v after PR 1 finished, want [abc]", got)
+	}
+}
+
+func TestRedisQueueExpiredLeaseIsTakenOver(t *testing.T) {
+	mr := miniredis.RunT(t)
+	_, q1 := newRedisPool(t, mr, time.Minute, nil)
+	_, q2 := newRedisPool(t, mr, time.Minute, nil)
+
+	now := time.Now()
+	mr.SetTime(now)
+
+	q1.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc"})
+	crashed, _, _ := q1.claim()
+	q1.release(crashed) // stop renewing, as if the replica crashed
+
+	if got := claimAll(t, q2); len(got) != 0 {
+		t.Errorf("claimed %v while the lease is valid", got)
+	}
+	mr.SetTime(now.Add(2 * time.Minute))
+	job, ok, err := q2.claim()
+	if err != nil || !ok || job.HeadRef != "abc" || job.seq != crashed.seq {
+		t.Fatalf("claim() after lease expiry = %+v, %v, %v, want the crashed job", job, ok, err)
+	}
+
+	// The old owner no longer holds the lease
+	q1.done(crashed)
+	if got := claimAll(t, q1); len(got) != 0 {
+		t.Errorf("claimed %v, want nothing while q2 holds the lease", got)
+	}
+}
+
+func TestRedisQueueRenewDetectsSupersededJob(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	var mu sync.Mutex
+	var causes []error
+	_, q1 := newRedisPool(t, mr, 30*time.Millisecond, nil)
+	q1.cancel = func(job Job, cause error) {
+		mu.Lock()
+		causes = append(causes, cause)
+		mu.Unlock()
+	}
+	_, q2 := newRedisPool(t, mr, time.Minute, nil)
+
+	q1.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "old"})
+	job, _, _ := q1.claim()
+	defer q1.done(job)
+
+	// Same head ref: the running job keeps going
+	q2.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "old"})
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if len(causes) != 0 {
+		t.Errorf("cancelled with %v for the same head ref", causes)
+	}
+	mu.Unlock()
+
+	q2.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "new"})
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(causes)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(causes) != 1 || causes[0] != ErrSuperseded {
+		t.Errorf("causes = %v, want [ErrSuperseded]", causes)
+	}
+}
+
+func TestRedisPoolStopHandsOverRunningJob(t *testing.T) {
+	mr := miniredis.RunT(t)
+	started := make(chan struct{})
+	cause := make(chan error, 1)
+
+	a, _ := newRedisPool(t, mr, time.Minute, func(ctx context.Context, job Job) error {
+		close(started)
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+		return ctx.Err()
+	})
+	a.Start()
+	a.Submit(Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc"})
+	<-started
+
+	a.Stop(50 * time.Millisecond)
+
+	select {
+	case err := <-cause:
+		if err != ErrHandedOver {
+			t.Errorf("context cause = %v, want ErrHandedOver", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("running job was not cancelled on handover")
+	}
+	if dl := a.DeadLetters(); len(dl) != 0 {
+		t.Errorf("DeadLetters() = %+v, want none for a handed over job", dl)
+	}
+
+	_, b := newRedisPool(t, mr, time.Minute, nil)
+	if got := claimAll(t, b); !slices.Equal(got, []string{"abc"}) {
+		t.Errorf("claimed %v, want the handed over job", got)
+	}
+}
+
+func TestRedisQueueListAndRemove(t *testing.T) {
+	mr := miniredis.RunT(t)
+	_, q1 := newRedisPool(t, mr, time.Minute, nil)
+	_, q2 := newRedisPool(t, mr, time.Minute, nil)
+
+	submitted := time.Now().Add(-time.Minute).Round(time.Millisecond)
+	q1.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "a1", attempt: 1, submittedAt: submitted})
+	q1.push(Job{Repository: "org/app", PRNumber: 2, HeadRef: "a2"})
+	q1.push(Job{Repository: "org/other", PRNumber: 1, HeadRef: "o1"})
+
+	jobs := q2.list()
+	if len(jobs) != 3 {
+		t.Fatalf("list() returned %d jobs, want 3", len(jobs))
+	}
+	i := slices.IndexFunc(jobs, func(j Job) bool { return j.HeadRef == "a1" })
+	if i < 0 || jobs[i].seq == 0 || jobs[i].attempt != 1 || !jobs[i].submittedAt.Equal(submitted) {
+		t.Fatalf("list() = %+v, want a1 with its seq, attempt and submission time", jobs)
+	}
+
+	if !q2.remove(jobs[i]) {
+		t.Fatal("remove() = false for a queued job")
+	}
+	if q2.remove(jobs[i]) {
+		t.Error("remove() = true for a job that is no longer queued")
+	}
+	if got, want := claimAll(t, q1), []string{"a2", "o1"}; !slices.Equal(got, want) {
+		t.Errorf("claimed %v, want %v", got, want)
+	}
+}
+
+func TestRedisQueuePause(t *testing.T) {
+	mr := miniredis.RunT(t)
+	_, q := newRedisPool(t, mr, time.Minute, nil)
+	q.push(Job{Repository: "org/app", PRNumber: 1, HeadRef: "abc"})
+	q.pause(true)
+
+	done := make(chan Job, 1)
+	go func() {
+		job, _ := q.pop()
+		done <- job
+	}()
+	select {
+	case <-done:
+		t.Fatal("pop should not claim jobs while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	q.pause(false)
+	select {
+	case job := <-done:
+		if job.HeadRef != "abc" {
+			t.Errorf("pop() = %q, want abc", job.HeadRef)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("pop did not return after resume")
+	}
+	q.close()
+}
@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/tamcore/argo-diff/pkg/metrics"
+	"github.com/tamcore/argo-diff/pkg/sanitize"
+)
+
+// maxDeadLetters bounds the dead-letter list; older entries are dropped
+const maxDeadLetters = 100
+
+// DeadLetter is a job that failed permanently or ran out of retries. It
+// omits the job's tokens, since the list is exposed via the admin endpoint.
+type DeadLetter struct {
+	Repository   string    `json:"repository"`
+	PRNumber     int       `json:"pr_number"`
+	WorkflowName string    `json:"workflow_name,omitempty"`
+	BaseRef      string    `json:"base_ref"`
+	HeadRef      string    `json:"head_ref"`
+	Attempts     int       `json:"attempts"`
+	Transient    bool      `json:"transient"` // true if the retries were exhausted
+	Error        string    `json:"error"`
+	FailedAt     time.Time `json:"failed_at"`
+}
+
+// IsTransient reports whether err is worth retrying: ArgoCD being briefly
+// unavailable or slow (gRPC Unavailable and DeadlineExceeded), GitHub server
+// errors and secondary rate limits, and network timeouts
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return true
+		}
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return true
+	}
+	var respErr *github.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryAfter returns the delay GitHub asked for with a secondary rate limit
+func retryAfter(err error) time.Duration {
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) && abuseErr.RetryAfter != nil {
+		return *abuseErr.RetryAfter
+	}
+	return 0
+}
+
+// WillRetry reports whether the pool will retry the job of ctx after it
+// failed with err, so the processor can skip reporting the failure. It is
+// false for contexts not created by a pool, e.g. synchronous jobs.
+//
+// Once it returned true, the pool retries the job after a transient error
+// even if it times out or the pool starts draining before the processor
+// returns, since the failure was not reported.
+func WillRetry(ctx context.Context, err error) bool {
+	info, ok := ctx.Value(jobContextKey{}).(jobContext)
+	if !ok || !IsTransient(err) {
+		return false
+	}
+
+	info.pool.trackMu.Lock()
+	defer info.pool.trackMu.Unlock()
+
+	if !info.run.willRetry {
+		// A timed out or cancelled job is not retried
+		info.run.willRetry = ctx.Err() == nil && info.pool.canRetry(info.job)
+	}
+	return info.run.willRetry
+}
+
+// canRetry reports whether the job has retries left
+func (p *Pool) canRetry(job Job) bool {
+	return job.attempt < p.maxRetries && !p.draining.Load()
+}
+
+// retryDelay returns the backoff before the next attempt of job: the base
+// delay doubled per previous attempt, or longer if GitHub asked for it
+func (p *Pool) retryDelay(job Job, err error) time.Duration {
+	return max(p.retryBackoff<<job.attempt, retryAfter(err))
+}
+
+// scheduleRetry requeues job after its backoff, unless a newer job for the
+// same PR and workflow was submitted meanwhile. It is dead-lettered if it
+// cannot be requeued.
+func (p *Pool) scheduleRetry(job Job, err error) time.Duration {
+	delay := p.retryDelay(job, err)
+	job.attempt++
+
+	p.retryMu.Lock()
+	defer p.retryMu.Unlock()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		p.retryMu.Lock()
+		_, pending := p.retries[timer]
+		delete(p.retries, timer)
+		p.retryMu.Unlock()
+
+		if pending {
+			p.requeue(job, err)
+		}
+	})
+	p.retries[timer] = pendingRetry{job: job, err: err}
+	return delay
+}
+
+// pendingRetry is a job waiting for its backoff to expire
+type pendingRetry struct {
+	job Job
+	err error
+}
+
+// requeue adds a job whose backoff expired back to the queue
+func (p *Pool) requeue(job Job, err error) {
+	if !p.isLatest(job) {
+		metrics.RecordJobSuperseded(job.Repository)
+		return
+	}
+	if !p.queue.requeue(job) {
+		p.deadLetter(job, err, true)
+	}
+}
+
+// stopRetries requeues pending retries right away, which dead-letters them
+// unless the queue is shared with other replicas
+func (p *Pool) stopRetries() {
+	p.retryMu.Lock()
+	pending := p.retries
+	p.retries = make(map[*time.Timer]pendingRetry)
+	p.retryMu.Unlock()
+
+	for timer, r := range pending {
+		timer.Stop()
+		p.requeue(r.job, r.err)
+	}
+}
+
+func (p *Pool) pendingRetries() int {
+	p.retryMu.Lock()
+	defer p.retryMu.Unlock()
+
+	return len(p.retries)
+}
+
+// deadLetter records a job that will not be retried
+func (p *Pool) deadLetter(job Job, err error, transient bool) {
+	p.retryMu.Lock()
+	defer p.retryMu.Unlock()
+
+	p.deadLetters = append(p.deadLetters, DeadLetter{
+		Repository:   job.Repository,
+		PRNumber:     job.PRNumber,
+		WorkflowName: job.WorkflowName,
+		BaseRef:      job.BaseRef,
+		HeadRef:      job.HeadRef,
+		Attempts:     job.attempt + 1,
+		Transient:    transient,
+		Error:        sanitize.Error(err),
+		FailedAt:     time.Now(),
+	})
+	if len(p.deadLetters) > maxDeadLetters {
+		p.deadLetters = p.deadLetters[len(p.deadLetters)-maxDeadLetters:]
+	}
+}
+
+// DeadLetters returns the jobs that failed permanently or ran out of
+// retries, oldest first
+func (p *Pool) DeadLetters() []DeadLetter {
+	p.retryMu.Lock()
+	defer p.retryMu.Unlock()
+
+	return slices.Clone(p.deadLetters)
+}
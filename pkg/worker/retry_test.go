@@ -0,0 +1,240 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsTransient(t *testing.T) {
+	resp := func(code int) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, "https://api.github.com/repos/o/r/issues/1/comments", nil)
+		return &http.Response{StatusCode: code, Request: req}
+	}
+	githubErr := func(code int) error {
+		return &github.ErrorResponse{Response: resp(code)}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("invalid repository format"), false},
+		{"grpc unavailable", fmt.Errorf("list applications: %w", status.Error(codes.Unavailable, "repo-server overloaded")), true},
+		{"grpc deadline exceeded", status.Error(codes.DeadlineExceeded, "timeout"), true},
+		{"grpc not found", status.Error(codes.NotFound, "app not found"), false},
+		{"grpc permission denied", status.Error(codes.PermissionDenied, "forbidden"), false},
+		{"github 502", fmt.Errorf("create comment part 1: %w", githubErr(http.StatusBadGateway)), true},
+		{"github 404", githubErr(http.StatusNotFound), false},
+		{"github secondary rate limit", &github.AbuseRateLimitError{Response: resp(http.StatusForbidden), Message: "slow down"}, true},
+		{"network timeout", &net.DNSError{Err: "timeout", IsTimeout: true}, true},
+		{"network error", &net.DNSError{Err: "no such host", IsNotFound: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	pool := NewPool(1, 1, time.Minute, nil)
+	pool.SetRetryPolicy(3, 10*time.Second)
+
+	for attempt, want := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		if got := pool.retryDelay(Job{attempt: attempt}, errors.New("x")); got != want {
+			t.Errorf("retryDelay(attempt %d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	retryAfter := 2 * time.Minute
+	if got := pool.retryDelay(Job{}, &github.AbuseRateLimitError{RetryAfter: &retryAfter}); got != retryAfter {
+		t.Errorf("retryDelay() = %s, want GitHub's Retry-After %s", got, retryAfter)
+	}
+}
+
+func TestWillRetryOutsidePool(t *testing.T) {
+	if WillRetry(context.Background(), status.Error(codes.Unavailable, "down")) {
+		t.Error("WillRetry should be false for jobs not run by a pool")
+	}
+}
+
+func TestPoolRetriesTransientFailure(t *testing.T) {
+	var calls atomic.Int32
+	var willRetry []bool
+	done := make(chan struct{})
+
+	processor := func(ctx context.Context, job Job) error {
+		if calls.Add(1) < 3 {
+			err := status.Error(codes.Unavailable, "repo-server overloaded")
+			willRetry = append(willRetry, WillRetry(ctx, err))
+			return err
+		}
+		close(done)
+		return nil
+	}
+
+	pool := NewPool(1, 10, time.Minute, processor)
+	pool.SetRetryPolicy(2, 10*time.Millisecond)
+	pool.Start()
+	defer pool.Stop(time.Second)
+
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "abc"})
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("job was not retried, calls = %d", calls.Load())
+	}
+	if len(willRetry) != 2 || !willRetry[0] || !willRetry[1] {
+		t.Errorf("WillRetry = %v, want [true true]", willRetry)
+	}
+	if dl := pool.DeadLetters(); len(dl) != 0 {
+		t.Errorf("DeadLetters() = %+v, want none", dl)
+	}
+}
+
+func TestPoolKeepsRetryDecisionAfterTimeout(t *testing.T) {
+	var calls atomic.Int32
+	willRetry := make(chan bool, 1)
+	done := make(chan struct{})
+
+	processor := func(ctx context.Context, job Job) error {
+		if calls.Add(1) == 1 {
+			err := status.Error(codes.Unavailable, "repo-server overloaded")
+			willRetry <- WillRetry(ctx, err)
+			// Time out after the processor skipped reporting the failure
+			<-ctx.Done()
+			return err
+		}
+		close(done)
+		return nil
+	}
+
+	pool := NewPool(1, 10, 50*time.Millisecond, processor)
+	pool.SetRetryPolicy(1, time.Millisecond)
+	pool.Start()
+	defer pool.Stop(time.Second)
+
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "abc"})
+	if !<-willRetry {
+		t.Fatal("WillRetry = false before the timeout")
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("job was not retried after WillRetry promised it, dead letters = %+v", pool.DeadLetters())
+	}
+}
+
+func TestPoolDeadLettersFailedJobs(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int32
+		transient bool
+	}{
+		{"retries exhausted", status.Error(codes.Unavailable, "repo-server overloaded"), 3, true},
+		{"permanent error", errors.New("invalid repository format"), 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			processor := func(ctx context.Context, job Job) error {
+				calls.Add(1)
+				return tt.err
+			}
+
+			pool := NewPool(1, 10, time.Minute, processor)
+			pool.SetRetryPolicy(2, time.Millisecond)
+			pool.Start()
+
+			pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "abc", GitHubToken: "ghs_secret"})
+			deadline := time.Now().Add(2 * time.Second)
+			for len(pool.DeadLetters()) == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			pool.Stop(time.Second)
+
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls.Load(), tt.wantCalls)
+			}
+			dl := pool.DeadLetters()
+			if len(dl) != 1 {
+				t.Fatalf("DeadLetters() = %+v, want one entry", dl)
+			}
+			if dl[0].Repository != "test/repo" || dl[0].HeadRef != "abc" || dl[0].Attempts != int(tt.wantCalls) || dl[0].Transient != tt.transient {
+				t.Errorf("DeadLetters()[0] = %+v", dl[0])
+			}
+		})
+	}
+}
+
+func TestPoolStopDeadLettersPendingRetries(t *testing.T) {
+	failed := make(chan struct{})
+	processor := func(ctx context.Context, job Job) error {
+		defer close(failed)
+		return status.Error(codes.Unavailable, "repo-server overloaded")
+	}
+
+	pool := NewPool(1, 10, time.Minute, processor)
+	pool.SetRetryPolicy(3, time.Hour)
+	pool.Start()
+
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1})
+	<-failed
+	time.Sleep(20 * time.Millisecond)
+	if got := pool.Status().PendingRetries; got != 1 {
+		t.Errorf("PendingRetries = %d, want 1", got)
+	}
+
+	pool.Stop(time.Second)
+
+	if got := pool.Status().PendingRetries; got != 0 {
+		t.Errorf("PendingRetries after Stop = %d, want 0", got)
+	}
+	if dl := pool.DeadLetters(); len(dl) != 1 || !dl[0].Transient || dl[0].Attempts != 2 {
+		t.Errorf("DeadLetters() = %+v, want the pending retry", dl)
+	}
+}
+
+func TestPoolRetryIsSuperseded(t *testing.T) {
+	var refs []string
+	done := make(chan struct{})
+	processor := func(ctx context.Context, job Job) error {
+		refs = append(refs, job.HeadRef)
+		if job.HeadRef == "old" {
+			return status.Error(codes.Unavailable, "repo-server overloaded")
+		}
+		close(done)
+		return nil
+	}
+
+	pool := NewPool(1, 10, time.Minute, processor)
+	pool.SetRetryPolicy(3, 50*time.Millisecond)
+	pool.Start()
+	defer pool.Stop(time.Second)
+
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "old"})
+	time.Sleep(20 * time.Millisecond)
+	pool.Submit(Job{Repository: "test/repo", PRNumber: 1, HeadRef: "new"})
+	<-done
+	time.Sleep(100 * time.Millisecond) // let the retry of "old" be dequeued and skipped
+
+	if len(refs) != 2 || refs[0] != "old" || refs[1] != "new" {
+		t.Errorf("processed %v, want [old new]", refs)
+	}
+}
@@ -1,5 +1,7 @@
 package worker
 
+import "time"
+
 // Job represents a diff generation job
 type Job struct {
 	// GitHub information
@@ -8,12 +10,12 @@ type Job struct {
 	BaseRef      string
 	HeadRef      string
 	ChangedFiles []string
-	GitHubToken  string
+	GitHubToken  string `json:"-"` // Stored encrypted in Redis, see redisQueue
 	WorkflowName string
 
 	// ArgoCD information
 	ArgocdServer    string
-	ArgocdToken     string
+	ArgocdToken     string `json:"-"` // Stored encrypted in Redis, see redisQueue
 	ArgocdPlainText bool
 	ArgocdURL       string // Optional: ArgoCD UI URL for links in comments
 
@@ -23,4 +25,27 @@ type Job struct {
 	IgnoredMetadata      []string // List of label/annotation keys or prefixes to ignore (e.g., "argocd.argoproj.io/", "app.kubernetes.io/version")
 	CollapseThreshold    int      // Default: 3 - collapse all diffs if comment parts exceed this threshold (0 = disabled)
 	DestinationClusters  []string // Optional: only include apps targeting these destination cluster names
+	KindOrder            []string // Optional: kind priority for ordering resource diffs
+	GroupByKind          bool     // Default: false - render a heading per kind above the resource diffs
+	NormalizeEmbedded    bool     // Default: true - pretty-print JSON/YAML/TOML embedded in ConfigMap data before diffing
+	IncludeHooks         bool     // Default: false - diff Helm/ArgoCD hooks in a separate section
+	RiskRules            []string // Optional: risk rules to run (nil = all, empty = none)
+	DebugMatching        bool     // Default: false - append why apps were (not) matched to the comment
+
+	seq     uint64 // Submission order, set by Pool.Submit
+	attempt int    // Number of previous attempts, see Pool.SetRetryPolicy
+
+	submittedAt time.Time // Set by Pool.Submit
+}
+
+// jobKey identifies the jobs that supersede each other: a newer push to a
+// PR makes older diffs for the same workflow obsolete
+type jobKey struct {
+	repository string
+	prNumber   int
+	workflow   string
+}
+
+func (j Job) key() jobKey {
+	return jobKey{repository: j.Repository, prNumber: j.PRNumber, workflow: j.WorkflowName}
 }